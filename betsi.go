@@ -23,6 +23,9 @@ type ServerConfig struct {
 	Port int
 	// Router is the router used to handle the requests.
 	Router *Router
+	// LogRoutes determines whether to log the router routes
+	// when the app starts, see [Router.LogRoutes].
+	LogRoutes bool
 }
 
 type Config struct {
@@ -74,6 +77,11 @@ func (app *App) Start(preExecution ...func()) {
 		panic(err.JSON())
 	}
 
+	if err := app.cfg.Server.Router.ValidateRoutes(); err != nil {
+		err := errors.NewWithNameAndErr(ERR_NAME, ERR_START_W_BAD_ROUTES, err).(errors.Error)
+		panic(err.JSON())
+	}
+
 	logger := app.cfg.Logger
 	if logger == nil {
 		err := errors.NewWithName(ERR_NAME, ERR_NIL_LOGGER).(errors.Error)
@@ -85,6 +93,10 @@ func (app *App) Start(preExecution ...func()) {
 		"tlsEnabled": tlsEnabled,
 	})
 
+	if app.cfg.Server.LogRoutes {
+		app.cfg.Server.Router.LogRoutes(ctx, logger)
+	}
+
 	for _, f := range preExecution {
 		f()
 	}
@@ -127,6 +139,11 @@ func (app *App) StartTLS(certFile, keyFile string, preExecution ...func()) {
 		panic(err.JSON())
 	}
 
+	if err := app.cfg.Server.Router.ValidateRoutes(); err != nil {
+		err := errors.NewWithNameAndErr(ERR_NAME, ERR_START_W_BAD_ROUTES, err).(errors.Error)
+		panic(err.JSON())
+	}
+
 	logger := app.cfg.Logger
 	if logger == nil {
 		err := errors.NewWithName(ERR_NAME, ERR_NIL_LOGGER).(errors.Error)
@@ -138,6 +155,10 @@ func (app *App) StartTLS(certFile, keyFile string, preExecution ...func()) {
 		"tlsEnabled": tlsEnabled,
 	})
 
+	if app.cfg.Server.LogRoutes {
+		app.cfg.Server.Router.LogRoutes(ctx, logger)
+	}
+
 	for _, f := range preExecution {
 		f()
 	}
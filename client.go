@@ -0,0 +1,286 @@
+package betsi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/iolave/go-betsi/internal/utils"
+	"github.com/iolave/go-errors"
+)
+
+// ClientConfig is the configuration for the betsi http client.
+type ClientConfig struct {
+	// BaseURL is the url every request path is appended
+	// to (i.e "https://api.example.com/v1").
+	BaseURL string
+
+	// Headers are the default headers sent with every
+	// request. Headers set by the request itself (i.e
+	// trace headers) take precedence.
+	Headers http.Header
+
+	// HTTPClient is the client used to send the requests.
+	// If nil, [http.DefaultClient] is used.
+	HTTPClient *http.Client
+
+	// Timeout is the timeout of every request attempt,
+	// including reading the response body. Zero means
+	// no timeout. See [WithCallTimeout] to limit the
+	// duration of a whole call, retries included.
+	Timeout time.Duration
+
+	// Retry is the retry policy of every call. If nil,
+	// requests are not retried. It can be overridden per
+	// call with [WithCallRetry].
+	Retry *RetryConfig
+}
+
+// Client is an http client for betsi apps. Requests are built from
+// `ar` tagged structs (see [NewRequest]) and sent with [Do].
+type Client struct {
+	baseURL    string
+	headers    http.Header
+	httpClient *http.Client
+	timeout    time.Duration
+	retry      *RetryConfig
+	budget     *retryBudget
+}
+
+// NewClient returns a new client. It errors if the base url is not
+// a valid absolute url.
+//
+// Any returned error is of type [github.com/iolave/go-errors.GenericError].
+func NewClient(cfg ClientConfig) (*Client, error) {
+	u, err := url.Parse(cfg.BaseURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, errors.NewWithNameAndErr(
+			ERR_NAME_CLIENT,
+			ERR_CLIENT_INVALID_BASE_URL,
+			err,
+		)
+	}
+
+	c := &Client{
+		baseURL:    strings.TrimSuffix(cfg.BaseURL, "/"),
+		headers:    cfg.Headers.Clone(),
+		httpClient: cfg.HTTPClient,
+		timeout:    cfg.Timeout,
+		retry:      cfg.Retry,
+	}
+	if c.httpClient == nil {
+		c.httpClient = http.DefaultClient
+	}
+	if c.retry != nil {
+		c.budget = newRetryBudget(c.retry.Budget)
+	}
+
+	return c, nil
+}
+
+// CallOption overrides the client configuration for a single call.
+type CallOption func(cfg *callConfig)
+
+// callConfig is the configuration of a single call.
+type callConfig struct {
+	timeout time.Duration
+	retry   *RetryConfig
+	budget  *retryBudget
+}
+
+// WithCallTimeout limits the duration of the whole call, retries
+// and backoffs included.
+func WithCallTimeout(timeout time.Duration) CallOption {
+	return func(cfg *callConfig) {
+		cfg.timeout = timeout
+	}
+}
+
+// WithCallRetry overrides the client retry policy for the call.
+// If nil, the call is not retried. The retry budget of the call
+// is the client budget, when the client doesn't have one, the
+// call gets a budget of its own.
+func WithCallRetry(retry *RetryConfig) CallOption {
+	return func(cfg *callConfig) {
+		cfg.retry = retry
+	}
+}
+
+// Do sends a `method` request to the client base url joined with `path`
+// (i.e "/users/{id}"). The request is built from `in` (see [NewRequest]),
+// so `in` path params and body are encoded using its `ar` tags, and
+// trace headers found in ctx are propagated. The request is rebuilt
+// from `in` for every attempt when retries are enabled (see
+// [RetryConfig]).
+//
+// A 2xx response json body is decoded into a new `Out`, an empty body
+// returns the `Out` zero value.
+//
+// Any non 2xx response is returned as an error of type
+// [github.com/iolave/go-errors.HTTPError]. If the response body is a
+// [github.com/iolave/go-errors.HTTPError] json (i.e sent by
+// [AppRequest.SendJSONError]), it is decoded as is, so errors
+// round-trip between betsi apps. Any other returned error is of type
+// [github.com/iolave/go-errors.GenericError].
+//
+// Example:
+//
+//	type GetUserRequest struct {
+//		ID string `ar:"path=id"`
+//	}
+//
+//	user, err := betsi.Do[GetUserRequest, User](
+//		ctx, c, http.MethodGet, "/users/{id}", GetUserRequest{ID: "1"},
+//		betsi.WithCallTimeout(5*time.Second),
+//	)
+func Do[In, Out any](ctx context.Context, c *Client, method, path string, in In, opts ...CallOption) (*Out, error) {
+	cfg := callConfig{
+		retry:  c.retry,
+		budget: c.budget,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.retry != nil && cfg.budget == nil {
+		cfg.budget = newRetryBudget(cfg.retry.Budget)
+	}
+
+	if cfg.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.timeout)
+		defer cancel()
+	}
+
+	statusCode, b, err := c.send(ctx, method, cfg, func(ctx context.Context) (*http.Request, error) {
+		return NewRequest(ctx, method, c.baseURL+path, &in)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeResponse[Out](statusCode, b)
+}
+
+// send sends the request built by newReq until it succeeds or the
+// retry policy of cfg doesn't allow another attempt. It returns the
+// last response status code and body.
+func (c *Client) send(
+	ctx context.Context,
+	method string,
+	cfg callConfig,
+	newReq func(ctx context.Context) (*http.Request, error),
+) (int, []byte, error) {
+	for attempt := 1; ; attempt++ {
+		statusCode, header, b, err := c.attempt(ctx, newReq)
+		if statusCode == -1 {
+			// The request couldn't be built, there's
+			// nothing to retry.
+			return 0, nil, err
+		}
+
+		if cfg.retry == nil {
+			return statusCode, b, err
+		}
+
+		retryable := cfg.retry.isRetryable(method, statusCode, err) && ctx.Err() == nil
+		if !retryable {
+			if err == nil {
+				cfg.budget.onSuccess()
+			}
+			return statusCode, b, err
+		}
+		cfg.budget.onFailure()
+
+		wait, ok := cfg.retry.wait(attempt, statusCode, header)
+		if !ok || !cfg.budget.allow() {
+			return statusCode, b, err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+			return statusCode, b, err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return statusCode, b, err
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt builds and sends a single request and reads its response
+// body. The status code is -1 when the request couldn't be built and
+// 0 when it couldn't be sent.
+func (c *Client) attempt(
+	ctx context.Context,
+	newReq func(ctx context.Context) (*http.Request, error),
+) (int, http.Header, []byte, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	req, err := newReq(ctx)
+	if err != nil {
+		return -1, nil, nil, err
+	}
+
+	for k, v := range c.headers {
+		if _, ok := req.Header[k]; !ok {
+			req.Header[k] = v
+		}
+	}
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", "application/json")
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, nil, errors.NewWithNameAndErr(
+			ERR_NAME_CLIENT,
+			ERR_CLIENT_SEND,
+			err,
+		)
+	}
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return 0, nil, nil, errors.NewWithNameAndErr(
+			ERR_NAME_CLIENT,
+			ERR_CLIENT_READ_BODY,
+			err,
+		)
+	}
+
+	return res.StatusCode, res.Header, b, nil
+}
+
+// decodeResponse decodes the response body into a new `Out` or
+// into an [errors.HTTPError] for non 2xx responses.
+func decodeResponse[Out any](statusCode int, b []byte) (*Out, error) {
+	if statusCode < 200 || statusCode > 299 {
+		return nil, utils.ParseHTTPError(statusCode, b)
+	}
+
+	out := new(Out)
+	if len(b) == 0 {
+		return out, nil
+	}
+
+	if err := json.Unmarshal(b, out); err != nil {
+		return nil, errors.NewWithNameAndErr(
+			ERR_NAME_CLIENT,
+			ERR_CLIENT_DECODE_BODY,
+			err,
+		)
+	}
+
+	return out, nil
+}
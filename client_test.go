@@ -0,0 +1,85 @@
+package betsi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/iolave/go-errors"
+)
+
+type clientTestGetUserRequest struct {
+	ID string `ar:"path=id"`
+}
+
+type clientTestUser struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func newClientTestServer(t *testing.T) *Client {
+	r := NewRouter()
+	Get(r, "/users/{id}", func(ar AppRequest[clientTestGetUserRequest, clientTestUser]) {
+		ctx := ar.Context()
+		in, err := ar.ParseRequest()
+		if err != nil {
+			ar.SendJSONError(ctx, err)
+			return
+		}
+		if in.ID != "1" {
+			ar.SendJSONError(ctx, errors.NewNotFoundError("user not found", nil))
+			return
+		}
+		ar.SendJSON(ctx, clientTestUser{ID: in.ID, Name: ar.Req.Header.Get("X-Name")})
+	})
+
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+
+	c, err := NewClient(ClientConfig{
+		BaseURL: srv.URL,
+		Headers: http.Header{"X-Name": []string{"betsi"}},
+	})
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+
+	return c
+}
+
+func TestNewClient(t *testing.T) {
+	for _, baseURL := range []string{"", "/users", "://invalid"} {
+		if _, err := NewClient(ClientConfig{BaseURL: baseURL}); err == nil {
+			t.Errorf("got nil error for base url %q", baseURL)
+		}
+	}
+}
+
+func TestDo(t *testing.T) {
+	c := newClientTestServer(t)
+	ctx := context.Background()
+
+	user, err := Do[clientTestGetUserRequest, clientTestUser](ctx, c, http.MethodGet, "/users/{id}", clientTestGetUserRequest{ID: "1"})
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if user.ID != "1" || user.Name != "betsi" {
+		t.Errorf("got user %+v", user)
+	}
+
+	_, err = Do[clientTestGetUserRequest, clientTestUser](ctx, c, http.MethodGet, "/users/{id}", clientTestGetUserRequest{ID: "2"})
+	httpErr, ok := err.(*errors.HTTPError)
+	if !ok {
+		t.Fatalf("got error %T, want *errors.HTTPError", err)
+	}
+	if httpErr.StatusCode != http.StatusNotFound || httpErr.Name != "not_found_error" || httpErr.Message != "user not found" {
+		t.Errorf("got error %+v", httpErr)
+	}
+
+	_, err = Do[clientTestGetUserRequest, clientTestUser](ctx, c, http.MethodPost, "/users/{id}", clientTestGetUserRequest{ID: "1"})
+	httpErr, ok = err.(*errors.HTTPError)
+	if !ok || httpErr.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("got error %v, want a method not allowed error", err)
+	}
+}
@@ -0,0 +1,92 @@
+// Command betsi is the go-betsi command line tool.
+//
+// Usage:
+//
+//	betsi gen -spec <file|url> [-lang go|ts] [-pkg name] [-out file]
+//
+// The gen command generates a typed client from the OpenAPI json
+// document of a betsi app (see [betsi.Router.OpenAPIHandler]), the
+// document can be read from a file or fetched from a running app:
+//
+//	betsi gen -spec http://localhost:3000/docs/openapi.json -lang go -pkg users -out users/client.go
+//	betsi gen -spec openapi.json -lang ts -out src/client.ts
+//
+// To generate a client from a registered router without serving it,
+// use the [github.com/iolave/go-betsi/pkg/codegen] package within a
+// go:generate program instead.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/iolave/go-betsi/pkg/codegen"
+)
+
+const usage = `usage: betsi <command> [flags]
+
+commands:
+  gen  generates a typed client from an OpenAPI document
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "gen":
+		if err := gen(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(os.Stdout, usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %s\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+}
+
+// gen runs the gen command with args.
+func gen(args []string) error {
+	fs := flag.NewFlagSet("gen", flag.ExitOnError)
+	spec := fs.String("spec", "", "OpenAPI json document file path or url (required)")
+	lang := fs.String("lang", "go", "client language, one of go or ts")
+	pkg := fs.String("pkg", "client", "package name of the go client")
+	out := fs.String("out", "", "output file, defaults to stdout")
+	fs.Parse(args)
+
+	if *spec == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	doc, err := codegen.Load(context.Background(), *spec)
+	if err != nil {
+		return err
+	}
+
+	var b []byte
+	switch *lang {
+	case "go":
+		b, err = codegen.Go(doc, codegen.GoConfig{Package: *pkg})
+	case "ts":
+		b, err = codegen.TypeScript(doc)
+	default:
+		return fmt.Errorf("unsupported language %s (oneof:go,ts)", *lang)
+	}
+	if err != nil {
+		return err
+	}
+
+	if *out == "" {
+		_, err = os.Stdout.Write(b)
+		return err
+	}
+
+	return os.WriteFile(*out, b, 0o644)
+}
@@ -0,0 +1,83 @@
+package betsi
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/iolave/go-betsi/pkg/handlers"
+)
+
+// DocsConfig is the configuration of the API docs mounted
+// with [Router.MountDocs].
+type DocsConfig struct {
+	// Path is the path where the docs are mounted.
+	// Defaults to "/docs".
+	Path string
+
+	// OpenAPI is the configuration of the documented
+	// OpenAPI document.
+	OpenAPI OpenAPIConfig
+
+	// EnableInProduction determines whether to mount the
+	// docs when the app is built with the "production"
+	// build tag. Docs are always mounted otherwise.
+	EnableInProduction bool
+}
+
+// MountDocs mounts an interactive API docs UI at cfg.Path along with
+// the OpenAPI document of the router (see [Router.OpenAPI]), which is
+// served at "<path>/openapi.json" and "<path>/openapi.yaml". The UI
+// assets are embedded within the binary (see
+// [github.com/iolave/go-betsi/pkg/handlers.NewDocsHandler]).
+//
+// Docs are disabled by default on builds with the "production" build
+// tag (go build -tags production), in which case nothing is mounted
+// unless cfg.EnableInProduction is set. It returns true if the docs
+// were mounted.
+//
+// Example:
+//
+//	r.MountDocs(betsi.DocsConfig{
+//		Path: "/docs",
+//		OpenAPI: betsi.OpenAPIConfig{
+//			Info: betsi.OpenAPIInfo{Title: "my-app", Version: "v1.0.0"},
+//		},
+//	})
+func (r Router) MountDocs(cfg DocsConfig) bool {
+	if !docsEnabled && !cfg.EnableInProduction {
+		return false
+	}
+
+	path := strings.TrimSuffix(cfg.Path, "/")
+	if path == "" {
+		path = "/docs"
+	}
+
+	title := cfg.OpenAPI.Info.Title
+	if title == "" {
+		title = "API docs"
+	}
+
+	spec := r.OpenAPIHandler(cfg.OpenAPI)
+	// The urls are relative to the UI, which is served at
+	// "<path>/", so the docs work within mounted routers.
+	ui := handlers.NewDocsHandler(handlers.DocsHandlerConfig{
+		Title:   title,
+		SpecURL: "openapi.json",
+		APIURL:  strings.Repeat("../", strings.Count(path, "/")),
+	})
+
+	docs := NewRouter()
+	for _, pat := range []string{"/openapi.json", "/openapi.yaml"} {
+		docs.handle(RouteMeta{
+			Method:  http.MethodGet,
+			Pattern: pat,
+			Hidden:  true,
+		}, funcName(spec), spec.ServeHTTP)
+	}
+	docs.mux.Handle("/", ui)
+	docs.mux.Handle("/*", ui)
+	r.Route(path, docs)
+
+	return true
+}
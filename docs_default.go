@@ -0,0 +1,7 @@
+//go:build !production
+
+package betsi
+
+// docsEnabled determines whether the API docs are
+// mounted by default, see [Router.MountDocs].
+const docsEnabled = true
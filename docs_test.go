@@ -0,0 +1,138 @@
+//go:build !production
+
+package betsi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRouterMountDocs(t *testing.T) {
+	r := NewRouter()
+	r.Get("/users", Handler[any, any](func(ar AppRequest[any, any]) {}))
+	if !r.MountDocs(DocsConfig{OpenAPI: OpenAPIConfig{Info: OpenAPIInfo{Title: "test"}}}) {
+		t.Fatalf("docs were not mounted")
+	}
+
+	type TestCase struct {
+		Name       string
+		Path       string
+		WantStatus int
+		WantBody   string
+	}
+
+	testCases := []TestCase{}
+	testCases = append(testCases, TestCase{
+		Name:       "base path should redirect",
+		Path:       "/docs",
+		WantStatus: http.StatusMovedPermanently,
+	})
+	testCases = append(testCases, TestCase{
+		Name:       "index should reference the spec",
+		Path:       "/docs/",
+		WantStatus: http.StatusOK,
+		WantBody:   `"openapi.json"`,
+	})
+	testCases = append(testCases, TestCase{
+		Name:       "assets should be served",
+		Path:       "/docs/docs.js",
+		WantStatus: http.StatusOK,
+		WantBody:   "config.specURL",
+	})
+	testCases = append(testCases, TestCase{
+		Name:       "unknown assets should not be found",
+		Path:       "/docs/unknown.js",
+		WantStatus: http.StatusNotFound,
+	})
+	testCases = append(testCases, TestCase{
+		Name:       "yaml spec should be served",
+		Path:       "/docs/openapi.yaml",
+		WantStatus: http.StatusOK,
+		WantBody:   "openapi: ",
+	})
+
+	for _, tt := range testCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.Path, nil))
+			if w.Code != tt.WantStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.WantStatus)
+			}
+			if !strings.Contains(w.Body.String(), tt.WantBody) {
+				t.Errorf("got body %s, want it to contain %s", w.Body.String(), tt.WantBody)
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs/openapi.json", nil))
+	doc := OpenAPIDocument{}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if len(doc.Paths) != 1 || doc.Paths["/users"] == nil {
+		t.Errorf("got paths %v, want only /users", doc.Paths)
+	}
+}
+
+func TestRouterMountDocsWithinSubrouter(t *testing.T) {
+	api := NewRouter()
+	api.Get("/users", Handler[any, any](func(ar AppRequest[any, any]) {}))
+	if !api.MountDocs(DocsConfig{OpenAPI: OpenAPIConfig{Info: OpenAPIInfo{Title: "test"}}}) {
+		t.Fatalf("docs were not mounted")
+	}
+	r := NewRouter()
+	r.Route("/api", api)
+
+	type TestCase struct {
+		Name         string
+		Path         string
+		WantStatus   int
+		WantBody     string
+		WantLocation string
+	}
+
+	testCases := []TestCase{}
+	testCases = append(testCases, TestCase{
+		Name:         "base path should redirect within the mount",
+		Path:         "/api/docs",
+		WantStatus:   http.StatusMovedPermanently,
+		WantLocation: "/api/docs/",
+	})
+	testCases = append(testCases, TestCase{
+		Name:       "index should reference the spec relative to the mount",
+		Path:       "/api/docs/",
+		WantStatus: http.StatusOK,
+		WantBody:   `"apiURL": "../"`,
+	})
+	testCases = append(testCases, TestCase{
+		Name:       "assets should be served",
+		Path:       "/api/docs/docs.css",
+		WantStatus: http.StatusOK,
+	})
+	testCases = append(testCases, TestCase{
+		Name:       "spec should be served",
+		Path:       "/api/docs/openapi.json",
+		WantStatus: http.StatusOK,
+		WantBody:   `"/users"`,
+	})
+
+	for _, tt := range testCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.Path, nil))
+			if w.Code != tt.WantStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.WantStatus)
+			}
+			if !strings.Contains(w.Body.String(), tt.WantBody) {
+				t.Errorf("got body %s, want it to contain %s", w.Body.String(), tt.WantBody)
+			}
+			if loc := w.Header().Get("Location"); loc != tt.WantLocation {
+				t.Errorf("got location %q, want %q", loc, tt.WantLocation)
+			}
+		})
+	}
+}
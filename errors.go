@@ -6,6 +6,7 @@ const (
 	ERR_NIL_LOGGER         = "logger cannot be nil"
 	ERR_START_W_NIL_SERVER = "server config not provided"
 	ERR_START_W_NIL_ROUTER = "router cannot be nil"
+	ERR_START_W_BAD_ROUTES = "router has invalid routes"
 	ERR_INVALID_TYPE       = "expected type %s, got %s"
 )
 
@@ -29,6 +30,9 @@ const (
 	ERR_ENCDEC_INVALID_TAG     = "tag %s is not supported (name:%s)"
 	ERR_ENCDEC_PARSE           = "failed to parse request body"
 	ERR_ENC_DEC_EXPECT_PTR     = "v has to be a pointer to a struct, got %s"
+	ERR_ENC_PATH_NOT_FOUND     = "path param %s not found in url (name:%s)"
+	ERR_ENC_PATH_UNFILLED      = "path param %s has no value"
+	ERR_ENC_PATH_MISMATCH      = "path param %s value doesn't match %s (name:%s)"
 )
 
 // AR errors
@@ -37,3 +41,22 @@ const (
 	ERR_AR_NIL_REQ      = "ar.Req is nil"
 	ERR_AR_NIL_REQ_BODY = "ar.Req.Body is nil"
 )
+
+// Route registration errors
+const (
+	ERR_ROUTE_PATH_NOT_FOUND = "path param %s not found in pattern %s (name:%s)"
+)
+
+// OpenAPI errors
+const (
+	ERR_OPENAPI_MARSHAL = "failed to marshal the OpenAPI document"
+)
+
+// Client errors
+const (
+	ERR_NAME_CLIENT             = "client_error"
+	ERR_CLIENT_INVALID_BASE_URL = "base url has to be a valid absolute url"
+	ERR_CLIENT_SEND             = "failed to send request"
+	ERR_CLIENT_READ_BODY        = "failed to read response body"
+	ERR_CLIENT_DECODE_BODY      = "failed to decode response body"
+)
@@ -3,8 +3,10 @@ package betsi
 import (
 	"context"
 	"net/http"
+	neturl "net/url"
 	"reflect"
 
+	"github.com/iolave/go-betsi/internal/utils"
 	"github.com/iolave/go-errors"
 	"github.com/iolave/go-trace"
 )
@@ -26,7 +28,11 @@ import (
 //		} `ar:"body=json"`
 //	}
 //
-// Any returned error is of type [github.com/iolave/go-errors.HTTPError].
+// The request is bound to ctx and, when v has a body, the "Content-Type"
+// header is set to "application/json". Trace headers found in ctx are
+// set in the request headers.
+//
+// Any returned error is of type [github.com/iolave/go-errors.GenericError].
 func NewRequest(ctx context.Context, method string, url string, v any) (*http.Request, error) {
 	switch reflect.ValueOf(v).Kind() {
 	case reflect.Ptr:
@@ -37,7 +43,9 @@ func NewRequest(ctx context.Context, method string, url string, v any) (*http.Re
 			)
 		}
 	case reflect.Struct:
-		v = reflect.ValueOf(v).Interface()
+		ptr := reflect.New(reflect.TypeOf(v))
+		ptr.Elem().Set(reflect.ValueOf(v))
+		v = ptr.Interface()
 	default:
 		return nil, errors.NewWithName(
 			"app_error",
@@ -46,15 +54,25 @@ func NewRequest(ctx context.Context, method string, url string, v any) (*http.Re
 
 	}
 
+	urlPattern := url
 	url, reader, err := encodeAppRequest(url, v)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequest(method, url, reader)
+	// Keeps the path pattern within the request context, so
+	// outgoing requests can be logged by pattern.
+	if u, err := neturl.Parse(urlPattern); err == nil {
+		ctx = utils.SetPathPatternInContext(ctx, u.Path)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
 	if err != nil {
 		return nil, errors.Wrap(err)
 	}
+	if reader != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
 	t := trace.GetFromContext(ctx)
 	t.SetHTTPHeaders(req.Header)
 	return req, nil
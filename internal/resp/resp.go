@@ -0,0 +1,174 @@
+// Package resp implements a minimal client of the redis serialization
+// protocol (RESP2), enough to talk to redis compatible servers without
+// depending on a redis client library.
+//
+// Replies are decoded as:
+//
+//   - Simple strings as [SimpleString].
+//   - Errors as [Error].
+//   - Integers as int64.
+//   - Bulk strings as string.
+//   - Arrays as []any.
+//   - Null bulk strings and null arrays as nil.
+package resp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// SimpleString is a simple string reply (i.e "OK").
+type SimpleString string
+
+// Error is an error reply sent by the server.
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// Conn is a connection to a RESP server. It is not safe for concurrent use.
+type Conn struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	w       *bufio.Writer
+	timeout time.Duration
+}
+
+// NewConn returns a new connection that sends commands through c, where
+// timeout is the read/write deadline of every command (zero means none).
+func NewConn(c net.Conn, timeout time.Duration) *Conn {
+	return &Conn{
+		conn:    c,
+		r:       bufio.NewReader(c),
+		w:       bufio.NewWriter(c),
+		timeout: timeout,
+	}
+}
+
+// Do sends a command and returns its reply. Error replies are returned
+// as an [Error], any other error means the connection is broken.
+func (c *Conn) Do(args ...string) (any, error) {
+	if c.timeout > 0 {
+		c.conn.SetDeadline(time.Now().Add(c.timeout))
+	}
+
+	if err := WriteCommand(c.w, args...); err != nil {
+		return nil, err
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	v, err := ReadReply(c.r)
+	if err != nil {
+		return nil, err
+	}
+	if err, ok := v.(Error); ok {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// Close closes the connection.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// WriteCommand writes a command as an array of bulk strings.
+func WriteCommand(w *bufio.Writer, args ...string) error {
+	vs := make([]any, len(args))
+	for i, arg := range args {
+		vs[i] = arg
+	}
+
+	return WriteReply(w, vs)
+}
+
+// WriteReply writes v using the type mapping described in the package
+// documentation.
+func WriteReply(w *bufio.Writer, v any) error {
+	var err error
+	switch v := v.(type) {
+	case nil:
+		_, err = w.WriteString("$-1\r\n")
+	case SimpleString:
+		_, err = fmt.Fprintf(w, "+%s\r\n", v)
+	case Error:
+		_, err = fmt.Fprintf(w, "-%s\r\n", v)
+	case int64:
+		_, err = fmt.Fprintf(w, ":%d\r\n", v)
+	case string:
+		_, err = fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case []any:
+		if _, err = fmt.Fprintf(w, "*%d\r\n", len(v)); err != nil {
+			return err
+		}
+		for _, e := range v {
+			if err = WriteReply(w, e); err != nil {
+				return err
+			}
+		}
+	default:
+		err = fmt.Errorf("resp: unsupported type %T", v)
+	}
+
+	return err
+}
+
+// ReadReply reads a single reply (or command) using the type mapping
+// described in the package documentation.
+func ReadReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("resp: malformed line %q", line)
+	}
+	kind, line := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return SimpleString(line), nil
+	case '-':
+		return Error(line), nil
+	case ':':
+		return strconv.ParseInt(line, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line)
+		if err != nil {
+			return nil, fmt.Errorf("resp: malformed bulk length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return string(b[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line)
+		if err != nil {
+			return nil, fmt.Errorf("resp: malformed array length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		vs := make([]any, n)
+		for i := range vs {
+			if vs[i], err = ReadReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return vs, nil
+	}
+
+	return nil, fmt.Errorf("resp: unknown reply type %q", kind)
+}
@@ -0,0 +1,308 @@
+// Package resptest provides an in-memory redis compatible server to test
+// RESP clients against, supporting the string and transaction commands
+// used by betsi (GET, SET, DEL, WATCH, MULTI, EXEC, ...).
+package resptest
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iolave/go-betsi/internal/resp"
+)
+
+// Server is an in-memory redis compatible server.
+type Server struct {
+	// Addr is the address the server listens on.
+	Addr string
+
+	ln net.Listener
+	wg sync.WaitGroup
+
+	mu       sync.Mutex
+	password string
+	keys     map[string]*entry
+	conns    map[net.Conn]bool
+	calls    map[string]int
+
+	// versions is incremented on every write of a key,
+	// so EXEC can tell if a watched key was modified.
+	versions map[string]int
+}
+
+// entry is a stored key.
+type entry struct {
+	value     string
+	expiresAt time.Time
+}
+
+// session is the state of a single connection.
+type session struct {
+	authed  bool
+	watched map[string]int
+	multi   bool
+	queued  [][]string
+}
+
+// NewServer starts a new server listening on a random local port.
+func NewServer() *Server {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+
+	s := &Server{
+		Addr:     ln.Addr().String(),
+		ln:       ln,
+		keys:     map[string]*entry{},
+		conns:    map[net.Conn]bool{},
+		calls:    map[string]int{},
+		versions: map[string]int{},
+	}
+	s.wg.Go(s.serve)
+
+	return s
+}
+
+// Close stops the server and closes every connection.
+func (s *Server) Close() {
+	s.ln.Close()
+	s.mu.Lock()
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// SetPassword sets the password required by the AUTH command
+// before any other command is accepted.
+func (s *Server) SetPassword(password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.password = password
+}
+
+// Get returns the value of key.
+func (s *Server) Get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.get(key)
+	if e == nil {
+		return "", false
+	}
+
+	return e.value, true
+}
+
+// Calls returns how many times the command (i.e "EXEC") was called.
+func (s *Server) Calls(cmd string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.calls[strings.ToUpper(cmd)]
+}
+
+// serve accepts connections until the listener is closed.
+func (s *Server) serve() {
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns[c] = true
+		s.mu.Unlock()
+
+		s.wg.Go(func() {
+			s.handle(c)
+			s.mu.Lock()
+			delete(s.conns, c)
+			s.mu.Unlock()
+			c.Close()
+		})
+	}
+}
+
+// handle executes the commands sent through c.
+func (s *Server) handle(c net.Conn) {
+	r, w := bufio.NewReader(c), bufio.NewWriter(c)
+	sess := &session{}
+	for {
+		v, err := resp.ReadReply(r)
+		if err != nil {
+			return
+		}
+
+		vs, ok := v.([]any)
+		if !ok || len(vs) == 0 {
+			return
+		}
+		args := make([]string, len(vs))
+		for i, v := range vs {
+			args[i], _ = v.(string)
+		}
+
+		if err := resp.WriteReply(w, s.exec(sess, args)); err != nil {
+			return
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// exec executes a single command of the session.
+func (s *Server) exec(sess *session, args []string) any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cmd := strings.ToUpper(args[0])
+	s.calls[cmd]++
+
+	if cmd == "AUTH" {
+		if args[len(args)-1] != s.password {
+			return resp.Error("WRONGPASS invalid username-password pair")
+		}
+		sess.authed = true
+		return resp.SimpleString("OK")
+	}
+	if !sess.authed && s.password != "" {
+		return resp.Error("NOAUTH Authentication required.")
+	}
+
+	if sess.multi {
+		switch cmd {
+		case "EXEC":
+			return s.execMulti(sess)
+		case "DISCARD":
+			sess.multi, sess.queued, sess.watched = false, nil, nil
+			return resp.SimpleString("OK")
+		case "WATCH", "MULTI":
+			return resp.Error("ERR " + cmd + " inside MULTI is not allowed")
+		}
+		sess.queued = append(sess.queued, args)
+		return resp.SimpleString("QUEUED")
+	}
+
+	switch cmd {
+	case "WATCH":
+		if sess.watched == nil {
+			sess.watched = map[string]int{}
+		}
+		for _, key := range args[1:] {
+			sess.watched[key] = s.versions[key]
+			s.get(key)
+		}
+		return resp.SimpleString("OK")
+	case "UNWATCH":
+		sess.watched = nil
+		return resp.SimpleString("OK")
+	case "MULTI":
+		sess.multi = true
+		return resp.SimpleString("OK")
+	case "EXEC", "DISCARD":
+		return resp.Error("ERR " + cmd + " without MULTI")
+	}
+
+	return s.run(args)
+}
+
+// execMulti executes the queued commands of the session, unless a
+// watched key has been modified since it was watched.
+func (s *Server) execMulti(sess *session) any {
+	defer func() {
+		sess.multi, sess.queued, sess.watched = false, nil, nil
+	}()
+
+	for key, version := range sess.watched {
+		// Expired keys count as modified.
+		s.get(key)
+		if s.versions[key] != version {
+			return nil
+		}
+	}
+
+	replies := []any{}
+	for _, args := range sess.queued {
+		replies = append(replies, s.run(args))
+	}
+
+	return replies
+}
+
+// run runs a single data command, the server lock has to be held.
+func (s *Server) run(args []string) any {
+	switch cmd := strings.ToUpper(args[0]); cmd {
+	case "PING":
+		return resp.SimpleString("PONG")
+	case "SELECT":
+		return resp.SimpleString("OK")
+	case "GET":
+		if len(args) != 2 {
+			return resp.Error("ERR wrong number of arguments for 'get' command")
+		}
+		if e := s.get(args[1]); e != nil {
+			return e.value
+		}
+		return nil
+	case "SET":
+		if len(args) < 3 {
+			return resp.Error("ERR wrong number of arguments for 'set' command")
+		}
+		e := &entry{value: args[2]}
+		for i := 3; i < len(args); i++ {
+			opt := strings.ToUpper(args[i])
+			if (opt != "PX" && opt != "EX") || i+1 == len(args) {
+				return resp.Error("ERR syntax error")
+			}
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || n <= 0 {
+				return resp.Error("ERR invalid expire time in 'set' command")
+			}
+			unit := time.Millisecond
+			if opt == "EX" {
+				unit = time.Second
+			}
+			e.expiresAt = time.Now().Add(time.Duration(n) * unit)
+			i++
+		}
+		s.keys[args[1]] = e
+		s.versions[args[1]]++
+		return resp.SimpleString("OK")
+	case "DEL":
+		n := int64(0)
+		for _, key := range args[1:] {
+			if s.get(key) != nil {
+				delete(s.keys, key)
+				s.versions[key]++
+				n++
+			}
+		}
+		return n
+	default:
+		return resp.Error("ERR unknown command '" + args[0] + "'")
+	}
+}
+
+// get returns the entry of key (nil if it doesn't exist), removing
+// it if it has expired. The server lock has to be held.
+func (s *Server) get(key string) *entry {
+	e, ok := s.keys[key]
+	if !ok {
+		return nil
+	}
+	if !e.expiresAt.IsZero() && !time.Now().Before(e.expiresAt) {
+		delete(s.keys, key)
+		s.versions[key]++
+		return nil
+	}
+
+	return e
+}
@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"context"
+
+	"github.com/iolave/go-trace"
+)
+
+// REQUEST_ID_TRACE_KEY is the trace key of the request id.
+const REQUEST_ID_TRACE_KEY = "request_id"
+
+// pathPatternKey is the context key of the request
+// path pattern.
+type pathPatternKey struct{}
+
+// SetPathPatternInContext returns a copy of ctx that holds
+// the path pattern (i.e "/users/{id}") used to build an
+// outgoing request.
+func SetPathPatternInContext(ctx context.Context, pattern string) context.Context {
+	return context.WithValue(ctx, pathPatternKey{}, pattern)
+}
+
+// GetPathPatternFromContext returns the path pattern stored
+// in ctx by SetPathPatternInContext, or an empty string if
+// there's none.
+func GetPathPatternFromContext(ctx context.Context) string {
+	pattern, _ := ctx.Value(pathPatternKey{}).(string)
+	return pattern
+}
+
+// GetRequestIDFromContext returns the request id of the trace
+// stored in ctx, or an empty string if there's none.
+func GetRequestIDFromContext(ctx context.Context) string {
+	return trace.GetFromContext(ctx).Get(REQUEST_ID_TRACE_KEY)
+}
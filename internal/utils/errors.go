@@ -1,7 +1,77 @@
 package utils
 
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/iolave/go-errors"
+)
+
+// anyError is used to decode the json representation of
+// an error of unknown type (i.e [errors.HTTPError.Err]).
 type anyError map[string]any
 
+// Error returns "<name>: <message>" if the decoded error
+// has a name and a message, otherwise it returns the json
+// representation of the error.
 func (e anyError) Error() string {
-	return ""
+	name, _ := e["name"].(string)
+	msg, _ := e["message"].(string)
+	if name != "" && msg != "" {
+		return fmt.Sprintf("%s: %s", name, msg)
+	}
+
+	b, _ := json.Marshal(map[string]any(e))
+	return string(b)
+}
+
+// ParseHTTPError decodes the json representation of an
+// [errors.HTTPError] sent with the `statusCode` status.
+//
+// If b is not a valid [errors.HTTPError] json, it returns
+// an [errors.HTTPError] named after the status text (i.e
+// "service_unavailable_error") with b as its message.
+func ParseHTTPError(statusCode int, b []byte) *errors.HTTPError {
+	// The error is decoded as a raw message, so it's only set
+	// when the json has a non null "error" field.
+	var decoded struct {
+		StatusCode int             `json:"statusCode"`
+		Name       string          `json:"name"`
+		Message    string          `json:"message"`
+		Err        json.RawMessage `json:"error"`
+	}
+	if jsonErr := json.Unmarshal(b, &decoded); jsonErr != nil || decoded.Name == "" {
+		name := strings.ToLower(http.StatusText(statusCode))
+		name = strings.ReplaceAll(name, " ", "_") + "_error"
+		return errors.NewHTTPError(
+			statusCode,
+			name,
+			strings.TrimSpace(string(b)),
+			nil,
+		).(*errors.HTTPError)
+	}
+
+	err := &errors.HTTPError{
+		StatusCode: decoded.StatusCode,
+		Name:       decoded.Name,
+		Message:    decoded.Message,
+	}
+	if err.StatusCode == 0 {
+		err.StatusCode = statusCode
+	}
+	if len(decoded.Err) > 0 && string(decoded.Err) != "null" {
+		cause, msg := anyError{}, ""
+		switch {
+		case json.Unmarshal(decoded.Err, &cause) == nil:
+			err.Err = cause
+		case json.Unmarshal(decoded.Err, &msg) == nil:
+			err.Err = errors.New(msg)
+		default:
+			err.Err = errors.New(string(decoded.Err))
+		}
+	}
+
+	return err
 }
@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestParseHTTPError(t *testing.T) {
+	type TestCase struct {
+		Name       string
+		StatusCode int
+		Body       string
+		WantStatus int
+		WantName   string
+		WantMsg    string
+		// WantErr is the expected error of the HTTPError,
+		// empty when it has to be nil.
+		WantErr string
+	}
+
+	testCases := []TestCase{}
+	testCases = append(testCases, TestCase{
+		Name:       "errors without an error field should have no error",
+		StatusCode: http.StatusConflict,
+		Body:       `{"statusCode":409,"name":"conflict_error","message":"user exists"}`,
+		WantStatus: http.StatusConflict,
+		WantName:   "conflict_error",
+		WantMsg:    "user exists",
+	})
+	testCases = append(testCases, TestCase{
+		Name:       "errors with a null error field should have no error",
+		StatusCode: http.StatusConflict,
+		Body:       `{"statusCode":409,"name":"conflict_error","message":"user exists","error":null}`,
+		WantStatus: http.StatusConflict,
+		WantName:   "conflict_error",
+		WantMsg:    "user exists",
+	})
+	testCases = append(testCases, TestCase{
+		Name:       "error objects should be decoded",
+		StatusCode: http.StatusBadGateway,
+		Body:       `{"name":"bad_gateway_error","message":"upstream failed","error":{"name":"timeout","message":"took too long"}}`,
+		WantStatus: http.StatusBadGateway,
+		WantName:   "bad_gateway_error",
+		WantMsg:    "upstream failed",
+		WantErr:    "timeout: took too long",
+	})
+	testCases = append(testCases, TestCase{
+		Name:       "error strings should be decoded",
+		StatusCode: http.StatusBadGateway,
+		Body:       `{"name":"bad_gateway_error","message":"upstream failed","error":"timeout"}`,
+		WantStatus: http.StatusBadGateway,
+		WantName:   "bad_gateway_error",
+		WantMsg:    "upstream failed",
+		WantErr:    "error: timeout",
+	})
+	testCases = append(testCases, TestCase{
+		Name:       "non json bodies should be used as the message",
+		StatusCode: http.StatusServiceUnavailable,
+		Body:       "try again later\n",
+		WantStatus: http.StatusServiceUnavailable,
+		WantName:   "service_unavailable_error",
+		WantMsg:    "try again later",
+	})
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			got := ParseHTTPError(tc.StatusCode, []byte(tc.Body))
+			if got.StatusCode != tc.WantStatus || got.Name != tc.WantName || got.Message != tc.WantMsg {
+				t.Errorf("got %+v", got)
+			}
+			if tc.WantErr == "" && got.Err != nil {
+				t.Errorf("got error %v, want nil", got.Err)
+			}
+			if tc.WantErr != "" && (got.Err == nil || got.Err.Error() != tc.WantErr) {
+				t.Errorf("got error %v, want %q", got.Err, tc.WantErr)
+			}
+		})
+	}
+}
@@ -1,37 +1,285 @@
 package utils
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
+	"io"
+	"mime"
+	"net"
 	"net/http"
+	"strings"
 
 	"github.com/iolave/go-errors"
+	"github.com/iolave/go-trace"
 )
 
-var _ http.ResponseWriter = &ResponseWriter{}
+var (
+	_ http.ResponseWriter = &ResponseWriter{}
+	_ http.Flusher        = &ResponseWriter{}
+	_ http.Hijacker       = responseHijacker{}
+	_ http.Pusher         = responsePusher{}
+	_ io.ReaderFrom       = responseReaderFrom{}
+)
+
+// maxErrorBodySize is the maximum number of bytes of an
+// error response body that are parsed into SentErr.
+const maxErrorBodySize = 64 << 10
 
 // customResponseWriter is a wrapper around http.ResponseWriter that
-// allows us to store the status code and error that was sent to the
-// client, it implements http.ResponseWriter interface.
+// allows us to store the status code, error and number of body bytes
+// that were sent to the client, it implements http.ResponseWriter
+// interface.
+//
+// The status defaults to 200 when the body is written without calling
+// WriteHeader. Responses with a 4xx or 5xx status are stored as
+// SentErr, which is parsed from the body for JSON responses.
+//
+// When CaptureLimit is greater than zero, up to CaptureLimit bytes of
+// the body are also captured. Writes are never buffered, so streamed
+// responses are sent as they are written.
+//
+// The http.Flusher interface is implemented by calling the original
+// writer, which is also returned by Unwrap so it can be used by
+// [http.ResponseController]. The http.Hijacker, http.Pusher and
+// io.ReaderFrom interfaces are only implemented by the writer returned
+// by Wrap, when the original writer implements them.
 type ResponseWriter struct {
-	SentStatus int
-	SentErr    error
-	Original   http.ResponseWriter
+	SentStatus   int
+	SentErr      error
+	SentBytes    int64
+	Original     http.ResponseWriter
+	CaptureLimit int64
+
+	written   bool
+	captured  []byte
+	truncated bool
+	errBody   []byte
 }
 
 func (w ResponseWriter) Header() http.Header {
 	return w.Original.Header()
 }
 func (w *ResponseWriter) Write(b []byte) (int, error) {
-	if w.SentStatus < 200 || w.SentStatus > 299 {
-		err := errors.HTTPError{
-			Err: &anyError{},
-		}
-		json.Unmarshal(b, &err)
-		w.SentErr = &err
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
 	}
-	return w.Original.Write(b)
+	n, err := w.Original.Write(b)
+	w.SentBytes += int64(n)
+	w.capture(b[:n])
+	w.parseError(b[:n])
+	return n, err
 }
 func (w *ResponseWriter) WriteHeader(statusCode int) {
+	// Informational responses are followed by the final one.
+	if statusCode >= 100 && statusCode < 200 && statusCode != http.StatusSwitchingProtocols {
+		w.Original.WriteHeader(statusCode)
+		return
+	}
+	// Superfluous calls are ignored (and reported) by the
+	// original writer.
+	if w.written {
+		w.Original.WriteHeader(statusCode)
+		return
+	}
+
+	w.written = true
 	w.SentStatus = statusCode
+	if statusCode >= 400 {
+		w.SentErr = ParseHTTPError(statusCode, []byte(http.StatusText(statusCode)))
+	}
 	w.Original.WriteHeader(statusCode)
 }
+
+// parseError parses the JSON error response body written so far
+// into SentErr, bodies larger than maxErrorBodySize are not parsed.
+func (w *ResponseWriter) parseError(b []byte) {
+	if w.SentStatus < 400 || len(w.errBody)+len(b) > maxErrorBodySize {
+		return
+	}
+	mt, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if mt != "application/json" && !strings.HasSuffix(mt, "+json") {
+		return
+	}
+
+	w.errBody = append(w.errBody, b...)
+	if json.Valid(w.errBody) {
+		w.SentErr = ParseHTTPError(w.SentStatus, w.errBody)
+	}
+}
+
+// capture appends b to the captured body, up to CaptureLimit bytes.
+func (w *ResponseWriter) capture(b []byte) {
+	if w.CaptureLimit <= 0 {
+		return
+	}
+	if left := w.CaptureLimit - int64(len(w.captured)); int64(len(b)) > left {
+		b = b[:max(left, 0)]
+		w.truncated = true
+	}
+	w.captured = append(w.captured, b...)
+}
+
+// Captured returns the captured body and whether it was
+// truncated because it exceeded the CaptureLimit.
+func (w ResponseWriter) Captured() ([]byte, bool) {
+	return w.captured, w.truncated
+}
+
+// Written returns true if the response headers or body
+// have already been written to the client.
+func (w ResponseWriter) Written() bool {
+	return w.written
+}
+
+// Unwrap returns the original writer, it is
+// used by [http.ResponseController].
+func (w *ResponseWriter) Unwrap() http.ResponseWriter {
+	return w.Original
+}
+
+// Flush sends the buffered data to the client, see [http.Flusher].
+func (w *ResponseWriter) Flush() {
+	w.FlushError()
+}
+
+// FlushError sends the buffered data to the client, it returns an
+// error if the original writer doesn't support flushing.
+func (w *ResponseWriter) FlushError() error {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	return http.NewResponseController(w.Original).Flush()
+}
+
+// Wrap returns w as an http.ResponseWriter that implements the
+// http.Hijacker, http.Pusher and io.ReaderFrom interfaces only when
+// the original writer implements them, so the type assertions of
+// the next handlers hold. The returned writer is the one passed to
+// the next handlers, see [GetResponseWriter].
+func (w *ResponseWriter) Wrap() http.ResponseWriter {
+	_, hijacker := w.Original.(http.Hijacker)
+	_, pusher := w.Original.(http.Pusher)
+	_, readerFrom := w.Original.(io.ReaderFrom)
+	h, p, rf := responseHijacker{w}, responsePusher{w}, responseReaderFrom{w}
+
+	switch {
+	case hijacker && pusher && readerFrom:
+		return struct {
+			*ResponseWriter
+			responseHijacker
+			responsePusher
+			responseReaderFrom
+		}{w, h, p, rf}
+	case hijacker && pusher:
+		return struct {
+			*ResponseWriter
+			responseHijacker
+			responsePusher
+		}{w, h, p}
+	case hijacker && readerFrom:
+		return struct {
+			*ResponseWriter
+			responseHijacker
+			responseReaderFrom
+		}{w, h, rf}
+	case pusher && readerFrom:
+		return struct {
+			*ResponseWriter
+			responsePusher
+			responseReaderFrom
+		}{w, p, rf}
+	case hijacker:
+		return struct {
+			*ResponseWriter
+			responseHijacker
+		}{w, h}
+	case pusher:
+		return struct {
+			*ResponseWriter
+			responsePusher
+		}{w, p}
+	case readerFrom:
+		return struct {
+			*ResponseWriter
+			responseReaderFrom
+		}{w, rf}
+	}
+
+	return w
+}
+
+// GetResponseWriter returns the ResponseWriter of w, when w is
+// a ResponseWriter or was returned by [ResponseWriter.Wrap].
+func GetResponseWriter(w http.ResponseWriter) (*ResponseWriter, bool) {
+	rw, ok := w.(interface{ responseWriter() *ResponseWriter })
+	if !ok {
+		return nil, false
+	}
+
+	return rw.responseWriter(), true
+}
+
+func (w *ResponseWriter) responseWriter() *ResponseWriter {
+	return w
+}
+
+// responseHijacker implements http.Hijacker for the
+// writers returned by Wrap.
+type responseHijacker struct{ w *ResponseWriter }
+
+// Hijack lets the caller take over the connection, see [http.Hijacker].
+func (h responseHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := h.w.Original.(http.Hijacker).Hijack()
+	if err == nil && !h.w.written {
+		h.w.written = true
+		h.w.SentStatus = http.StatusSwitchingProtocols
+	}
+
+	return conn, rw, err
+}
+
+// responsePusher implements http.Pusher for the
+// writers returned by Wrap.
+type responsePusher struct{ w *ResponseWriter }
+
+// Push initiates an HTTP/2 server push, see [http.Pusher].
+func (p responsePusher) Push(target string, opts *http.PushOptions) error {
+	return p.w.Original.(http.Pusher).Push(target, opts)
+}
+
+// responseReaderFrom implements io.ReaderFrom for the
+// writers returned by Wrap.
+type responseReaderFrom struct{ w *ResponseWriter }
+
+// ReadFrom writes the data read from src, see [io.ReaderFrom]. The
+// original writer reads it (i.e using sendfile) unless the body has
+// to be captured or parsed as an error.
+func (rf responseReaderFrom) ReadFrom(src io.Reader) (int64, error) {
+	w := rf.w
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.CaptureLimit > 0 || w.SentStatus >= 400 {
+		// ResponseWriter doesn't implement io.ReaderFrom, so
+		// the data is written through its Write method.
+		return io.Copy(w, src)
+	}
+
+	n, err := w.Original.(io.ReaderFrom).ReadFrom(src)
+	w.SentBytes += n
+
+	return n, err
+}
+
+// WriteHTTPError writes err as a JSON response. It sets
+// the trace headers found in ctx, the "application/json"
+// content type and uses the error status code.
+func WriteHTTPError(ctx context.Context, w http.ResponseWriter, err *errors.HTTPError) {
+	t := trace.GetFromContext(ctx)
+	t.SetHTTPHeaders(w.Header())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(err.StatusCode)
+	w.Write(err.JSON())
+}
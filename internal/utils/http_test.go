@@ -0,0 +1,176 @@
+package utils
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/iolave/go-errors"
+)
+
+func TestResponseWriter(t *testing.T) {
+	type TestCase struct {
+		Name        string
+		Handler     func(w http.ResponseWriter)
+		WantStatus  int
+		WantErrName string
+	}
+
+	testCases := []TestCase{}
+	testCases = append(testCases, TestCase{
+		Name:       "implicit status should be 200",
+		Handler:    func(w http.ResponseWriter) { w.Write([]byte("hello")) },
+		WantStatus: http.StatusOK,
+	})
+	testCases = append(testCases, TestCase{
+		Name: "redirects should not be errors",
+		Handler: func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusFound)
+			w.Write([]byte("found"))
+		},
+		WantStatus: http.StatusFound,
+	})
+	testCases = append(testCases, TestCase{
+		Name: "informational responses should be followed by the final status",
+		Handler: func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusEarlyHints)
+			w.WriteHeader(http.StatusCreated)
+		},
+		WantStatus: http.StatusCreated,
+	})
+	testCases = append(testCases, TestCase{
+		Name: "json error bodies should be parsed",
+		Handler: func(w http.ResponseWriter) {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"statusCode":404,`))
+			w.Write([]byte(`"name":"user_not_found","message":"not found"}`))
+		},
+		WantStatus:  http.StatusNotFound,
+		WantErrName: "user_not_found",
+	})
+	testCases = append(testCases, TestCase{
+		Name: "non json error bodies should not be parsed",
+		Handler: func(w http.ResponseWriter) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte(`{"name":"user_not_found"}`))
+		},
+		WantStatus:  http.StatusBadGateway,
+		WantErrName: "bad_gateway_error",
+	})
+	testCases = append(testCases, TestCase{
+		Name: "error statuses without body should be errors",
+		Handler: func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusInternalServerError)
+		},
+		WantStatus:  http.StatusInternalServerError,
+		WantErrName: "internal_server_error_error",
+	})
+	testCases = append(testCases, TestCase{
+		Name: "superfluous statuses should be ignored",
+		Handler: func(w http.ResponseWriter) {
+			w.Write([]byte("hello"))
+			w.WriteHeader(http.StatusInternalServerError)
+		},
+		WantStatus: http.StatusOK,
+	})
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			w := &ResponseWriter{Original: httptest.NewRecorder()}
+			tc.Handler(w)
+
+			if w.SentStatus != tc.WantStatus {
+				t.Errorf("got status %d, want %d", w.SentStatus, tc.WantStatus)
+			}
+			if tc.WantErrName == "" {
+				if w.SentErr != nil {
+					t.Errorf("got error %v, want none", w.SentErr)
+				}
+				return
+			}
+			err, ok := w.SentErr.(*errors.HTTPError)
+			if !ok || err.Name != tc.WantErrName {
+				t.Errorf("got error %v, want %s", w.SentErr, tc.WantErrName)
+			}
+		})
+	}
+}
+
+func TestResponseWriterInterfaces(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := &ResponseWriter{Original: rec}
+
+	// Flushing writes the implicit status.
+	if err := http.NewResponseController(w).Flush(); err != nil {
+		t.Fatalf("got flush error %v", err)
+	}
+	if !rec.Flushed || w.SentStatus != http.StatusOK {
+		t.Errorf("got flushed %v with status %d, want flushed with 200", rec.Flushed, w.SentStatus)
+	}
+
+	// The recorder can't be hijacked, pushed nor read from.
+	wrapped := w.Wrap()
+	if _, ok := wrapped.(http.Hijacker); ok {
+		t.Errorf("got an http.Hijacker, want none")
+	}
+	if _, ok := wrapped.(http.Pusher); ok {
+		t.Errorf("got an http.Pusher, want none")
+	}
+	if _, ok := wrapped.(io.ReaderFrom); ok {
+		t.Errorf("got an io.ReaderFrom, want none")
+	}
+	if got, ok := GetResponseWriter(wrapped); !ok || got != w {
+		t.Errorf("got response writer %p, want %p", got, w)
+	}
+}
+
+func TestResponseWriterWrap(t *testing.T) {
+	orig := &fullResponseWriter{ResponseRecorder: httptest.NewRecorder()}
+	w := &ResponseWriter{Original: orig}
+	wrapped := w.Wrap()
+
+	if _, _, err := wrapped.(http.Hijacker).Hijack(); err != nil {
+		t.Errorf("got hijack error %v", err)
+	}
+	if w.SentStatus != http.StatusSwitchingProtocols {
+		t.Errorf("got status %d, want %d", w.SentStatus, http.StatusSwitchingProtocols)
+	}
+	if err := wrapped.(http.Pusher).Push("/", nil); err != nil || !orig.pushed {
+		t.Errorf("got push error %v, pushed %v", err, orig.pushed)
+	}
+	n, err := wrapped.(io.ReaderFrom).ReadFrom(strings.NewReader("body"))
+	if err != nil || n != 4 || !orig.readFrom || w.SentBytes != 4 {
+		t.Errorf("got %d bytes (%d sent) and error %v, read from %v", n, w.SentBytes, err, orig.readFrom)
+	}
+	if got, ok := GetResponseWriter(wrapped); !ok || got != w {
+		t.Errorf("got response writer %p, want %p", got, w)
+	}
+}
+
+// fullResponseWriter is an http.ResponseWriter that implements
+// the http.Hijacker, http.Pusher and io.ReaderFrom interfaces.
+type fullResponseWriter struct {
+	*httptest.ResponseRecorder
+	pushed   bool
+	readFrom bool
+}
+
+func (w *fullResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, nil
+}
+
+func (w *fullResponseWriter) Push(target string, opts *http.PushOptions) error {
+	w.pushed = true
+	return nil
+}
+
+func (w *fullResponseWriter) ReadFrom(src io.Reader) (int64, error) {
+	w.readFrom = true
+	return io.Copy(w.ResponseRecorder, src)
+}
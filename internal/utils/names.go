@@ -0,0 +1,25 @@
+package utils
+
+import "unicode"
+
+// ExportName converts s into an upper camel case name by removing
+// every non letter nor digit character (i.e "user-id" becomes "UserId").
+// It is shared by the OpenAPI document and the generated clients, so
+// their operation and type names match.
+func ExportName(s string) string {
+	name := []rune{}
+	upper := true
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		name = append(name, r)
+	}
+
+	return string(name)
+}
@@ -0,0 +1,11 @@
+package utils
+
+import "reflect"
+
+// InTyper is implemented by the route handlers that know the type
+// of their request (the `In` type parameter of the AppRequest), so
+// middlewares can inspect it without importing the router package.
+type InTyper interface {
+	// InType returns the request type, or nil if it is unknown.
+	InType() reflect.Type
+}
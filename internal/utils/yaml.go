@@ -0,0 +1,173 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// yamlPlainKey matches the mapping keys that can be written
+// without quotes.
+var yamlPlainKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_\-]*$`)
+
+// yamlNode is a decoded json value that keeps the order
+// of the object keys.
+type yamlNode struct {
+	// scalar is the yaml representation of a scalar value,
+	// it is only used when both keys and items are nil.
+	scalar string
+	keys   []string
+	values []*yamlNode
+	items  []*yamlNode
+	isMap  bool
+	isSeq  bool
+}
+
+// MarshalYAML returns the YAML encoding of v. The value is first
+// encoded as JSON, so `json` tags and [json.Marshaler] implementations
+// are honored and the order of the struct fields is kept.
+//
+// Strings are always double quoted, so the output is compatible with
+// any YAML 1.2 parser.
+func MarshalYAML(v any) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	node, err := decodeYAMLNode(dec)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	switch {
+	case node.isMap && len(node.keys) > 0:
+		writeYAMLMap(buf, node, 0)
+	case node.isSeq && len(node.items) > 0:
+		writeYAMLSeq(buf, node, 0)
+	default:
+		buf.WriteString(yamlScalar(node))
+		buf.WriteString("\n")
+	}
+
+	return buf.Bytes(), nil
+}
+
+// decodeYAMLNode decodes the next json value from dec.
+func decodeYAMLNode(dec *json.Decoder) (*yamlNode, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := tok.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			node := &yamlNode{isMap: true}
+			for dec.More() {
+				keyTok, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				v, err := decodeYAMLNode(dec)
+				if err != nil {
+					return nil, err
+				}
+				node.keys = append(node.keys, keyTok.(string))
+				node.values = append(node.values, v)
+			}
+			_, err := dec.Token()
+			return node, err
+		case '[':
+			node := &yamlNode{isSeq: true}
+			for dec.More() {
+				v, err := decodeYAMLNode(dec)
+				if err != nil {
+					return nil, err
+				}
+				node.items = append(node.items, v)
+			}
+			_, err := dec.Token()
+			return node, err
+		}
+	case string:
+		return &yamlNode{scalar: strconv.Quote(t)}, nil
+	case json.Number:
+		return &yamlNode{scalar: t.String()}, nil
+	case bool:
+		return &yamlNode{scalar: strconv.FormatBool(t)}, nil
+	case nil:
+		return &yamlNode{scalar: "null"}, nil
+	}
+
+	return nil, fmt.Errorf("unexpected json token %v", tok)
+}
+
+// yamlScalar returns the inline representation of node, which
+// is only possible for scalars and empty collections.
+func yamlScalar(node *yamlNode) string {
+	switch {
+	case node.isMap:
+		return "{}"
+	case node.isSeq:
+		return "[]"
+	default:
+		return node.scalar
+	}
+}
+
+// isYAMLBlock returns true if node has to be written as a
+// block (non empty map or sequence).
+func isYAMLBlock(node *yamlNode) bool {
+	return (node.isMap && len(node.keys) > 0) || (node.isSeq && len(node.items) > 0)
+}
+
+func writeYAMLMap(w io.Writer, node *yamlNode, indent int) {
+	prefix := strings.Repeat(" ", indent)
+	for i, k := range node.keys {
+		if !yamlPlainKey.MatchString(k) {
+			k = strconv.Quote(k)
+		}
+		v := node.values[i]
+		if !isYAMLBlock(v) {
+			fmt.Fprintf(w, "%s%s: %s\n", prefix, k, yamlScalar(v))
+			continue
+		}
+
+		fmt.Fprintf(w, "%s%s:\n", prefix, k)
+		if v.isMap {
+			writeYAMLMap(w, v, indent+2)
+		} else {
+			writeYAMLSeq(w, v, indent)
+		}
+	}
+}
+
+func writeYAMLSeq(w io.Writer, node *yamlNode, indent int) {
+	prefix := strings.Repeat(" ", indent)
+	for _, item := range node.items {
+		if !isYAMLBlock(item) {
+			fmt.Fprintf(w, "%s- %s\n", prefix, yamlScalar(item))
+			continue
+		}
+
+		// Writes the nested block indented and replaces the
+		// first indentation with the sequence dash.
+		buf := &bytes.Buffer{}
+		if item.isMap {
+			writeYAMLMap(buf, item, indent+2)
+		} else {
+			writeYAMLSeq(buf, item, indent+2)
+		}
+		b := buf.Bytes()
+		fmt.Fprintf(w, "%s- %s", prefix, b[indent+2:])
+	}
+}
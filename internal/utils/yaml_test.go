@@ -0,0 +1,69 @@
+package utils
+
+import "testing"
+
+func TestMarshalYAML(t *testing.T) {
+	type TestCase struct {
+		Name string
+		In   any
+		Want string
+	}
+
+	type Item struct {
+		Name string   `json:"name"`
+		Tags []string `json:"tags"`
+	}
+
+	testCases := []TestCase{}
+	testCases = append(testCases, TestCase{
+		Name: "marshal scalar",
+		In:   "test",
+		Want: "\"test\"\n",
+	})
+	testCases = append(testCases, TestCase{
+		Name: "marshal empty collections",
+		In: map[string]any{
+			"map":   map[string]any{},
+			"slice": []any{},
+		},
+		Want: "map: {}\nslice: []\n",
+	})
+	testCases = append(testCases, TestCase{
+		Name: "marshal struct keeping field order",
+		In: struct {
+			Z    int            `json:"z"`
+			A    bool           `json:"a"`
+			Path map[string]any `json:"paths"`
+		}{
+			Z:    1,
+			A:    true,
+			Path: map[string]any{"/users/{id}": nil},
+		},
+		Want: "z: 1\na: true\npaths:\n  \"/users/{id}\": null\n",
+	})
+	testCases = append(testCases, TestCase{
+		Name: "marshal sequence of maps",
+		In: []Item{
+			{Name: "a", Tags: []string{"x", "y"}},
+			{Name: "b", Tags: []string{}},
+		},
+		Want: "- name: \"a\"\n  tags:\n  - \"x\"\n  - \"y\"\n- name: \"b\"\n  tags: []\n",
+	})
+	testCases = append(testCases, TestCase{
+		Name: "marshal nested sequences",
+		In:   [][]int{{1, 2}, {3}},
+		Want: "- - 1\n  - 2\n- - 3\n",
+	})
+
+	for _, tt := range testCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			b, err := MarshalYAML(tt.In)
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+			if string(b) != tt.Want {
+				t.Errorf("got %q, want %q", string(b), tt.Want)
+			}
+		})
+	}
+}
@@ -0,0 +1,632 @@
+package betsi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iolave/go-betsi/internal/utils"
+	"github.com/iolave/go-errors"
+)
+
+// OpenAPIVersion is the version of the OpenAPI specification
+// implemented by the generated documents.
+const OpenAPIVersion = "3.1.0"
+
+// openAPIErrorSchemaName is the name of the components schema
+// used for every error response.
+const openAPIErrorSchemaName = "HTTPError"
+
+// OpenAPIConfig is the configuration used to generate an
+// OpenAPI document from the routes of a Router.
+type OpenAPIConfig struct {
+	// Info is the metadata about the API.
+	Info OpenAPIInfo
+
+	// Servers are the base urls of the API (i.e
+	// "https://api.example.com").
+	Servers []string
+}
+
+// OpenAPIDocument is an OpenAPI 3.1 document.
+type OpenAPIDocument struct {
+	OpenAPI    string                     `json:"openapi"`
+	Info       OpenAPIInfo                `json:"info"`
+	Servers    []OpenAPIServer            `json:"servers,omitempty"`
+	Paths      map[string]OpenAPIPathItem `json:"paths"`
+	Components OpenAPIComponents          `json:"components"`
+}
+
+// OpenAPIInfo is the metadata about the API.
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// OpenAPIServer is a server that hosts the API.
+type OpenAPIServer struct {
+	URL string `json:"url"`
+}
+
+// OpenAPIPathItem holds the operations of a single path,
+// keyed by lower cased http method.
+type OpenAPIPathItem map[string]*OpenAPIOperation
+
+// OpenAPIOperation describes a single API operation on a path.
+type OpenAPIOperation struct {
+	OperationID string                     `json:"operationId"`
+	Summary     string                     `json:"summary,omitempty"`
+	Description string                     `json:"description,omitempty"`
+	Tags        []string                   `json:"tags,omitempty"`
+	Parameters  []OpenAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]OpenAPIResponse `json:"responses"`
+}
+
+// OpenAPIParameter describes a single operation parameter.
+type OpenAPIParameter struct {
+	Name     string      `json:"name"`
+	In       string      `json:"in"`
+	Required bool        `json:"required"`
+	Schema   *JSONSchema `json:"schema"`
+}
+
+// OpenAPIRequestBody describes a request body.
+type OpenAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]OpenAPIMediaType `json:"content"`
+}
+
+// OpenAPIResponse describes a single response of an operation.
+type OpenAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]OpenAPIMediaType `json:"content,omitempty"`
+}
+
+// OpenAPIMediaType holds the schema of a media type.
+type OpenAPIMediaType struct {
+	Schema *JSONSchema `json:"schema"`
+}
+
+// OpenAPIComponents holds the reusable schemas of the document.
+type OpenAPIComponents struct {
+	Schemas map[string]*JSONSchema `json:"schemas"`
+}
+
+// JSONSchema is the subset of the JSON Schema (draft 2020-12)
+// used by the OpenAPI documents.
+type JSONSchema struct {
+	Ref                  string                 `json:"$ref,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+	Enum                 []any                  `json:"enum,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	AdditionalProperties *JSONSchema            `json:"additionalProperties,omitempty"`
+	Minimum              *float64               `json:"minimum,omitempty"`
+	Maximum              *float64               `json:"maximum,omitempty"`
+	ExclusiveMinimum     *float64               `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum     *float64               `json:"exclusiveMaximum,omitempty"`
+	MinLength            *int                   `json:"minLength,omitempty"`
+	MaxLength            *int                   `json:"maxLength,omitempty"`
+	MinItems             *int                   `json:"minItems,omitempty"`
+	MaxItems             *int                   `json:"maxItems,omitempty"`
+}
+
+// OpenAPI generates an OpenAPI 3.1 document from the routes
+// registered within the router (see [Router.Routes]).
+//
+// Routes registered with the typed helpers (i.e [Get]) are fully
+// documented from their `In` and `Out` types:
+//
+//   - `ar:"path=*"` fields are documented as path parameters.
+//   - `ar:"body=json"` fields are documented as the json request body.
+//   - `Out` is documented as the json body of the 200 response.
+//   - `json` tags determine the property names and `validate` tags are
+//     translated into JSON Schema keywords (i.e `validate:"required,min=1"`).
+//   - Named structs are documented within the components schemas.
+//
+// Routes registered with untyped handlers (i.e [Router.Get]) are
+// documented with their path parameters and empty body schemas.
+// Hidden routes (see [WithHidden]) are not documented.
+//
+// Every operation documents the [github.com/iolave/go-errors.HTTPError]
+// structure as its default (error) response.
+func (r Router) OpenAPI(cfg OpenAPIConfig) *OpenAPIDocument {
+	doc := &OpenAPIDocument{
+		OpenAPI: OpenAPIVersion,
+		Info:    cfg.Info,
+		Paths:   map[string]OpenAPIPathItem{},
+		Components: OpenAPIComponents{
+			Schemas: map[string]*JSONSchema{},
+		},
+	}
+	for _, url := range cfg.Servers {
+		doc.Servers = append(doc.Servers, OpenAPIServer{URL: url})
+	}
+
+	g := &schemaGenerator{
+		schemas: doc.Components.Schemas,
+		names:   map[reflect.Type]string{},
+	}
+	doc.Components.Schemas[openAPIErrorSchemaName] = httpErrorSchema()
+
+	for _, route := range r.Routes() {
+		if route.Meta.Hidden {
+			continue
+		}
+
+		path, params := openAPIPath(route.Pattern)
+		item, ok := doc.Paths[path]
+		if !ok {
+			item = OpenAPIPathItem{}
+			doc.Paths[path] = item
+		}
+
+		op := &OpenAPIOperation{
+			OperationID: route.Meta.OperationID,
+			Summary:     route.Meta.Summary,
+			Description: route.Meta.Description,
+			Tags:        route.Meta.Tags,
+			Parameters:  params,
+			Responses: map[string]OpenAPIResponse{
+				"default": {
+					Description: "Error response",
+					Content: map[string]OpenAPIMediaType{
+						"application/json": {Schema: &JSONSchema{
+							Ref: "#/components/schemas/" + openAPIErrorSchemaName,
+						}},
+					},
+				},
+			},
+		}
+		if op.OperationID == "" {
+			op.OperationID = openAPIOperationID(route.Method, route.Pattern)
+		}
+
+		if in := route.Meta.In; in != nil && in.Kind() == reflect.Struct {
+			g.documentIn(op, in)
+		}
+
+		out := &JSONSchema{}
+		if route.Meta.Out != nil {
+			out = g.schema(route.Meta.Out, "")
+		}
+		op.Responses[strconv.Itoa(http.StatusOK)] = OpenAPIResponse{
+			Description: http.StatusText(http.StatusOK),
+			Content: map[string]OpenAPIMediaType{
+				"application/json": {Schema: out},
+			},
+		}
+
+		item[strings.ToLower(route.Method)] = op
+	}
+
+	return doc
+}
+
+// OpenAPIHandler returns a Handler that serves the OpenAPI
+// document of the router (see [Router.OpenAPI]). The document is
+// generated on the first request, so routes registered after calling
+// OpenAPIHandler are documented as well.
+//
+// The document is served as JSON, unless the "format" query param is
+// "yaml", the request path ends with ".yaml" or ".yml" or the Accept
+// header asks for yaml.
+//
+// Example:
+//
+//	r.Get("/openapi.json", r.OpenAPIHandler(cfg))
+func (r Router) OpenAPIHandler(cfg OpenAPIConfig) Handler[any, any] {
+	var once sync.Once
+	var jsonDoc, yamlDoc []byte
+	var err error
+
+	return func(ar AppRequest[any, any]) {
+		w, req := ar.w, ar.Req
+		once.Do(func() {
+			doc := r.OpenAPI(cfg)
+			if jsonDoc, err = json.Marshal(doc); err != nil {
+				return
+			}
+			yamlDoc, err = utils.MarshalYAML(doc)
+		})
+		if err != nil {
+			utils.WriteHTTPError(req.Context(), w, errors.NewInternalServerError(
+				ERR_OPENAPI_MARSHAL,
+				err,
+			).(*errors.HTTPError))
+			return
+		}
+
+		if wantsYAML(req) {
+			w.Header().Set("Content-Type", "application/yaml")
+			w.WriteHeader(http.StatusOK)
+			w.Write(yamlDoc)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonDoc)
+	}
+}
+
+// httpErrorSchema returns the schema of the
+// [github.com/iolave/go-errors.HTTPError] json
+// representation.
+func httpErrorSchema() *JSONSchema {
+	return &JSONSchema{
+		Type: "object",
+		Properties: map[string]*JSONSchema{
+			"statusCode": {Type: "integer", Format: "int64"},
+			"name":       {Type: "string"},
+			"message":    {Type: "string"},
+			"error":      {},
+		},
+		Required: []string{"message", "name", "statusCode"},
+	}
+}
+
+// wantsYAML returns true if the request asks for a yaml response.
+func wantsYAML(r *http.Request) bool {
+	if r.URL.Query().Get("format") == "yaml" {
+		return true
+	}
+	if strings.HasSuffix(r.URL.Path, ".yaml") || strings.HasSuffix(r.URL.Path, ".yml") {
+		return true
+	}
+
+	return strings.Contains(r.Header.Get("Accept"), "yaml")
+}
+
+// openAPIPath converts a chi pattern into an OpenAPI path and returns
+// the path parameters found within it. Regexp placeholders (i.e
+// "{id:[0-9]+}") are documented as a string parameter with a pattern.
+func openAPIPath(pattern string) (string, []OpenAPIParameter) {
+	params := []OpenAPIParameter{}
+	for _, p := range parsePatternParams(pattern) {
+		pattern = strings.Replace(pattern, p.Placeholder, "{"+p.Name+"}", 1)
+		schema := &JSONSchema{Type: "string"}
+		if p.Regexp != "" {
+			schema.Pattern = "^" + p.Regexp + "$"
+		}
+		params = append(params, OpenAPIParameter{
+			Name:     p.Name,
+			In:       "path",
+			Required: true,
+			Schema:   schema,
+		})
+	}
+
+	return pattern, params
+}
+
+// openAPIOperationID generates an operation id from the route method
+// and pattern (i.e "GET /users/{id}/posts" becomes "getUsersByIdPosts").
+func openAPIOperationID(method, pattern string) string {
+	id := strings.ToLower(method)
+	path, _ := openAPIPath(pattern)
+	for seg := range strings.SplitSeq(path, "/") {
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			id += "By" + utils.ExportName(seg[1:len(seg)-1])
+			continue
+		}
+		id += utils.ExportName(seg)
+	}
+
+	return id
+}
+
+// schemaGenerator generates JSON schemas from go types, named
+// structs are stored within `schemas` and referenced by name.
+type schemaGenerator struct {
+	schemas map[string]*JSONSchema
+	names   map[reflect.Type]string
+}
+
+// documentIn documents the `ar` tagged fields of the `in` struct
+// as the operation parameters and request body.
+func (g *schemaGenerator) documentIn(op *OpenAPIOperation, in reflect.Type) {
+	for i := range in.NumField() {
+		f := in.Field(i)
+		for tag := range strings.SplitSeq(f.Tag.Get("ar"), ",") {
+			k, v, _ := strings.Cut(tag, "=")
+			switch k {
+			case "path":
+				for i := range op.Parameters {
+					if op.Parameters[i].Name != v {
+						continue
+					}
+					schema := g.schema(f.Type, f.Tag.Get("validate"))
+					if op.Parameters[i].Schema.Pattern != "" {
+						schema.Pattern = op.Parameters[i].Schema.Pattern
+					}
+					op.Parameters[i].Schema = schema
+				}
+			case "body":
+				if v != "json" {
+					continue
+				}
+				op.RequestBody = &OpenAPIRequestBody{
+					Required: true,
+					Content: map[string]OpenAPIMediaType{
+						"application/json": {Schema: g.schema(f.Type, f.Tag.Get("validate"))},
+					},
+				}
+			}
+		}
+	}
+}
+
+// schema returns the JSON schema of t, where `validate` is the
+// go-playground/validator tag of the field holding t (if any).
+func (g *schemaGenerator) schema(t reflect.Type, validate string) *JSONSchema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	var s *JSONSchema
+	switch {
+	case t == reflect.TypeFor[time.Time]():
+		s = &JSONSchema{Type: "string", Format: "date-time"}
+	case t == reflect.TypeFor[json.RawMessage]():
+		s = &JSONSchema{}
+	case t.Kind() == reflect.Struct && t.Name() != "":
+		s = &JSONSchema{Ref: "#/components/schemas/" + g.structName(t)}
+	case t.Kind() == reflect.Struct:
+		s = g.structSchema(t)
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		s = &JSONSchema{Type: "string", Format: "byte"}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		s = &JSONSchema{Type: "array", Items: g.schema(t.Elem(), diveRules(validate))}
+	case t.Kind() == reflect.Map:
+		s = &JSONSchema{Type: "object", AdditionalProperties: g.schema(t.Elem(), diveRules(validate))}
+	case t.Kind() == reflect.Bool:
+		s = &JSONSchema{Type: "boolean"}
+	case t.Kind() == reflect.String:
+		s = &JSONSchema{Type: "string"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Int32,
+		t.Kind() >= reflect.Uint && t.Kind() <= reflect.Uint32:
+		s = &JSONSchema{Type: "integer", Format: "int32"}
+		if t.Kind() == reflect.Int || t.Kind() == reflect.Uint {
+			s.Format = "int64"
+		}
+	case t.Kind() == reflect.Int64 || t.Kind() == reflect.Uint64:
+		s = &JSONSchema{Type: "integer", Format: "int64"}
+	case t.Kind() == reflect.Float32:
+		s = &JSONSchema{Type: "number", Format: "float"}
+	case t.Kind() == reflect.Float64:
+		s = &JSONSchema{Type: "number", Format: "double"}
+	default:
+		s = &JSONSchema{}
+	}
+
+	applyValidateRules(s, validate)
+	return s
+}
+
+// structName returns the components schema name of the named struct t,
+// generating its schema if it hasn't been generated yet. Names are
+// prefixed with the package name when two types share the same name.
+func (g *schemaGenerator) structName(t reflect.Type) string {
+	if name, ok := g.names[t]; ok {
+		return name
+	}
+
+	name := utils.ExportName(t.Name())
+	if _, taken := g.schemas[name]; taken {
+		pkg := t.PkgPath()
+		name = utils.ExportName(pkg[strings.LastIndex(pkg, "/")+1:]) + name
+	}
+	for i := 2; ; i++ {
+		if _, taken := g.schemas[name]; !taken {
+			break
+		}
+		name = fmt.Sprintf("%s%d", utils.ExportName(t.Name()), i)
+	}
+
+	// Registers the name before generating the schema, so
+	// recursive types reference themselves.
+	g.names[t] = name
+	g.schemas[name] = &JSONSchema{}
+	*g.schemas[name] = *g.structSchema(t)
+
+	return name
+}
+
+// structSchema returns the object schema of the struct t following
+// the encoding/json rules for field names and embedded structs.
+func (g *schemaGenerator) structSchema(t reflect.Type) *JSONSchema {
+	s := &JSONSchema{
+		Type:       "object",
+		Properties: map[string]*JSONSchema{},
+	}
+
+	g.addStructProperties(s, t)
+	if len(s.Properties) == 0 {
+		s.Properties = nil
+	}
+	sort.Strings(s.Required)
+
+	return s
+}
+
+func (g *schemaGenerator) addStructProperties(s *JSONSchema, t reflect.Type) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+
+		ft := f.Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			g.addStructProperties(s, ft)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		validate := f.Tag.Get("validate")
+		s.Properties[name] = g.schema(f.Type, validate)
+		if hasValidateRule(validate, "required") {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// diveRules returns the validate rules that apply to the elements of
+// a slice or map (the ones after the "dive" rule).
+func diveRules(validate string) string {
+	_, after, found := strings.Cut(validate, "dive")
+	if !found {
+		return ""
+	}
+
+	return strings.TrimPrefix(after, ",")
+}
+
+// hasValidateRule returns true if the validate tag (before any "dive"
+// rule) contains the rule.
+func hasValidateRule(validate, rule string) bool {
+	validate, _, _ = strings.Cut(validate, "dive")
+	for r := range strings.SplitSeq(validate, ",") {
+		if r == rule {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validateFormats maps the go-playground/validator format rules to
+// the JSON Schema formats.
+var validateFormats = map[string]string{
+	"email":    "email",
+	"url":      "uri",
+	"uri":      "uri",
+	"uuid":     "uuid",
+	"uuid4":    "uuid",
+	"ipv4":     "ipv4",
+	"ipv6":     "ipv6",
+	"hostname": "hostname",
+	"datetime": "date-time",
+}
+
+// validatePatterns maps the go-playground/validator character rules
+// to JSON Schema patterns.
+var validatePatterns = map[string]string{
+	"alpha":    "^[a-zA-Z]+$",
+	"alphanum": "^[a-zA-Z0-9]+$",
+	"numeric":  "^[-+]?[0-9]+(?:\\.[0-9]+)?$",
+}
+
+// applyValidateRules translates the go-playground/validator rules
+// (before any "dive" rule) into JSON Schema keywords of s. Length
+// rules are applied to strings, arrays and objects and value rules
+// to numbers. Rules without a JSON Schema equivalent are ignored.
+func applyValidateRules(s *JSONSchema, validate string) {
+	validate, _, _ = strings.Cut(validate, "dive")
+	if validate == "" || s.Ref != "" {
+		return
+	}
+
+	for rule := range strings.SplitSeq(validate, ",") {
+		k, v, _ := strings.Cut(rule, "=")
+		if format, ok := validateFormats[k]; ok && s.Type == "string" {
+			s.Format = format
+			continue
+		}
+		if pattern, ok := validatePatterns[k]; ok && s.Type == "string" {
+			s.Pattern = pattern
+			continue
+		}
+
+		switch k {
+		case "oneof":
+			for o := range strings.FieldsSeq(v) {
+				if s.Type == "integer" || s.Type == "number" {
+					if n, err := strconv.ParseFloat(o, 64); err == nil {
+						s.Enum = append(s.Enum, n)
+						continue
+					}
+				}
+				s.Enum = append(s.Enum, o)
+			}
+		case "regexp":
+			if _, err := regexp.Compile(v); err == nil {
+				s.Pattern = v
+			}
+		case "len", "min", "max", "gt", "gte", "lt", "lte":
+			n, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			applyValidateBound(s, k, n)
+		}
+	}
+}
+
+// applyValidateBound applies a go-playground/validator bound rule (len,
+// min, max, gt, gte, lt, lte) with value n to s.
+func applyValidateBound(s *JSONSchema, rule string, n float64) {
+	if s.Type == "integer" || s.Type == "number" {
+		switch rule {
+		case "len":
+			s.Minimum, s.Maximum = &n, &n
+		case "min", "gte":
+			s.Minimum = &n
+		case "max", "lte":
+			s.Maximum = &n
+		case "gt":
+			s.ExclusiveMinimum = &n
+		case "lt":
+			s.ExclusiveMaximum = &n
+		}
+		return
+	}
+
+	var minimum, maximum **int
+	switch s.Type {
+	case "string":
+		minimum, maximum = &s.MinLength, &s.MaxLength
+	case "array":
+		minimum, maximum = &s.MinItems, &s.MaxItems
+	default:
+		return
+	}
+
+	i := int(n)
+	switch rule {
+	case "len":
+		*minimum, *maximum = &i, &i
+	case "min", "gte":
+		*minimum = &i
+	case "max", "lte":
+		*maximum = &i
+	case "gt":
+		i++
+		*minimum = &i
+	case "lt":
+		i--
+		*maximum = &i
+	}
+}
@@ -0,0 +1,133 @@
+package betsi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type openAPITestUser struct {
+	ID     string            `json:"id" validate:"required,uuid"`
+	Name   string            `json:"name" validate:"required,min=1,max=64"`
+	Age    int               `json:"age,omitempty" validate:"gte=0,lt=150"`
+	Role   string            `json:"role" validate:"oneof=admin user"`
+	Emails []string          `json:"emails" validate:"max=3,dive,email"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Friend *openAPITestUser  `json:"friend,omitempty"`
+}
+
+type openAPITestUpdateUserRequest struct {
+	ID   string          `ar:"path=id"`
+	Body openAPITestUser `ar:"body=json"`
+}
+
+func TestRouterOpenAPI(t *testing.T) {
+	r := NewRouter()
+	Put(r, "/users/{id:[0-9]+}", func(ar AppRequest[openAPITestUpdateUserRequest, openAPITestUser]) {},
+		WithSummary("Update a user"),
+		WithTags("users"),
+	)
+	r.Get("/health", Handler[any, any](func(ar AppRequest[any, any]) {}))
+
+	doc := r.OpenAPI(OpenAPIConfig{Info: OpenAPIInfo{Title: "test", Version: "1.0.0"}})
+
+	op := doc.Paths["/users/{id}"]["put"]
+	if op == nil {
+		t.Fatalf("put /users/{id} operation not found: %v", doc.Paths)
+	}
+	if op.OperationID != "putUsersById" || op.Summary != "Update a user" || len(op.Tags) != 1 {
+		t.Errorf("got operation %+v", op)
+	}
+	if len(op.Parameters) != 1 || op.Parameters[0].Name != "id" || op.Parameters[0].Schema.Pattern != "^[0-9]+$" {
+		t.Errorf("got parameters %+v", op.Parameters)
+	}
+	if op.RequestBody == nil || op.RequestBody.Content["application/json"].Schema.Ref != "#/components/schemas/OpenAPITestUser" {
+		t.Errorf("got request body %+v", op.RequestBody)
+	}
+	if op.Responses["200"].Content["application/json"].Schema.Ref != "#/components/schemas/OpenAPITestUser" {
+		t.Errorf("got responses %+v", op.Responses)
+	}
+	if op.Responses["default"].Content["application/json"].Schema.Ref != "#/components/schemas/HTTPError" {
+		t.Errorf("got responses %+v", op.Responses)
+	}
+
+	user := doc.Components.Schemas["OpenAPITestUser"]
+	if user == nil {
+		t.Fatalf("user schema not found: %v", doc.Components.Schemas)
+	}
+	if strings.Join(user.Required, ",") != "id,name" {
+		t.Errorf("got required %v", user.Required)
+	}
+	if p := user.Properties["id"]; p.Format != "uuid" {
+		t.Errorf("got id schema %+v", p)
+	}
+	if p := user.Properties["name"]; *p.MinLength != 1 || *p.MaxLength != 64 {
+		t.Errorf("got name schema %+v", p)
+	}
+	if p := user.Properties["age"]; p.Type != "integer" || *p.Minimum != 0 || *p.ExclusiveMaximum != 150 {
+		t.Errorf("got age schema %+v", p)
+	}
+	if p := user.Properties["role"]; len(p.Enum) != 2 {
+		t.Errorf("got role schema %+v", p)
+	}
+	if p := user.Properties["emails"]; *p.MaxItems != 3 || p.Items.Format != "email" {
+		t.Errorf("got emails schema %+v", p)
+	}
+	if p := user.Properties["friend"]; p.Ref != "#/components/schemas/OpenAPITestUser" {
+		t.Errorf("got friend schema %+v", p)
+	}
+
+	if op := doc.Paths["/health"]["get"]; op == nil || op.RequestBody != nil {
+		t.Errorf("got health operation %+v", op)
+	}
+}
+
+func TestRouterOpenAPINewHandler(t *testing.T) {
+	r := NewRouter()
+	r.Put("/users/{id}", NewHandler(func(ar AppRequest[openAPITestUpdateUserRequest, openAPITestUser]) {}))
+
+	doc := r.OpenAPI(OpenAPIConfig{Info: OpenAPIInfo{Title: "test", Version: "1.0.0"}})
+
+	op := doc.Paths["/users/{id}"]["put"]
+	if op == nil {
+		t.Fatalf("put /users/{id} operation not found: %v", doc.Paths)
+	}
+	if len(op.Parameters) != 1 || op.Parameters[0].Name != "id" {
+		t.Errorf("got parameters %+v", op.Parameters)
+	}
+	if op.RequestBody == nil || op.RequestBody.Content["application/json"].Schema.Ref != "#/components/schemas/OpenAPITestUser" {
+		t.Errorf("got request body %+v", op.RequestBody)
+	}
+	if op.Responses["200"].Content["application/json"].Schema.Ref != "#/components/schemas/OpenAPITestUser" {
+		t.Errorf("got responses %+v", op.Responses)
+	}
+	if _, ok := doc.Components.Schemas["OpenAPITestUser"]; !ok {
+		t.Errorf("user schema not found: %v", doc.Components.Schemas)
+	}
+}
+
+func TestRouterOpenAPIHandler(t *testing.T) {
+	r := NewRouter()
+	r.Get("/openapi", r.OpenAPIHandler(OpenAPIConfig{Info: OpenAPIInfo{Title: "test", Version: "1.0.0"}}))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi", nil))
+	doc := OpenAPIDocument{}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if doc.OpenAPI != OpenAPIVersion {
+		t.Errorf("got version %s", doc.OpenAPI)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi?format=yaml", nil))
+	if ct := w.Header().Get("Content-Type"); ct != "application/yaml" {
+		t.Errorf("got content type %s", ct)
+	}
+	if !strings.HasPrefix(w.Body.String(), "openapi: \"3.1.0\"\n") {
+		t.Errorf("got body %s", w.Body.String())
+	}
+}
@@ -0,0 +1,213 @@
+// Package codegen generates typed API clients from the OpenAPI
+// documents of betsi routers (see [betsi.Router.OpenAPI]).
+//
+// The betsi command only loads served or stored documents (see [Load]).
+// To generate a client from a registered router instead, pass the
+// document of the router to the generators within a go:generate
+// program:
+//
+//	b, err := codegen.Go(r.OpenAPI(cfg), codegen.GoConfig{Package: "users"})
+package codegen
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/iolave/go-betsi"
+	"github.com/iolave/go-betsi/internal/utils"
+	"github.com/iolave/go-errors"
+)
+
+// Codegen errors
+const (
+	ERR_NAME_CODEGEN    = "codegen_error"
+	ERR_CODEGEN_NIL_DOC = "OpenAPI document cannot be nil"
+	ERR_CODEGEN_LOAD    = "failed to load OpenAPI document from %s"
+	ERR_CODEGEN_PARSE   = "failed to parse OpenAPI document from %s"
+	ERR_CODEGEN_FORMAT  = "failed to format generated code"
+	ERR_CODEGEN_NAME    = "generated name %s is declared more than once, rename the schema or operation id"
+)
+
+// errorSchemaName is the name of the components schema betsi
+// documents every error response with.
+const errorSchemaName = "HTTPError"
+
+// refPrefix is the prefix of every components schema reference.
+const refPrefix = "#/components/schemas/"
+
+// Load loads an OpenAPI json document from src, that can be a file
+// path or an http(s) url (i.e "http://localhost:3000/docs/openapi.json").
+//
+// Any returned error is of type [github.com/iolave/go-errors.GenericError].
+func Load(ctx context.Context, src string) (*betsi.OpenAPIDocument, error) {
+	var b []byte
+	var err error
+	if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+		b, err = fetch(ctx, src)
+	} else {
+		b, err = os.ReadFile(src)
+	}
+	if err != nil {
+		return nil, errors.NewWithNameAndErr(
+			ERR_NAME_CODEGEN,
+			fmt.Sprintf(ERR_CODEGEN_LOAD, src),
+			err,
+		)
+	}
+
+	doc := &betsi.OpenAPIDocument{}
+	if err := json.Unmarshal(b, doc); err != nil {
+		return nil, errors.NewWithNameAndErr(
+			ERR_NAME_CODEGEN,
+			fmt.Sprintf(ERR_CODEGEN_PARSE, src),
+			err,
+		)
+	}
+
+	return doc, nil
+}
+
+// fetch gets the body of url, non 2xx responses are returned as errors.
+func fetch(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, errors.New(res.Status)
+	}
+
+	return io.ReadAll(res.Body)
+}
+
+// operation is a single operation of an OpenAPI document.
+type operation struct {
+	// Name is the exported name of the operation id.
+	Name   string
+	Method string
+	Path   string
+	Op     *betsi.OpenAPIOperation
+}
+
+// operations returns the operations of doc sorted by path and method.
+func operations(doc *betsi.OpenAPIDocument) []operation {
+	ops := []operation{}
+	for _, path := range sortedKeys(doc.Paths) {
+		item := doc.Paths[path]
+		for _, method := range sortedKeys(item) {
+			op := item[method]
+			if op == nil {
+				continue
+			}
+			ops = append(ops, operation{
+				Name:   exportName(op.OperationID),
+				Method: strings.ToUpper(method),
+				Path:   path,
+				Op:     op,
+			})
+		}
+	}
+
+	return ops
+}
+
+// nameSet holds the names declared by a generated client,
+// to detect the collisions between them.
+type nameSet map[string]bool
+
+// declare adds name to the set, it returns an error when
+// it was already declared.
+func (s nameSet) declare(name string) error {
+	if s[name] {
+		return errors.NewWithName(ERR_NAME_CODEGEN, fmt.Sprintf(ERR_CODEGEN_NAME, name))
+	}
+	s[name] = true
+
+	return nil
+}
+
+// pathParams returns the path parameters of op.
+func (op operation) pathParams() []betsi.OpenAPIParameter {
+	params := []betsi.OpenAPIParameter{}
+	for _, p := range op.Op.Parameters {
+		if p.In == "path" {
+			params = append(params, p)
+		}
+	}
+
+	return params
+}
+
+// bodySchema returns the json request body schema of op (if any).
+func (op operation) bodySchema() *betsi.JSONSchema {
+	if op.Op.RequestBody == nil {
+		return nil
+	}
+
+	return op.Op.RequestBody.Content["application/json"].Schema
+}
+
+// responseSchema returns the json schema of the op 200 response,
+// nil means the operation doesn't document its response.
+func (op operation) responseSchema() *betsi.JSONSchema {
+	res, ok := op.Op.Responses["200"]
+	if !ok {
+		return nil
+	}
+
+	return res.Content["application/json"].Schema
+}
+
+// schemaName returns the components schema name of a reference.
+func schemaName(ref string) string {
+	return strings.TrimPrefix(ref, refPrefix)
+}
+
+// exportName converts s into an upper camel case name (see
+// [utils.ExportName]). Names that don't start with a letter are
+// prefixed with "X", so they are valid identifiers.
+func exportName(s string) string {
+	name := utils.ExportName(s)
+	if name == "" || !unicode.IsLetter([]rune(name)[0]) {
+		name = "X" + name
+	}
+
+	return name
+}
+
+// sortedKeys returns the keys of m in increasing order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// isRequired returns true if name is within the required properties of s.
+func isRequired(s *betsi.JSONSchema, name string) bool {
+	for _, r := range s.Required {
+		if r == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,139 @@
+package codegen
+
+import (
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iolave/go-betsi"
+)
+
+type testUser struct {
+	ID        string    `json:"id" validate:"required"`
+	Name      string    `json:"name" validate:"required"`
+	Tags      []string  `json:"tags"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type testUpdateUserRequest struct {
+	ID   string   `ar:"path=id"`
+	Body testUser `ar:"body=json"`
+}
+
+func testDocument() *betsi.OpenAPIDocument {
+	r := betsi.NewRouter()
+	betsi.Put(r, "/users/{id:[0-9]+}", func(ar betsi.AppRequest[testUpdateUserRequest, testUser]) {},
+		betsi.WithSummary("Update a user"),
+	)
+	betsi.Get(r, "/users", func(ar betsi.AppRequest[struct{}, []testUser]) {})
+	r.Get("/health", betsi.Handler[any, any](func(ar betsi.AppRequest[any, any]) {}))
+
+	return r.OpenAPI(betsi.OpenAPIConfig{Info: betsi.OpenAPIInfo{Title: "users", Version: "1.0.0"}})
+}
+
+func TestGo(t *testing.T) {
+	b, err := Go(testDocument(), GoConfig{Package: "users"})
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	src := string(b)
+
+	if _, err := parser.ParseFile(token.NewFileSet(), "client.go", b, 0); err != nil {
+		t.Fatalf("generated code doesn't parse: %v\n%s", err, src)
+	}
+
+	want := []string{
+		"package users",
+		"type TestUser struct {",
+		"CreatedAt time.Time `json:\"createdAt,omitempty\"`",
+		"Id        string    `json:\"id\"`",
+		"type PutUsersByIdRequest struct {\n\tId   string   `ar:\"path=id\"`\n\tBody TestUser `ar:\"body=json\"`\n}",
+		"// PutUsersById Update a user",
+		"func (c *Client) PutUsersById(ctx context.Context, in PutUsersByIdRequest, opts ...betsi.CallOption) (*TestUser, error) {",
+		"betsi.Do[PutUsersByIdRequest, TestUser](ctx, c.c, http.MethodPut, \"/users/{id}\", in, opts...)",
+		"type GetUsersResponse []TestUser",
+		"func (c *Client) GetHealth(ctx context.Context, in GetHealthRequest, opts ...betsi.CallOption) (*any, error) {",
+	}
+	for _, w := range want {
+		if !strings.Contains(src, w) {
+			t.Errorf("generated code doesn't contain %q:\n%s", w, src)
+		}
+	}
+	if strings.Contains(src, "type HTTPError") {
+		t.Errorf("generated code contains the HTTPError type:\n%s", src)
+	}
+}
+
+func TestTypeScript(t *testing.T) {
+	b, err := TypeScript(testDocument())
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	src := string(b)
+
+	want := []string{
+		"export type HTTPError = {",
+		"export type TestUser = {\n  createdAt?: string;\n  id: string;\n  name: string;\n  tags?: string[];\n};",
+		"export interface PutUsersByIdRequest {\n  id: string;\n  body: TestUser;\n}",
+		"export type GetUsersResponse = TestUser[];",
+		"putUsersById(req: PutUsersByIdRequest, init?: RequestInit): Promise<PutUsersByIdResponse> {",
+		"return this.do(\"PUT\", `/users/${encodeURIComponent(req.id)}`, req.body, init);",
+		"getHealth(_req: GetHealthRequest = {}, init?: RequestInit): Promise<GetHealthResponse> {",
+	}
+	for _, w := range want {
+		if !strings.Contains(src, w) {
+			t.Errorf("generated code doesn't contain %q:\n%s", w, src)
+		}
+	}
+}
+
+func TestNameCollisions(t *testing.T) {
+	type TestCase struct {
+		Name    string
+		Schema  string
+		WantErr bool
+	}
+
+	testCases := []TestCase{}
+	testCases = append(testCases, TestCase{
+		Name:    "schemas named like the client should collide",
+		Schema:  "Client",
+		WantErr: true,
+	})
+	testCases = append(testCases, TestCase{
+		Name:    "schemas exported like the client should collide",
+		Schema:  "client",
+		WantErr: true,
+	})
+	testCases = append(testCases, TestCase{
+		Name:    "schemas named like an operation request should collide",
+		Schema:  "PutUsersByIdRequest",
+		WantErr: true,
+	})
+	testCases = append(testCases, TestCase{
+		Name:    "schemas named like an operation response should collide",
+		Schema:  "GetUsersResponse",
+		WantErr: true,
+	})
+	testCases = append(testCases, TestCase{
+		Name:    "other schemas should not collide",
+		Schema:  "Team",
+		WantErr: false,
+	})
+
+	for _, tt := range testCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			doc := testDocument()
+			doc.Components.Schemas[tt.Schema] = &betsi.JSONSchema{Type: "string"}
+
+			if _, err := Go(doc, GoConfig{}); (err != nil) != tt.WantErr {
+				t.Errorf("got go error %v, wantErr: %v", err, tt.WantErr)
+			}
+			if _, err := TypeScript(doc); (err != nil) != tt.WantErr {
+				t.Errorf("got typescript error %v, wantErr: %v", err, tt.WantErr)
+			}
+		})
+	}
+}
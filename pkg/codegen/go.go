@@ -0,0 +1,271 @@
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strings"
+
+	"github.com/iolave/go-betsi"
+	"github.com/iolave/go-errors"
+)
+
+// GoConfig is the configuration of the Go client generator.
+type GoConfig struct {
+	// Package is the package name of the generated
+	// code. Defaults to "client".
+	Package string
+}
+
+// goGenerator holds the state of a single Go client generation.
+type goGenerator struct {
+	buf     *bytes.Buffer
+	imports map[string]bool
+}
+
+// Go generates a Go client package from doc. The generated client wraps
+// a [betsi.Client] and has a method per operation, named after its
+// operation id, that sends the request using [betsi.Do] (and therefore
+// [betsi.NewRequest]):
+//
+//   - Components schemas are generated as structs.
+//   - Every operation gets a `<OperationId>Request` struct, whose
+//     path params and json body are `ar` tagged.
+//   - Responses that don't reference a components schema get a
+//     `<OperationId>Response` type.
+//
+// Error responses are returned as [github.com/iolave/go-errors.HTTPError]
+// by the betsi client, so the "HTTPError" schema is not generated.
+//
+// It fails when generated names collide (i.e a schema named "Client"
+// or "<OperationId>Request").
+//
+// Any returned error is of type [github.com/iolave/go-errors.GenericError].
+func Go(doc *betsi.OpenAPIDocument, cfg GoConfig) ([]byte, error) {
+	if doc == nil {
+		return nil, errors.NewWithName(ERR_NAME_CODEGEN, ERR_CODEGEN_NIL_DOC)
+	}
+	if cfg.Package == "" {
+		cfg.Package = "client"
+	}
+
+	names := nameSet{"Client": true, "NewClient": true}
+	for _, name := range sortedKeys(doc.Components.Schemas) {
+		if name == errorSchemaName {
+			continue
+		}
+		if err := names.declare(exportName(name)); err != nil {
+			return nil, err
+		}
+	}
+	ops := operations(doc)
+	for _, op := range ops {
+		if err := names.declare("Client." + op.Name); err != nil {
+			return nil, err
+		}
+		if err := names.declare(op.Name + "Request"); err != nil {
+			return nil, err
+		}
+		if goResponseType(op) {
+			if err := names.declare(op.Name + "Response"); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	g := &goGenerator{
+		buf:     &bytes.Buffer{},
+		imports: map[string]bool{},
+	}
+	g.client(doc)
+	for _, name := range sortedKeys(doc.Components.Schemas) {
+		if name == errorSchemaName {
+			continue
+		}
+		fmt.Fprintf(g.buf, "// %s is the %s schema.\n", exportName(name), name)
+		g.schemaType(exportName(name), doc.Components.Schemas[name])
+	}
+	for _, op := range ops {
+		g.operation(op)
+	}
+
+	src := &bytes.Buffer{}
+	fmt.Fprintf(src, "// Code generated by betsi. DO NOT EDIT.\n\n")
+	fmt.Fprintf(src, "package %s\n\n", cfg.Package)
+	fmt.Fprintf(src, "import (\n")
+	for _, pkg := range sortedKeys(g.imports) {
+		fmt.Fprintf(src, "\t%q\n", pkg)
+	}
+	fmt.Fprintf(src, "\n\t\"github.com/iolave/go-betsi\"\n)\n\n")
+	src.Write(g.buf.Bytes())
+
+	b, err := format.Source(src.Bytes())
+	if err != nil {
+		return nil, errors.NewWithNameAndErr(ERR_NAME_CODEGEN, ERR_CODEGEN_FORMAT, err)
+	}
+
+	return b, nil
+}
+
+// client writes the client type and its constructor.
+func (g *goGenerator) client(doc *betsi.OpenAPIDocument) {
+	title := doc.Info.Title
+	if title == "" {
+		title = "API"
+	}
+
+	fmt.Fprintf(g.buf, "// Client is the %s client.\n", title)
+	fmt.Fprintf(g.buf, "type Client struct {\n\tc *betsi.Client\n}\n\n")
+	fmt.Fprintf(g.buf, "// NewClient returns a new client, see [betsi.NewClient].\n")
+	fmt.Fprintf(g.buf, "func NewClient(cfg betsi.ClientConfig) (*Client, error) {\n")
+	fmt.Fprintf(g.buf, "\tc, err := betsi.NewClient(cfg)\n")
+	fmt.Fprintf(g.buf, "\tif err != nil {\n\t\treturn nil, err\n\t}\n\n")
+	fmt.Fprintf(g.buf, "\treturn &Client{c: c}, nil\n}\n\n")
+}
+
+// schemaType writes a named type for the schema s.
+func (g *goGenerator) schemaType(name string, s *betsi.JSONSchema) {
+	fmt.Fprintf(g.buf, "type %s %s\n\n", name, g.typ(s))
+}
+
+// operation writes the request and response types of op
+// and the client method that sends it.
+func (g *goGenerator) operation(op operation) {
+	g.imports["context"] = true
+	reqName := op.Name + "Request"
+	fmt.Fprintf(g.buf, "// %s is the request of [Client.%s].\n", reqName, op.Name)
+	fmt.Fprintf(g.buf, "type %s struct {\n", reqName)
+	for _, p := range op.pathParams() {
+		fmt.Fprintf(g.buf, "%s string `ar:\"path=%s\"`\n", exportName(p.Name), p.Name)
+	}
+	if body := op.bodySchema(); body != nil {
+		fmt.Fprintf(g.buf, "Body %s `ar:\"body=json\"`\n", g.typ(body))
+	}
+	fmt.Fprintf(g.buf, "}\n\n")
+
+	resName := "any"
+	if res := op.responseSchema(); res != nil && res.Ref != "" {
+		resName = exportName(schemaName(res.Ref))
+	} else if goResponseType(op) {
+		resName = op.Name + "Response"
+		fmt.Fprintf(g.buf, "// %s is the response of [Client.%s].\n", resName, op.Name)
+		g.schemaType(resName, res)
+	}
+
+	summary := op.Op.Summary
+	if summary == "" {
+		summary = fmt.Sprintf("sends a %s %s request.", op.Method, op.Path)
+	}
+	fmt.Fprintf(g.buf, "// %s %s\n", op.Name, summary)
+	if op.Op.Description != "" {
+		fmt.Fprintf(g.buf, "//\n")
+		for line := range strings.SplitSeq(op.Op.Description, "\n") {
+			fmt.Fprintf(g.buf, "// %s\n", line)
+		}
+	}
+	fmt.Fprintf(
+		g.buf,
+		"func (c *Client) %s(ctx context.Context, in %s, opts ...betsi.CallOption) (*%s, error) {\n",
+		op.Name, reqName, resName,
+	)
+	fmt.Fprintf(
+		g.buf,
+		"\treturn betsi.Do[%s, %s](ctx, c.c, %s, %q, in, opts...)\n}\n\n",
+		reqName, resName, g.method(op.Method), op.Path,
+	)
+}
+
+// goResponseType returns true if a `<OperationId>Response` type is
+// generated for op, that is when its response doesn't reference a
+// components schema.
+func goResponseType(op operation) bool {
+	res := op.responseSchema()
+	return res != nil && res.Ref == "" && res.Type != ""
+}
+
+// typ returns the Go type of the schema s, objects with
+// properties are returned as anonymous structs.
+func (g *goGenerator) typ(s *betsi.JSONSchema) string {
+	if s == nil {
+		return "any"
+	}
+	if s.Ref != "" {
+		return exportName(schemaName(s.Ref))
+	}
+
+	switch s.Type {
+	case "string":
+		switch s.Format {
+		case "date-time":
+			g.imports["time"] = true
+			return "time.Time"
+		case "byte":
+			return "[]byte"
+		}
+		return "string"
+	case "integer":
+		if s.Format == "int32" {
+			return "int32"
+		}
+		return "int64"
+	case "number":
+		if s.Format == "float" {
+			return "float32"
+		}
+		return "float64"
+	case "boolean":
+		return "bool"
+	case "array":
+		return "[]" + g.typ(s.Items)
+	case "object":
+		if s.Properties != nil {
+			return g.structType(s)
+		}
+		if s.AdditionalProperties != nil {
+			return "map[string]" + g.typ(s.AdditionalProperties)
+		}
+		return "map[string]any"
+	}
+
+	return "any"
+}
+
+// structType returns an anonymous struct type with the properties of s,
+// properties that aren't required are tagged with omitempty.
+func (g *goGenerator) structType(s *betsi.JSONSchema) string {
+	b := &strings.Builder{}
+	b.WriteString("struct {\n")
+	for _, name := range sortedKeys(s.Properties) {
+		tag := name
+		if !isRequired(s, name) {
+			tag += ",omitempty"
+		}
+		fmt.Fprintf(b, "%s %s `json:%q`\n", exportName(name), g.typ(s.Properties[name]), tag)
+	}
+	b.WriteString("}")
+
+	return b.String()
+}
+
+// goMethods maps the http methods to their net/http constant.
+var goMethods = map[string]string{
+	"GET":     "http.MethodGet",
+	"POST":    "http.MethodPost",
+	"PUT":     "http.MethodPut",
+	"DELETE":  "http.MethodDelete",
+	"PATCH":   "http.MethodPatch",
+	"HEAD":    "http.MethodHead",
+	"OPTIONS": "http.MethodOptions",
+}
+
+// method returns the net/http constant of an http method or
+// the quoted method if there's none.
+func (g *goGenerator) method(method string) string {
+	name, ok := goMethods[method]
+	if !ok {
+		return fmt.Sprintf("%q", method)
+	}
+	g.imports["net/http"] = true
+
+	return name
+}
@@ -0,0 +1,280 @@
+package codegen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/iolave/go-betsi"
+	"github.com/iolave/go-errors"
+)
+
+// tsIdentRegexp matches the names that can be used as TypeScript
+// property names without being quoted.
+var tsIdentRegexp = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// tsClientHeader and tsClientFooter are the runtime of the generated
+// TypeScript client, the operation methods are written in between them.
+const tsClientHeader = `export class ClientError extends Error {
+  readonly statusCode: number;
+  readonly error: HTTPError;
+
+  constructor(error: HTTPError) {
+    super(error.message);
+    this.name = error.name;
+    this.statusCode = error.statusCode;
+    this.error = error;
+  }
+}
+
+export interface ClientConfig {
+  /** baseURL is the url every request path is appended to. */
+  baseURL: string;
+  /** headers are the default headers sent with every request. */
+  headers?: Record<string, string>;
+  /** fetch is the fetch implementation, defaults to the global one. */
+  fetch?: typeof fetch;
+}
+
+export class Client {
+  private readonly baseURL: string;
+  private readonly headers: Record<string, string>;
+  private readonly fetch: typeof fetch;
+
+  constructor(config: ClientConfig) {
+    this.baseURL = config.baseURL.replace(/\/+$/, "");
+    this.headers = config.headers ?? {};
+    this.fetch = config.fetch ?? globalThis.fetch.bind(globalThis);
+  }
+`
+
+const tsClientFooter = `
+  private async do<T>(method: string, path: string, body: unknown, init?: RequestInit): Promise<T> {
+    const headers = new Headers(init?.headers);
+    for (const [k, v] of Object.entries(this.headers)) {
+      if (!headers.has(k)) headers.set(k, v);
+    }
+    if (!headers.has("accept")) headers.set("accept", "application/json");
+    if (body !== undefined) headers.set("content-type", "application/json");
+
+    const res = await this.fetch(this.baseURL + path, {
+      ...init,
+      method,
+      headers,
+      body: body === undefined ? undefined : JSON.stringify(body),
+    });
+    const text = await res.text();
+    if (!res.ok) {
+      throw new ClientError(parseError(res, text));
+    }
+
+    return (text === "" ? undefined : JSON.parse(text)) as T;
+  }
+}
+
+function parseError(res: Response, text: string): HTTPError {
+  try {
+    const err = JSON.parse(text);
+    if (typeof err === "object" && err !== null && typeof err.name === "string" && typeof err.message === "string") {
+      return { ...err, statusCode: err.statusCode || res.status };
+    }
+  } catch {
+    // the body is not json, it is used as the error message.
+  }
+
+  const name = res.statusText.toLowerCase().replace(/\s+/g, "_");
+  return { statusCode: res.status, name: name + "_error", message: text };
+}
+`
+
+// TypeScript generates a TypeScript client module from doc. The module
+// exports a `Client` class with a method per operation, named after its
+// operation id, that sends the request using fetch:
+//
+//   - Components schemas are generated as types.
+//   - Every operation gets a `<OperationId>Request` type, holding its
+//     path params and json `body`, and a `<OperationId>Response` type.
+//   - Non 2xx responses are thrown as a `ClientError` that holds the
+//     [github.com/iolave/go-errors.HTTPError] sent by the app.
+//
+// It fails when generated names collide (i.e a schema named "Client"
+// or "<OperationId>Request").
+//
+// Any returned error is of type [github.com/iolave/go-errors.GenericError].
+func TypeScript(doc *betsi.OpenAPIDocument) ([]byte, error) {
+	if doc == nil {
+		return nil, errors.NewWithName(ERR_NAME_CODEGEN, ERR_CODEGEN_NIL_DOC)
+	}
+
+	names := nameSet{"Client": true, "ClientConfig": true, "ClientError": true}
+	if _, ok := doc.Components.Schemas[errorSchemaName]; !ok {
+		names[errorSchemaName] = true
+	}
+	for _, name := range sortedKeys(doc.Components.Schemas) {
+		if err := names.declare(exportName(name)); err != nil {
+			return nil, err
+		}
+	}
+	ops := operations(doc)
+	for _, op := range ops {
+		for _, name := range []string{"Client." + op.Name, op.Name + "Request", op.Name + "Response"} {
+			if err := names.declare(name); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "// Code generated by betsi. DO NOT EDIT.\n\n")
+
+	if _, ok := doc.Components.Schemas[errorSchemaName]; !ok {
+		fmt.Fprintf(buf, "export interface %s {\n", errorSchemaName)
+		fmt.Fprintf(buf, "  statusCode: number;\n  name: string;\n  message: string;\n  error?: unknown;\n}\n\n")
+	}
+	for _, name := range sortedKeys(doc.Components.Schemas) {
+		fmt.Fprintf(buf, "export type %s = %s;\n\n", exportName(name), tsType(doc.Components.Schemas[name], ""))
+	}
+
+	for _, op := range ops {
+		fmt.Fprintf(buf, "export interface %sRequest {\n", op.Name)
+		for _, p := range op.pathParams() {
+			fmt.Fprintf(buf, "  %s: string;\n", tsProperty(p.Name))
+		}
+		if body := op.bodySchema(); body != nil {
+			fmt.Fprintf(buf, "  body: %s;\n", tsType(body, "  "))
+		}
+		fmt.Fprintf(buf, "}\n\n")
+		fmt.Fprintf(buf, "export type %sResponse = %s;\n\n", op.Name, tsType(op.responseSchema(), ""))
+	}
+
+	buf.WriteString(tsClientHeader)
+	for _, op := range ops {
+		tsOperation(buf, op)
+	}
+	buf.WriteString(tsClientFooter)
+
+	return buf.Bytes(), nil
+}
+
+// tsOperation writes the client method that sends op.
+func tsOperation(buf *bytes.Buffer, op operation) {
+	method := strings.ToLower(op.Name[:1]) + op.Name[1:]
+
+	// Path params are replaced by template literal
+	// expressions of the request properties.
+	path := op.Path
+	params := op.pathParams()
+	for _, p := range params {
+		path = strings.ReplaceAll(
+			path,
+			"{"+p.Name+"}",
+			"${encodeURIComponent(req"+tsAccessor(p.Name)+")}",
+		)
+	}
+	path = strings.ReplaceAll(path, "`", "\\`")
+
+	req := "req: " + op.Name + "Request"
+	if len(params) == 0 && op.bodySchema() == nil {
+		// The request is empty, so it is optional and unused.
+		req = "_" + req + " = {}"
+	}
+	body := "undefined"
+	if op.bodySchema() != nil {
+		body = "req.body"
+	}
+
+	fmt.Fprintf(buf, "\n  /**\n")
+	if op.Op.Summary != "" {
+		fmt.Fprintf(buf, "   * %s\n", op.Op.Summary)
+	} else {
+		fmt.Fprintf(buf, "   * Sends a %s %s request.\n", op.Method, op.Path)
+	}
+	if op.Op.Description != "" {
+		fmt.Fprintf(buf, "   *\n")
+		for line := range strings.SplitSeq(op.Op.Description, "\n") {
+			fmt.Fprintf(buf, "   * %s\n", line)
+		}
+	}
+	fmt.Fprintf(buf, "   */\n")
+	fmt.Fprintf(buf, "  %s(%s, init?: RequestInit): Promise<%sResponse> {\n", method, req, op.Name)
+	fmt.Fprintf(buf, "    return this.do(%q, `%s`, %s, init);\n", op.Method, path, body)
+	fmt.Fprintf(buf, "  }\n")
+}
+
+// tsType returns the TypeScript type of the schema s, where indent is
+// the indentation of the line the type is written at.
+func tsType(s *betsi.JSONSchema, indent string) string {
+	if s == nil {
+		return "unknown"
+	}
+	if s.Ref != "" {
+		return exportName(schemaName(s.Ref))
+	}
+	if len(s.Enum) > 0 {
+		values := []string{}
+		for _, v := range s.Enum {
+			b, _ := json.Marshal(v)
+			values = append(values, string(b))
+		}
+		return strings.Join(values, " | ")
+	}
+
+	switch s.Type {
+	case "string":
+		return "string"
+	case "integer", "number":
+		return "number"
+	case "boolean":
+		return "boolean"
+	case "array":
+		items := tsType(s.Items, indent)
+		if strings.Contains(items, "|") {
+			items = "(" + items + ")"
+		}
+		return items + "[]"
+	case "object":
+		if s.Properties != nil {
+			b := &strings.Builder{}
+			b.WriteString("{\n")
+			for _, name := range sortedKeys(s.Properties) {
+				optional := "?"
+				if isRequired(s, name) {
+					optional = ""
+				}
+				fmt.Fprintf(
+					b, "%s  %s%s: %s;\n",
+					indent, tsProperty(name), optional, tsType(s.Properties[name], indent+"  "),
+				)
+			}
+			b.WriteString(indent + "}")
+			return b.String()
+		}
+		if s.AdditionalProperties != nil {
+			return "Record<string, " + tsType(s.AdditionalProperties, indent) + ">"
+		}
+		return "Record<string, unknown>"
+	}
+
+	return "unknown"
+}
+
+// tsProperty returns name as a TypeScript property name,
+// quoting it when it is not a valid identifier.
+func tsProperty(name string) string {
+	if tsIdentRegexp.MatchString(name) {
+		return name
+	}
+
+	return fmt.Sprintf("%q", name)
+}
+
+// tsAccessor returns the TypeScript property accessor of name.
+func tsAccessor(name string) string {
+	if tsIdentRegexp.MatchString(name) {
+		return "." + name
+	}
+
+	return fmt.Sprintf("[%q]", name)
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+//go:embed docs
+var docsFS embed.FS
+
+// docsTemplate is the docs UI index page template.
+var docsTemplate = template.Must(template.ParseFS(docsFS, "docs/index.html"))
+
+// docsAssets maps the docs UI asset names to their content type.
+var docsAssets = map[string]string{
+	"docs.css": "text/css; charset=utf-8",
+	"docs.js":  "text/javascript; charset=utf-8",
+}
+
+// DocsHandlerConfig is the configuration for the
+// docs handler.
+type DocsHandlerConfig struct {
+	// Title is the title of the docs page, it is
+	// replaced by the OpenAPI document title once
+	// it has been loaded.
+	Title string
+
+	// BasePath is the path where the handler is
+	// mounted (i.e "/docs"). It is only used when the
+	// handler is not served by a chi router, which
+	// otherwise routes the path within its mount.
+	BasePath string
+
+	// SpecURL is the url of the OpenAPI document, it
+	// can be relative to the base path (i.e
+	// "openapi.json").
+	SpecURL string
+
+	// APIURL is the url the paths of the OpenAPI document
+	// are relative to, used to send requests from the UI.
+	// It can be relative to the base path (i.e "../").
+	// Defaults to "/".
+	APIURL string
+}
+
+// NewDocsHandler returns a http.HandlerFunc that serves an
+// interactive API docs UI for the OpenAPI document served at
+// cfg.SpecURL. The UI assets are embedded within the binary,
+// so it doesn't depend on any external resource (CDN).
+//
+// The handler can be mounted at any path of a chi router (or at
+// cfg.BasePath otherwise), requests to the base path are
+// redirected to the `/` sufixed base path, where the UI is
+// served. Unknown paths are handled by [NewNotFoundHandler].
+func NewDocsHandler(cfg DocsHandlerConfig) http.HandlerFunc {
+	basePath := strings.TrimSuffix(cfg.BasePath, "/")
+	notFound := NewNotFoundHandler(nil)
+	if cfg.APIURL == "" {
+		cfg.APIURL = "/"
+	}
+
+	index := &bytes.Buffer{}
+	err := docsTemplate.Execute(index, cfg)
+	if err != nil {
+		panic(err)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := strings.TrimPrefix(r.URL.Path, basePath)
+		if rc := chi.RouteContext(r.Context()); rc != nil && rc.RoutePath != "" {
+			// The route path of a mounted router is "/" for
+			// both the mount path and its `/` sufixed path.
+			p = rc.RoutePath
+			if p == "/" && !strings.HasSuffix(r.URL.Path, "/") {
+				p = ""
+			}
+		}
+
+		switch p {
+		case "":
+			http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+			return
+		case "/", "/index.html":
+			w.Header().Set("content-type", "text/html; charset=utf-8")
+			w.WriteHeader(http.StatusOK)
+			w.Write(index.Bytes())
+			return
+		}
+
+		name := strings.TrimPrefix(p, "/")
+		contentType, ok := docsAssets[name]
+		if !ok {
+			notFound(w, r)
+			return
+		}
+
+		b, _ := docsFS.ReadFile("docs/" + name)
+		w.Header().Set("content-type", contentType)
+		w.WriteHeader(http.StatusOK)
+		w.Write(b)
+	})
+}
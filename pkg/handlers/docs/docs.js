@@ -0,0 +1,217 @@
+(function () {
+	"use strict";
+
+	var config = JSON.parse(document.getElementById("config").textContent);
+	var operations = document.getElementById("operations");
+	var methods = ["get", "post", "put", "patch", "delete", "head", "options"];
+
+	// el creates an element with the given class and text content,
+	// text is never parsed as html.
+	function el(tag, className, text) {
+		var e = document.createElement(tag);
+		if (className) {
+			e.className = className;
+		}
+		if (text !== undefined) {
+			e.textContent = text;
+		}
+		return e;
+	}
+
+	// resolve follows a local "$ref" within the document.
+	function resolve(doc, schema) {
+		if (!schema || !schema.$ref) {
+			return schema || {};
+		}
+		var parts = schema.$ref.replace(/^#\//, "").split("/");
+		var target = doc;
+		for (var i = 0; i < parts.length; i++) {
+			target = target ? target[parts[i]] : undefined;
+		}
+		return target || {};
+	}
+
+	// example builds an example value from a schema.
+	function example(doc, schema, depth) {
+		schema = resolve(doc, schema);
+		if (depth > 5) {
+			return null;
+		}
+		if (schema.enum && schema.enum.length) {
+			return schema.enum[0];
+		}
+		switch (schema.type) {
+			case "object":
+				var obj = {};
+				var props = schema.properties || {};
+				Object.keys(props).forEach(function (k) {
+					obj[k] = example(doc, props[k], depth + 1);
+				});
+				return obj;
+			case "array":
+				return [example(doc, schema.items, depth + 1)];
+			case "integer":
+			case "number":
+				return schema.minimum || 0;
+			case "boolean":
+				return false;
+			case "string":
+				if (schema.format === "date-time") {
+					return new Date(0).toISOString();
+				}
+				return schema.format || "string";
+			default:
+				return null;
+		}
+	}
+
+	function jsonBlock(value) {
+		return el("pre", "", JSON.stringify(value, null, 2));
+	}
+
+	function renderParameters(op, body) {
+		if (!op.parameters || !op.parameters.length) {
+			return {};
+		}
+		var inputs = {};
+		var table = el("table");
+		var head = el("tr");
+		["Name", "In", "Schema", "Value"].forEach(function (h) {
+			head.appendChild(el("th", "", h));
+		});
+		table.appendChild(head);
+		op.parameters.forEach(function (p) {
+			var row = el("tr");
+			row.appendChild(el("td", "path", p.name));
+			row.appendChild(el("td", "", p.in));
+			row.appendChild(el("td", "", JSON.stringify(p.schema || {})));
+			var td = el("td");
+			var input = el("input");
+			input.placeholder = p.name;
+			inputs[p.name] = input;
+			td.appendChild(input);
+			row.appendChild(td);
+			table.appendChild(row);
+		});
+		body.appendChild(el("h4", "", "Parameters"));
+		body.appendChild(table);
+		return inputs;
+	}
+
+	function renderTryIt(path, method, inputs, bodyInput, body) {
+		var button = el("button", "", "Send request");
+		var output = el("pre");
+		output.hidden = true;
+		button.addEventListener("click", function () {
+			var url = path.replace(/\{([^}]+)\}/g, function (_, name) {
+				return encodeURIComponent(inputs[name] ? inputs[name].value : "");
+			});
+			var base = new URL(config.apiURL.replace(/\/?$/, "/"), location.href);
+			url = new URL(url.replace(/^\//, ""), base);
+			var init = { method: method.toUpperCase(), headers: {} };
+			if (bodyInput) {
+				init.headers["Content-Type"] = "application/json";
+				init.body = bodyInput.value;
+			}
+			output.hidden = false;
+			output.textContent = "Loading...";
+			fetch(url, init).then(function (res) {
+				return res.text().then(function (text) {
+					try {
+						text = JSON.stringify(JSON.parse(text), null, 2);
+					} catch (e) {
+						// Not a json body, it is shown as is.
+					}
+					output.textContent = res.status + " " + res.statusText + "\n\n" + text;
+				});
+			}).catch(function (err) {
+				output.textContent = String(err);
+			});
+		});
+		body.appendChild(el("h4", "", "Try it"));
+		body.appendChild(button);
+		body.appendChild(output);
+	}
+
+	function renderOperation(doc, path, method, op) {
+		var details = el("details", "operation");
+		var summary = el("summary");
+		summary.appendChild(el("span", "method " + method, method));
+		summary.appendChild(el("span", "path", path));
+		summary.appendChild(el("span", "summary", op.summary || ""));
+		details.appendChild(summary);
+
+		var body = el("div", "body");
+		if (op.description) {
+			body.appendChild(el("p", "", op.description));
+		}
+		body.appendChild(el("p", "summary", "Operation id: " + op.operationId));
+
+		var inputs = renderParameters(op, body);
+
+		var bodyInput = null;
+		if (op.requestBody) {
+			var content = op.requestBody.content["application/json"] || {};
+			body.appendChild(el("h4", "", "Request body"));
+			body.appendChild(jsonBlock(resolve(doc, content.schema)));
+			bodyInput = el("textarea");
+			bodyInput.value = JSON.stringify(example(doc, content.schema, 0), null, 2);
+			body.appendChild(bodyInput);
+		}
+
+		body.appendChild(el("h4", "", "Responses"));
+		Object.keys(op.responses || {}).forEach(function (code) {
+			var res = op.responses[code];
+			body.appendChild(el("p", "", code + ": " + res.description));
+			var content = (res.content || {})["application/json"];
+			if (content) {
+				body.appendChild(jsonBlock(resolve(doc, content.schema)));
+			}
+		});
+
+		renderTryIt(path, method, inputs, bodyInput, body);
+		details.appendChild(body);
+		return details;
+	}
+
+	function render(doc) {
+		document.title = doc.info.title;
+		document.getElementById("title").textContent = doc.info.title + " " + doc.info.version;
+		document.getElementById("description").textContent = doc.info.description || "";
+		operations.textContent = "";
+
+		// Groups the operations by their first tag.
+		var groups = {};
+		Object.keys(doc.paths || {}).sort().forEach(function (path) {
+			methods.forEach(function (method) {
+				var op = doc.paths[path][method];
+				if (!op) {
+					return;
+				}
+				var tag = (op.tags && op.tags[0]) || "default";
+				groups[tag] = groups[tag] || [];
+				groups[tag].push(renderOperation(doc, path, method, op));
+			});
+		});
+
+		Object.keys(groups).sort().forEach(function (tag) {
+			operations.appendChild(el("h2", "tag", tag));
+			groups[tag].forEach(function (op) {
+				operations.appendChild(op);
+			});
+		});
+	}
+
+	fetch(config.specURL, { headers: { Accept: "application/json" } })
+		.then(function (res) {
+			if (!res.ok) {
+				throw new Error("failed to load " + config.specURL + " (" + res.status + ")");
+			}
+			return res.json();
+		})
+		.then(render)
+		.catch(function (err) {
+			operations.textContent = "";
+			operations.appendChild(el("p", "error", String(err)));
+		});
+})();
@@ -0,0 +1,304 @@
+package middlewares
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iolave/go-betsi/internal/utils"
+	"github.com/iolave/go-logger"
+)
+
+// ECS_VERSION is the Elastic Common Schema version
+// of the ACCESS_LOG_ECS access logs.
+const ECS_VERSION = "8.11.0"
+
+// commonLogTimeFormat is the time format of the
+// Common and Combined Log Formats.
+const commonLogTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// AccessLogFormat is the format of the access logs.
+type AccessLogFormat string
+
+const (
+	// ACCESS_LOG_COMMON is the Common Log Format:
+	//
+	//	127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /index.html HTTP/1.1" 200 2326
+	ACCESS_LOG_COMMON AccessLogFormat = "common"
+
+	// ACCESS_LOG_COMBINED is the Combined Log Format, which is the
+	// Common Log Format followed by the referer and user agent:
+	//
+	//	127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /index.html HTTP/1.1" 200 2326 "http://example.com/" "Mozilla/5.0"
+	ACCESS_LOG_COMBINED AccessLogFormat = "combined"
+
+	// ACCESS_LOG_ECS is a JSON object per line following the
+	// Elastic Common Schema (ECS) http, url, client and user_agent
+	// fields.
+	ACCESS_LOG_ECS AccessLogFormat = "ecs"
+)
+
+// AccessLogConfig holds the configuration for the access log middleware.
+type AccessLogConfig struct {
+	// Writer is where the access logs are written, one per line. Use
+	// an [AccessLogFile] to reopen the log file when it's rotated.
+	Writer io.Writer
+
+	// Format is the format of the access logs. Defaults
+	// to ACCESS_LOG_COMBINED.
+	Format AccessLogFormat
+
+	// Logger is an optional logger to use for logging
+	// the errors writing the access logs.
+	Logger logger.Logger
+}
+
+// NewAccessLogMdw creates a new access log middleware.
+//
+// This middleware writes an access log line for every request, once
+// it's handled, in the Common or Combined Log Format or as ECS JSON.
+// The client IP is the one resolved by [NewClientIPMdw] (or the remote
+// address of the request when the middleware is not used). It panics
+// if the writer is nil or the format is unknown.
+//
+// Example:
+//
+//	f, err := middlewares.OpenAccessLogFile("/var/log/app/access.log")
+//	if err != nil {
+//		panic(err)
+//	}
+//	defer f.ReopenOnSignal(nil)()
+//	r.Use(middlewares.NewAccessLogMdw(middlewares.AccessLogConfig{
+//		Writer: f,
+//		Format: middlewares.ACCESS_LOG_COMBINED,
+//	}))
+func NewAccessLogMdw(cfg AccessLogConfig) func(next http.Handler) http.Handler {
+	if cfg.Writer == nil {
+		panic("writer cannot be nil")
+	}
+	if cfg.Format == "" {
+		cfg.Format = ACCESS_LOG_COMBINED
+	}
+
+	var format func(e accessLogEntry) []byte
+	switch cfg.Format {
+	case ACCESS_LOG_COMMON:
+		format = func(e accessLogEntry) []byte { return e.common(false) }
+	case ACCESS_LOG_COMBINED:
+		format = func(e accessLogEntry) []byte { return e.common(true) }
+	case ACCESS_LOG_ECS:
+		format = accessLogEntry.ecs
+	default:
+		panic(fmt.Sprintf("unknown access log format %q", cfg.Format))
+	}
+
+	// mu serializes the writes, so lines are not interleaved.
+	mu := sync.Mutex{}
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			rw := &utils.ResponseWriter{
+				Original: w,
+			}
+
+			// body counts the request body bytes read by the next
+			// handlers when the content length is unknown.
+			var body *countingReadCloser
+			if r.ContentLength < 0 && r.Body != nil {
+				body = &countingReadCloser{ReadCloser: r.Body}
+				r.Body = body
+			}
+			start := time.Now()
+
+			// completed is set once the next handler returns, if it
+			// is still false within the deferred function, the next
+			// handler panicked and the panic is being propagated.
+			completed := false
+
+			defer func() {
+				e := accessLogEntry{
+					r:        r,
+					start:    start,
+					duration: time.Since(start),
+					status:   rw.SentStatus,
+					bytes:    rw.SentBytes,
+					reqBytes: max(r.ContentLength, 0),
+					failed:   rw.SentErr != nil,
+				}
+				if body != nil {
+					e.reqBytes = body.n
+				}
+				if ip, err := getIPFromRequest(r); err == nil {
+					e.clientIP = ip
+				}
+				// Panicking requests that were not written are
+				// answered with a 500 by the server.
+				if !completed {
+					e.failed = true
+					if !rw.Written() {
+						e.status = http.StatusInternalServerError
+					}
+				}
+				if e.status == 0 {
+					e.status = http.StatusOK
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+				if _, err := cfg.Writer.Write(format(e)); err != nil && cfg.Logger != nil {
+					cfg.Logger.Error(r.Context(), "access_log_write_error", err)
+				}
+			}()
+
+			next.ServeHTTP(rw.Wrap(), r)
+			completed = true
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// accessLogEntry holds the fields of an access log.
+type accessLogEntry struct {
+	r        *http.Request
+	start    time.Time
+	duration time.Duration
+	clientIP string
+	status   int
+	bytes    int64
+	reqBytes int64
+	failed   bool
+}
+
+// common returns the entry in the Common Log Format, or in
+// the Combined Log Format if combined is true.
+func (e accessLogEntry) common(combined bool) []byte {
+	user := "-"
+	if e.r.URL.User != nil && e.r.URL.User.Username() != "" {
+		user = e.r.URL.User.Username()
+	} else if u, _, ok := e.r.BasicAuth(); ok && u != "" {
+		user = u
+	}
+	size := "-"
+	if e.bytes > 0 {
+		size = strconv.FormatInt(e.bytes, 10)
+	}
+
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "%s - %s [%s] %s %d %s",
+		accessLogField(e.clientIP),
+		accessLogField(user),
+		e.start.Format(commonLogTimeFormat),
+		strconv.Quote(fmt.Sprintf("%s %s %s", e.r.Method, requestURI(e.r), e.r.Proto)),
+		e.status,
+		size,
+	)
+	if combined {
+		fmt.Fprintf(b, " %s %s",
+			strconv.Quote(cmp.Or(e.r.Referer(), "-")),
+			strconv.Quote(cmp.Or(e.r.UserAgent(), "-")),
+		)
+	}
+	b.WriteByte('\n')
+
+	return b.Bytes()
+}
+
+// ecsAccessLog is an ECS access log.
+type ecsAccessLog struct {
+	Timestamp string `json:"@timestamp"`
+	ECS       struct {
+		Version string `json:"version"`
+	} `json:"ecs"`
+	Event struct {
+		Kind     string   `json:"kind"`
+		Category []string `json:"category"`
+		Type     []string `json:"type"`
+		Outcome  string   `json:"outcome"`
+		Duration int64    `json:"duration"`
+	} `json:"event"`
+	HTTP struct {
+		Version string `json:"version,omitempty"`
+		Request struct {
+			Method   string `json:"method"`
+			Referrer string `json:"referrer,omitempty"`
+			Body     struct {
+				Bytes int64 `json:"bytes"`
+			} `json:"body"`
+		} `json:"request"`
+		Response struct {
+			StatusCode int `json:"status_code"`
+			Body       struct {
+				Bytes int64 `json:"bytes"`
+			} `json:"body"`
+		} `json:"response"`
+	} `json:"http"`
+	URL struct {
+		Original string `json:"original"`
+		Path     string `json:"path"`
+		Query    string `json:"query,omitempty"`
+	} `json:"url"`
+	Client struct {
+		IP string `json:"ip,omitempty"`
+	} `json:"client"`
+	UserAgent struct {
+		Original string `json:"original,omitempty"`
+	} `json:"user_agent,omitzero"`
+}
+
+// ecs returns the entry as an ECS JSON line.
+func (e accessLogEntry) ecs() []byte {
+	l := ecsAccessLog{Timestamp: e.start.UTC().Format(time.RFC3339Nano)}
+	l.ECS.Version = ECS_VERSION
+	l.Event.Kind = "event"
+	l.Event.Category = []string{"web"}
+	l.Event.Type = []string{"access"}
+	l.Event.Outcome = "success"
+	if e.failed {
+		l.Event.Outcome = "failure"
+	}
+	l.Event.Duration = e.duration.Nanoseconds()
+	l.HTTP.Version = strings.TrimPrefix(e.r.Proto, "HTTP/")
+	l.HTTP.Request.Method = e.r.Method
+	l.HTTP.Request.Referrer = e.r.Referer()
+	l.HTTP.Request.Body.Bytes = e.reqBytes
+	l.HTTP.Response.StatusCode = e.status
+	l.HTTP.Response.Body.Bytes = e.bytes
+	l.URL.Original = requestURI(e.r)
+	l.URL.Path = e.r.URL.Path
+	l.URL.Query = e.r.URL.RawQuery
+	l.Client.IP = e.clientIP
+	l.UserAgent.Original = e.r.UserAgent()
+
+	b, _ := json.Marshal(l)
+	return append(b, '\n')
+}
+
+// requestURI returns the unmodified request target of r.
+func requestURI(r *http.Request) string {
+	if r.RequestURI != "" {
+		return r.RequestURI
+	}
+
+	return r.URL.RequestURI()
+}
+
+// accessLogField returns "-" if s is empty, otherwise s with its
+// spaces and control characters escaped, so it doesn't break the
+// space separated fields of the line.
+func accessLogField(s string) string {
+	if s == "" {
+		return "-"
+	}
+	q := strconv.Quote(s)
+	q = q[1 : len(q)-1]
+
+	return strings.ReplaceAll(q, " ", `\x20`)
+}
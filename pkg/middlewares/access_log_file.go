@@ -0,0 +1,120 @@
+package middlewares
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// AccessLogFile is an io.Writer that appends to a file which can be
+// reopened, so log rotation tools (i.e logrotate) can move the file
+// and signal the process to write to a new one.
+type AccessLogFile struct {
+	path string
+
+	mu     sync.Mutex
+	f      *os.File
+	closed bool
+}
+
+// OpenAccessLogFile opens (or creates) the file at path
+// in append mode.
+func OpenAccessLogFile(path string) (*AccessLogFile, error) {
+	f := &AccessLogFile{path: path}
+	if err := f.Reopen(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Write appends b to the file.
+func (f *AccessLogFile) Write(b []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.f == nil {
+		return 0, os.ErrClosed
+	}
+
+	return f.f.Write(b)
+}
+
+// Reopen closes the file and opens it again, creating it if it was
+// moved. The previous file is kept if the file can't be opened. It
+// returns os.ErrClosed once the file has been closed.
+func (f *AccessLogFile) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return os.ErrClosed
+	}
+
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if f.f != nil {
+		f.f.Close()
+	}
+	f.f = file
+
+	return nil
+}
+
+// Close closes the file, writes and reopens fail once it's closed.
+func (f *AccessLogFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return os.ErrClosed
+	}
+	f.closed = true
+	err := f.f.Close()
+	f.f = nil
+
+	return err
+}
+
+// ReopenOnSignal reopens the file every time the process receives one
+// of the signals, which defaults to SIGHUP. The errors reopening the
+// file are sent to onErr when it's not nil, signals received after Close
+// don't reopen it (os.ErrClosed is sent instead). It returns a function
+// that stops reopening the file.
+//
+// Example:
+//
+//	stop := f.ReopenOnSignal(nil)
+//	defer stop()
+func (f *AccessLogFile) ReopenOnSignal(onErr func(error), sigs ...os.Signal) (stop func()) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGHUP}
+	}
+
+	c := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(c, sigs...)
+	go func() {
+		for {
+			select {
+			case <-c:
+				if err := f.Reopen(); err != nil && onErr != nil {
+					onErr(err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	once := sync.Once{}
+	return func() {
+		once.Do(func() {
+			signal.Stop(c)
+			close(done)
+		})
+	}
+}
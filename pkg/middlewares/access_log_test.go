@@ -0,0 +1,170 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestAccessLogMdw(t *testing.T) {
+	type TestCase struct {
+		Name   string
+		Format AccessLogFormat
+		Path   string
+		Want   string
+	}
+
+	testCases := []TestCase{}
+	testCases = append(testCases, TestCase{
+		Name:   "common log format should be written",
+		Format: ACCESS_LOG_COMMON,
+		Path:   "/users/1?page=2",
+		Want:   `^1\.1\.1\.1 - betsi \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /users/1\?page=2 HTTP/1\.1" 200 5\n$`,
+	})
+	testCases = append(testCases, TestCase{
+		Name:   "combined log format should be written",
+		Format: ACCESS_LOG_COMBINED,
+		Path:   "/users/1",
+		Want:   `^1\.1\.1\.1 - betsi \[.+\] "GET /users/1 HTTP/1\.1" 200 5 "http://example\.com/" "test \\"agent\\""\n$`,
+	})
+	testCases = append(testCases, TestCase{
+		Name:   "empty responses should log no size",
+		Format: ACCESS_LOG_COMMON,
+		Path:   "/empty",
+		Want:   `^1\.1\.1\.1 - betsi \[.+\] "GET /empty HTTP/1\.1" 204 -\n$`,
+	})
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			b := &bytes.Buffer{}
+			r := chi.NewRouter()
+			r.Use(NewAccessLogMdw(AccessLogConfig{Writer: b, Format: tc.Format}))
+			r.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("hello"))
+			})
+			r.Get("/empty", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, tc.Path, nil)
+			req.RemoteAddr = "1.1.1.1:1234"
+			req.SetBasicAuth("betsi", "secret")
+			req.Header.Set("Referer", "http://example.com/")
+			req.Header.Set("User-Agent", `test "agent"`)
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			if !regexp.MustCompile(tc.Want).MatchString(b.String()) {
+				t.Errorf("got %q, want it to match %q", b.String(), tc.Want)
+			}
+		})
+	}
+}
+
+func TestAccessLogMdwECS(t *testing.T) {
+	b := &bytes.Buffer{}
+	r := chi.NewRouter()
+	r.Use(NewAccessLogMdw(AccessLogConfig{Writer: b, Format: ACCESS_LOG_ECS}))
+	r.Post("/users", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte("conflict"))
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/users?dry=true", strings.NewReader("hello"))
+	req.RemoteAddr = "1.1.1.1:1234"
+	req.Header.Set("User-Agent", "test-agent")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	var got ecsAccessLog
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatalf("got invalid json %q: %v", b.String(), err)
+	}
+	if got.Event.Outcome != "failure" ||
+		got.HTTP.Request.Method != http.MethodPost ||
+		got.HTTP.Request.Body.Bytes != 5 ||
+		got.HTTP.Response.StatusCode != http.StatusConflict ||
+		got.HTTP.Response.Body.Bytes != 8 ||
+		got.URL.Original != "/users?dry=true" ||
+		got.URL.Query != "dry=true" ||
+		got.Client.IP != "1.1.1.1" ||
+		got.UserAgent.Original != "test-agent" {
+		t.Errorf("got unexpected log %s", b.String())
+	}
+}
+
+func TestAccessLogFileReopen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	f, err := OpenAccessLogFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	f.Write([]byte("first\n"))
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	// Writes go to the moved file until it's reopened.
+	f.Write([]byte("second\n"))
+	if err := f.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("third\n"))
+
+	rotated, _ := os.ReadFile(path + ".1")
+	current, _ := os.ReadFile(path)
+	if string(rotated) != "first\nsecond\n" || string(current) != "third\n" {
+		t.Errorf("got rotated %q and current %q", rotated, current)
+	}
+}
+
+func TestAccessLogFileClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	f, err := OpenAccessLogFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error, 1)
+	stop := f.ReopenOnSignal(func(err error) { errs <- err })
+	defer stop()
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(path)
+
+	p, _ := os.FindProcess(os.Getpid())
+	if err := p.Signal(syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errs:
+		if err != os.ErrClosed {
+			t.Errorf("got signal reopen error %v, want %v", err, os.ErrClosed)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("file not reopened on signal")
+	}
+
+	if err := f.Reopen(); err != os.ErrClosed {
+		t.Errorf("got reopen error %v, want %v", err, os.ErrClosed)
+	}
+	if _, err := f.Write([]byte("closed\n")); err != os.ErrClosed {
+		t.Errorf("got write error %v, want %v", err, os.ErrClosed)
+	}
+	if err := f.Close(); err != os.ErrClosed {
+		t.Errorf("got close error %v, want %v", err, os.ErrClosed)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("got file %s reopened after being closed", path)
+	}
+}
@@ -0,0 +1,258 @@
+package middlewares
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// clientIPCtxKey is the context key of the client IP.
+type clientIPCtxKey struct{}
+
+// ClientIPHeader is a forwarding header written by the trusted proxies.
+type ClientIPHeader string
+
+const (
+	// CLIENT_IP_X_FORWARDED_FOR is the X-Forwarded-For header.
+	CLIENT_IP_X_FORWARDED_FOR ClientIPHeader = "X-Forwarded-For"
+
+	// CLIENT_IP_FORWARDED is the Forwarded header (RFC 7239).
+	CLIENT_IP_FORWARDED ClientIPHeader = "Forwarded"
+
+	// CLIENT_IP_X_REAL_IP is the X-Real-Ip header, which
+	// holds a single IP set by the trusted proxy.
+	CLIENT_IP_X_REAL_IP ClientIPHeader = "X-Real-Ip"
+)
+
+// ClientIPConfig is the configuration for the client IP resolver.
+type ClientIPConfig struct {
+	// TrustedProxies are the IPs and CIDRs (i.e "10.0.0.0/8") of the
+	// proxies whose forwarding headers are trusted. When empty, the
+	// forwarding headers are ignored and the client IP is the remote
+	// address of the connection.
+	TrustedProxies []string
+
+	// Header is the forwarding header the trusted proxies write, the
+	// other ones are ignored as they may have been sent by the client.
+	// Defaults to [CLIENT_IP_X_FORWARDED_FOR].
+	Header ClientIPHeader
+}
+
+// ClientIPResolver resolves the IP of the client that sent a request.
+//
+// When the request comes from a trusted proxy, the hops of the configured
+// header (X-Forwarded-For by default) are walked from right to left
+// skipping the trusted proxies, so the client IP is the first hop that
+// was not added by a trusted proxy. Clients can't spoof their IP, as the
+// hops they send are only reached when every proxy after them is trusted,
+// and the headers the proxies don't write are never read.
+type ClientIPResolver struct {
+	trusted []netip.Prefix
+	header  ClientIPHeader
+}
+
+// NewClientIPResolver returns a new client IP resolver. It panics
+// when a trusted proxy is not a valid IP or CIDR, or the header
+// is unknown.
+func NewClientIPResolver(cfg ClientIPConfig) *ClientIPResolver {
+	switch cfg.Header {
+	case "":
+		cfg.Header = CLIENT_IP_X_FORWARDED_FOR
+	case CLIENT_IP_X_FORWARDED_FOR, CLIENT_IP_FORWARDED, CLIENT_IP_X_REAL_IP:
+	default:
+		panic("unknown client ip header " + string(cfg.Header))
+	}
+
+	res := &ClientIPResolver{header: cfg.Header}
+	for _, proxy := range cfg.TrustedProxies {
+		prefix, err := parsePrefix(proxy)
+		if err != nil {
+			panic("invalid trusted proxy " + proxy)
+		}
+		res.trusted = append(res.trusted, prefix)
+	}
+
+	return res
+}
+
+// Resolve returns the IP of the client that sent r. It fails
+// when the remote address of r is not a valid IP address.
+func (res *ClientIPResolver) Resolve(r *http.Request) (string, error) {
+	remote, err := remoteAddr(r)
+	if err != nil {
+		return "", err
+	}
+	if !res.isTrusted(remote) {
+		return remote.String(), nil
+	}
+
+	var hops []string
+	switch res.header {
+	case CLIENT_IP_FORWARDED:
+		hops = forwardedFor(r.Header.Values("Forwarded"))
+	case CLIENT_IP_X_REAL_IP:
+		if v := r.Header.Get("X-Real-Ip"); v != "" {
+			hops = []string{strings.TrimSpace(v)}
+		}
+	default:
+		for _, v := range r.Header.Values("X-Forwarded-For") {
+			for hop := range strings.SplitSeq(v, ",") {
+				hops = append(hops, strings.TrimSpace(hop))
+			}
+		}
+	}
+
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := parseHop(hops[i])
+		if err != nil {
+			// Hops before an invalid one (i.e "unknown") can't be
+			// attributed, the trusted proxy that added it is used.
+			break
+		}
+		client = addr
+		if !res.isTrusted(addr) {
+			break
+		}
+	}
+
+	return client.String(), nil
+}
+
+// isTrusted returns true if addr is a trusted proxy.
+func (res *ClientIPResolver) isTrusted(addr netip.Addr) bool {
+	for _, prefix := range res.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NewClientIPMdw creates a new middleware that resolves the client IP
+// of every request with res and stores it within the request context,
+// where the rate limiting and request logging middlewares read it from.
+// It has to be added before them. See [ClientIPFromContext].
+//
+// Requests whose remote address is not a valid IP address are passed
+// through without a client IP.
+//
+// Example:
+//
+//	r.Use(middlewares.NewClientIPMdw(middlewares.NewClientIPResolver(middlewares.ClientIPConfig{
+//		TrustedProxies: []string{"10.0.0.0/8"},
+//	})))
+func NewClientIPMdw(res *ClientIPResolver) func(next http.Handler) http.Handler {
+	if res == nil {
+		panic("resolver cannot be nil")
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip, err := res.Resolve(r)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), clientIPCtxKey{}, ip)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// ClientIPFromContext returns the client IP stored by [NewClientIPMdw].
+func ClientIPFromContext(ctx context.Context) (string, bool) {
+	ip, ok := ctx.Value(clientIPCtxKey{}).(string)
+	return ip, ok
+}
+
+// getIPFromRequest returns the client IP stored within the request
+// context or, when there's none, the remote address of the request.
+// Forwarding headers are only trusted through a [ClientIPResolver].
+func getIPFromRequest(r *http.Request) (string, error) {
+	if ip, ok := ClientIPFromContext(r.Context()); ok {
+		return ip, nil
+	}
+
+	addr, err := remoteAddr(r)
+	if err != nil {
+		return "", err
+	}
+
+	return addr.String(), nil
+}
+
+// remoteAddr returns the IP address of the remote address of r.
+func remoteAddr(r *http.Request) (netip.Addr, error) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+
+	return addr.Unmap(), nil
+}
+
+// forwardedFor returns the "for" parameters of the elements of the
+// Forwarded header values, in order.
+func forwardedFor(values []string) []string {
+	hops := []string{}
+	for _, v := range values {
+		for element := range strings.SplitSeq(v, ",") {
+			for pair := range strings.SplitSeq(element, ";") {
+				k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(k, "for") {
+					hops = append(hops, strings.Trim(v, `"`))
+				}
+			}
+		}
+	}
+
+	return hops
+}
+
+// parseHop parses the IP address of a forwarding header hop, which
+// may have a port and, when it is an IPv6 address, brackets.
+func parseHop(hop string) (netip.Addr, error) {
+	if strings.HasPrefix(hop, "[") {
+		end := strings.Index(hop, "]")
+		if end < 0 {
+			return netip.Addr{}, net.InvalidAddrError(hop)
+		}
+		hop = hop[1:end]
+	} else if host, _, err := net.SplitHostPort(hop); err == nil {
+		hop = host
+	}
+
+	addr, err := netip.ParseAddr(hop)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+
+	return addr.Unmap(), nil
+}
+
+// parsePrefix parses a CIDR or a single IP address as a prefix.
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return prefix.Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
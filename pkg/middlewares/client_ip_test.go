@@ -0,0 +1,151 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientIPResolver(t *testing.T) {
+	type TestCase struct {
+		Name           string
+		TrustedProxies []string
+		ClientIPHeader ClientIPHeader
+		RemoteAddr     string
+		Header         http.Header
+		Want           string
+		WantErr        bool
+	}
+
+	testCases := []TestCase{}
+	testCases = append(testCases, TestCase{
+		Name:       "untrusted remote should ignore the headers",
+		RemoteAddr: "1.1.1.1:1234",
+		Header: http.Header{
+			"X-Real-Ip":       {"2.2.2.2"},
+			"X-Forwarded-For": {"3.3.3.3"},
+		},
+		Want: "1.1.1.1",
+	})
+	testCases = append(testCases, TestCase{
+		Name:           "x-forwarded-for should be parsed from right to left",
+		TrustedProxies: []string{"10.0.0.0/8"},
+		RemoteAddr:     "10.0.0.1:1234",
+		Header:         http.Header{"X-Forwarded-For": {"6.6.6.6, 1.1.1.1", "10.0.0.2"}},
+		Want:           "1.1.1.1",
+	})
+	testCases = append(testCases, TestCase{
+		Name:           "every hop trusted should be the leftmost hop",
+		TrustedProxies: []string{"10.0.0.0/8"},
+		RemoteAddr:     "10.0.0.1:1234",
+		Header:         http.Header{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}},
+		Want:           "10.0.0.3",
+	})
+	testCases = append(testCases, TestCase{
+		Name:           "invalid hop should stop at the proxy that added it",
+		TrustedProxies: []string{"10.0.0.0/8"},
+		RemoteAddr:     "10.0.0.1:1234",
+		Header:         http.Header{"X-Forwarded-For": {"1.1.1.1, unknown, 10.0.0.2"}},
+		Want:           "10.0.0.2",
+	})
+	testCases = append(testCases, TestCase{
+		Name:           "forwarded should be used when configured",
+		TrustedProxies: []string{"10.0.0.1", "2001:db8::/32"},
+		ClientIPHeader: CLIENT_IP_FORWARDED,
+		RemoteAddr:     "10.0.0.1:1234",
+		Header: http.Header{
+			"Forwarded":       {`for=6.6.6.6, For="[2001:db8:cafe::17]:4711";proto=https, for=2001:db8::1`},
+			"X-Forwarded-For": {"3.3.3.3"},
+		},
+		Want: "6.6.6.6",
+	})
+	testCases = append(testCases, TestCase{
+		Name:           "x-real-ip should be used when configured",
+		TrustedProxies: []string{"10.0.0.1"},
+		ClientIPHeader: CLIENT_IP_X_REAL_IP,
+		RemoteAddr:     "10.0.0.1:1234",
+		Header: http.Header{
+			"X-Real-Ip":       {"1.1.1.1"},
+			"X-Forwarded-For": {"3.3.3.3"},
+		},
+		Want: "1.1.1.1",
+	})
+	testCases = append(testCases, TestCase{
+		Name:           "forwarded sent by the client should be ignored",
+		TrustedProxies: []string{"10.0.0.1"},
+		RemoteAddr:     "10.0.0.1:1234",
+		Header: http.Header{
+			"Forwarded":       {"for=6.6.6.6"},
+			"X-Forwarded-For": {"1.1.1.1"},
+		},
+		Want: "1.1.1.1",
+	})
+	testCases = append(testCases, TestCase{
+		Name:           "x-real-ip should be ignored by default",
+		TrustedProxies: []string{"10.0.0.1"},
+		RemoteAddr:     "10.0.0.1:1234",
+		Header:         http.Header{"X-Real-Ip": {"6.6.6.6"}},
+		Want:           "10.0.0.1",
+	})
+	testCases = append(testCases, TestCase{
+		Name:       "ipv4 mapped addresses should be unmapped",
+		RemoteAddr: "[::ffff:1.1.1.1]:1234",
+		Want:       "1.1.1.1",
+	})
+	testCases = append(testCases, TestCase{
+		Name:       "invalid remote address should fail",
+		RemoteAddr: "pipe",
+		WantErr:    true,
+	})
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			res := NewClientIPResolver(ClientIPConfig{
+				TrustedProxies: tc.TrustedProxies,
+				Header:         tc.ClientIPHeader,
+			})
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tc.RemoteAddr
+			if tc.Header != nil {
+				r.Header = tc.Header
+			}
+
+			got, err := res.Resolve(r)
+			if (err != nil) != tc.WantErr {
+				t.Fatalf("got error %v, want error %v", err, tc.WantErr)
+			}
+			if got != tc.Want {
+				t.Errorf("got ip %q, want %q", got, tc.Want)
+			}
+		})
+	}
+}
+
+func TestClientIPMdw(t *testing.T) {
+	res := NewClientIPResolver(ClientIPConfig{TrustedProxies: []string{"10.0.0.0/8"}})
+	rl := NewRateLimitMdwWithJSONError(RateLimitConfig{
+		Store:  NewMemoryRateLimitStore(MemoryRateLimitStoreConfig{}),
+		Metric: time.Minute,
+		Limit:  1,
+	})
+
+	var got string
+	h := NewClientIPMdw(res)(rl(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = ClientIPFromContext(r.Context())
+	})))
+
+	for i, ip := range []string{"1.1.1.1", "2.2.2.2"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-Forwarded-For", ip)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("request %d got status %d, want %d", i, w.Code, http.StatusOK)
+		}
+		if got != ip {
+			t.Errorf("request %d got client ip %q, want %q", i, got, ip)
+		}
+	}
+}
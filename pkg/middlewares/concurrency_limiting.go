@@ -0,0 +1,405 @@
+package middlewares
+
+import (
+	"container/list"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/iolave/go-betsi/internal/utils"
+	"github.com/iolave/go-errors"
+	"github.com/iolave/go-logger"
+)
+
+const (
+	// DEFAULT_CONCURRENCY_QUEUE_TIMEOUT is the default time a request
+	// waits within the queue before being shed.
+	DEFAULT_CONCURRENCY_QUEUE_TIMEOUT = 100 * time.Millisecond
+
+	// DEFAULT_CONCURRENCY_RETRY_AFTER is the default Retry-After
+	// of shed requests.
+	DEFAULT_CONCURRENCY_RETRY_AFTER = time.Second
+
+	// DEFAULT_CONCURRENCY_BACKOFF is the default ratio the limit is
+	// multiplied by when the [CONCURRENCY_LIMIT_AIMD] algorithm
+	// observes a slow request.
+	DEFAULT_CONCURRENCY_BACKOFF = 0.9
+
+	// DEFAULT_CONCURRENCY_SMOOTHING is the default weight of a new
+	// limit computed by the [CONCURRENCY_LIMIT_GRADIENT] algorithm.
+	DEFAULT_CONCURRENCY_SMOOTHING = 0.2
+
+	// DEFAULT_CONCURRENCY_LONG_WINDOW is the default number of requests
+	// the [CONCURRENCY_LIMIT_GRADIENT] long term latency is averaged over.
+	DEFAULT_CONCURRENCY_LONG_WINDOW = 600
+)
+
+// ConcurrencyLimitAlgorithm is the algorithm that adapts the global
+// limit of the concurrency limiting middleware to the observed latency.
+type ConcurrencyLimitAlgorithm string
+
+const (
+	// CONCURRENCY_LIMIT_AIMD increases the limit by one when a request
+	// completes within the latency threshold while the limit is being
+	// used, and multiplies it by the backoff ratio otherwise (additive
+	// increase, multiplicative decrease).
+	CONCURRENCY_LIMIT_AIMD ConcurrencyLimitAlgorithm = "aimd"
+
+	// CONCURRENCY_LIMIT_GRADIENT compares the latency of every request
+	// with the long term average latency, the limit shrinks as the
+	// latency grows (queueing within the service) and grows otherwise.
+	CONCURRENCY_LIMIT_GRADIENT ConcurrencyLimitAlgorithm = "gradient"
+)
+
+// AdaptiveConcurrencyConfig is the configuration to adapt the global
+// limit of the concurrency limiting middleware.
+type AdaptiveConcurrencyConfig struct {
+	// Algorithm is the algorithm that adapts the limit. Defaults
+	// to [CONCURRENCY_LIMIT_AIMD].
+	Algorithm ConcurrencyLimitAlgorithm
+
+	// MinLimit and MaxLimit bound the limit. They default to 1
+	// and to ten times the initial limit.
+	MinLimit int
+	MaxLimit int
+
+	// LatencyThreshold is the latency above which the
+	// [CONCURRENCY_LIMIT_AIMD] algorithm decreases the limit.
+	// Required by the [CONCURRENCY_LIMIT_AIMD] algorithm.
+	LatencyThreshold time.Duration
+
+	// Backoff is the ratio the [CONCURRENCY_LIMIT_AIMD] algorithm
+	// multiplies the limit by. Defaults to DEFAULT_CONCURRENCY_BACKOFF.
+	Backoff float64
+
+	// Smoothing is the weight of the limits computed by the
+	// [CONCURRENCY_LIMIT_GRADIENT] algorithm against the current
+	// one. Defaults to DEFAULT_CONCURRENCY_SMOOTHING.
+	Smoothing float64
+
+	// LongWindow is the number of requests the long term latency of
+	// the [CONCURRENCY_LIMIT_GRADIENT] algorithm is averaged over.
+	// Defaults to DEFAULT_CONCURRENCY_LONG_WINDOW.
+	LongWindow int
+}
+
+// ConcurrencyLimitConfig is the configuration for the concurrency
+// limiting middleware.
+type ConcurrencyLimitConfig struct {
+	// Limit is the maximum number of requests handled concurrently,
+	// when Adaptive is set it is the initial limit. Zero means no
+	// global limit.
+	Limit int
+
+	// RouteLimits are the maximum number of requests handled
+	// concurrently by the routes whose pattern (i.e "/users/{id}") or
+	// method and pattern (i.e "POST /users") is a key of the map, the
+	// latter takes precedence. They apply along with Limit.
+	RouteLimits map[string]int
+
+	// QueueSize is the maximum number of requests waiting for a slot
+	// of every limit, requests are shed when the queue is full. Zero
+	// means requests are shed as soon as the limit is reached.
+	QueueSize int
+
+	// QueueTimeout is the maximum time a request waits within the
+	// queue. Defaults to DEFAULT_CONCURRENCY_QUEUE_TIMEOUT.
+	QueueTimeout time.Duration
+
+	// Adaptive adapts the global limit to the observed latency
+	// when set.
+	Adaptive *AdaptiveConcurrencyConfig
+
+	// RetryAfter is sent within the Retry-After header of shed
+	// requests. Defaults to DEFAULT_CONCURRENCY_RETRY_AFTER.
+	RetryAfter time.Duration
+
+	// ErrorHandler writes the 503 error responses. Defaults to writing
+	// them as the router's SendJSONError does, with the trace headers
+	// and the "application/json" content type.
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, err *errors.HTTPError)
+
+	// Logger is an optional logger to use for logging shed requests.
+	Logger logger.Logger
+}
+
+// NewConcurrencyLimitMdw creates a new middleware that limits the number
+// of requests handled concurrently, globally and per route, to protect
+// the service from overload.
+//
+// Requests over the limit wait within a FIFO queue for up to
+// config.QueueTimeout, requests that don't fit within the queue or time
+// out are shed with a 503 JSON error along with the Retry-After header.
+// Requests whose context is canceled while queued are dropped without a
+// response.
+//
+// It panics when the configuration is invalid.
+//
+// Example:
+//
+//	r.Use(middlewares.NewConcurrencyLimitMdw(middlewares.ConcurrencyLimitConfig{
+//		Limit:        200,
+//		RouteLimits:  map[string]int{"POST /reports": 4},
+//		QueueSize:    100,
+//		QueueTimeout: 50 * time.Millisecond,
+//		Adaptive: &middlewares.AdaptiveConcurrencyConfig{
+//			LatencyThreshold: 250 * time.Millisecond,
+//		},
+//	}))
+func NewConcurrencyLimitMdw(config ConcurrencyLimitConfig) func(next http.Handler) http.Handler {
+	if config.Limit < 0 {
+		panic("limit cannot be negative")
+	}
+	if config.Limit == 0 && len(config.RouteLimits) == 0 {
+		panic("limit or route limits are required")
+	}
+	if config.Adaptive != nil && config.Limit == 0 {
+		panic("adaptive concurrency requires a limit")
+	}
+	if config.QueueTimeout <= 0 {
+		config.QueueTimeout = DEFAULT_CONCURRENCY_QUEUE_TIMEOUT
+	}
+	if config.RetryAfter <= 0 {
+		config.RetryAfter = DEFAULT_CONCURRENCY_RETRY_AFTER
+	}
+	if config.ErrorHandler == nil {
+		config.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err *errors.HTTPError) {
+			utils.WriteHTTPError(r.Context(), w, err)
+		}
+	}
+
+	var global *concurrencyLimiter
+	if config.Limit > 0 {
+		global = newConcurrencyLimiter(config.Limit, config.QueueSize)
+		if config.Adaptive != nil {
+			global.adaptive = newConcurrencyAdapter(*config.Adaptive, config.Limit)
+		}
+	}
+	routes := map[string]*concurrencyLimiter{}
+	for route, limit := range config.RouteLimits {
+		if limit <= 0 {
+			panic("route limit of " + route + " has to be greater than zero")
+		}
+		routes[route] = newConcurrencyLimiter(limit, config.QueueSize)
+	}
+	retryAfter := strconv.FormatInt(int64(math.Ceil(config.RetryAfter.Seconds())), 10)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limiters := make([]*concurrencyLimiter, 0, 2)
+			if len(routes) > 0 {
+				if l, ok := routeValue(routes, r); ok {
+					limiters = append(limiters, l)
+				}
+			}
+			if global != nil {
+				limiters = append(limiters, global)
+			}
+
+			deadline := time.Now().Add(config.QueueTimeout)
+			for i, l := range limiters {
+				err := l.acquire(r, deadline)
+				if err == nil {
+					continue
+				}
+				for _, acquired := range limiters[:i] {
+					acquired.release(0)
+				}
+				if r.Context().Err() != nil {
+					// The client is gone, there's no one to respond to.
+					return
+				}
+
+				w.Header().Set("Retry-After", retryAfter)
+				config.ErrorHandler(w, r, err)
+				if config.Logger != nil {
+					config.Logger.Error(r.Context(), "request_shed_error", err)
+				}
+				return
+			}
+
+			start := time.Now()
+			defer func() {
+				latency := time.Since(start)
+				for _, l := range limiters {
+					l.release(latency)
+				}
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// concurrencyLimiter limits the number of concurrent requests.
+type concurrencyLimiter struct {
+	queueSize int
+	adaptive  *concurrencyAdapter
+
+	mu       sync.Mutex
+	limit    float64
+	inflight int
+
+	// waiters are the queued requests, in arrival order.
+	waiters *list.List
+}
+
+// concurrencyWaiter is a queued request, ready is closed once
+// it acquires a slot.
+type concurrencyWaiter struct {
+	ready chan struct{}
+}
+
+// newConcurrencyLimiter returns a new limiter of limit requests.
+func newConcurrencyLimiter(limit, queueSize int) *concurrencyLimiter {
+	return &concurrencyLimiter{
+		queueSize: queueSize,
+		limit:     float64(limit),
+		waiters:   list.New(),
+	}
+}
+
+// acquire acquires a slot, waiting within the queue until deadline if
+// there's none. It returns a 503 error if the request is shed.
+func (l *concurrencyLimiter) acquire(r *http.Request, deadline time.Time) *errors.HTTPError {
+	l.mu.Lock()
+	if l.inflight < l.currentLimit() && l.waiters.Len() == 0 {
+		l.inflight++
+		l.mu.Unlock()
+		return nil
+	}
+	if l.waiters.Len() >= l.queueSize {
+		l.mu.Unlock()
+		return errors.NewServiceUnavailableError("server is overloaded", nil).(*errors.HTTPError)
+	}
+	waiter := &concurrencyWaiter{ready: make(chan struct{})}
+	el := l.waiters.PushBack(waiter)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	select {
+	case <-waiter.ready:
+		return nil
+	case <-timer.C:
+	case <-r.Context().Done():
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	select {
+	case <-waiter.ready:
+		// The slot was granted while giving up, it's kept.
+		return nil
+	default:
+	}
+	l.waiters.Remove(el)
+
+	return errors.NewServiceUnavailableError("server is overloaded", nil).(*errors.HTTPError)
+}
+
+// release releases a slot, where latency is the latency of the request
+// that held it (zero if it was not handled), and grants the free slots
+// to the queued requests.
+func (l *concurrencyLimiter) release(latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	inflight := l.inflight
+	l.inflight--
+	if l.adaptive != nil && latency > 0 {
+		l.limit = l.adaptive.update(l.limit, inflight, latency)
+	}
+
+	for l.waiters.Len() > 0 && l.inflight < l.currentLimit() {
+		waiter := l.waiters.Remove(l.waiters.Front()).(*concurrencyWaiter)
+		l.inflight++
+		close(waiter.ready)
+	}
+}
+
+// currentLimit returns the limit as a number of requests, the
+// lock has to be held by the caller.
+func (l *concurrencyLimiter) currentLimit() int {
+	return max(int(l.limit), 1)
+}
+
+// concurrencyAdapter adapts a limit to the observed latency, it is
+// only used while holding the lock of its limiter.
+type concurrencyAdapter struct {
+	cfg AdaptiveConcurrencyConfig
+
+	// longLatency is the exponential moving average of the latency
+	// used by the [CONCURRENCY_LIMIT_GRADIENT] algorithm.
+	longLatency float64
+}
+
+// newConcurrencyAdapter validates cfg, setting its defaults. It
+// panics when cfg is invalid.
+func newConcurrencyAdapter(cfg AdaptiveConcurrencyConfig, limit int) *concurrencyAdapter {
+	if cfg.Algorithm == "" {
+		cfg.Algorithm = CONCURRENCY_LIMIT_AIMD
+	}
+	if cfg.MinLimit <= 0 {
+		cfg.MinLimit = 1
+	}
+	if cfg.MaxLimit <= 0 {
+		cfg.MaxLimit = 10 * limit
+	}
+	if cfg.MinLimit > cfg.MaxLimit {
+		panic("min limit cannot be greater than max limit")
+	}
+
+	switch cfg.Algorithm {
+	case CONCURRENCY_LIMIT_AIMD:
+		if cfg.LatencyThreshold <= 0 {
+			panic("latency threshold has to be greater than zero")
+		}
+		if cfg.Backoff <= 0 || cfg.Backoff >= 1 {
+			cfg.Backoff = DEFAULT_CONCURRENCY_BACKOFF
+		}
+	case CONCURRENCY_LIMIT_GRADIENT:
+		if cfg.Smoothing <= 0 || cfg.Smoothing > 1 {
+			cfg.Smoothing = DEFAULT_CONCURRENCY_SMOOTHING
+		}
+		if cfg.LongWindow <= 0 {
+			cfg.LongWindow = DEFAULT_CONCURRENCY_LONG_WINDOW
+		}
+	default:
+		panic("unknown concurrency limit algorithm " + string(cfg.Algorithm))
+	}
+
+	return &concurrencyAdapter{cfg: cfg}
+}
+
+// update returns the new limit after a request that was handled along
+// with inflight requests (itself included) took latency.
+func (a *concurrencyAdapter) update(limit float64, inflight int, latency time.Duration) float64 {
+	switch a.cfg.Algorithm {
+	case CONCURRENCY_LIMIT_GRADIENT:
+		sample := float64(latency)
+		if a.longLatency == 0 {
+			a.longLatency = sample
+		}
+		alpha := 2 / (float64(a.cfg.LongWindow) + 1)
+		a.longLatency += alpha * (sample - a.longLatency)
+
+		// The gradient is below 1 when the latency grows over the
+		// long term one, the square root of the limit leaves room
+		// to probe for a higher limit.
+		gradient := max(0.5, min(1, a.longLatency/sample))
+		next := limit*gradient + math.Sqrt(limit)
+		limit = limit*(1-a.cfg.Smoothing) + next*a.cfg.Smoothing
+	default:
+		if latency > a.cfg.LatencyThreshold {
+			limit *= a.cfg.Backoff
+		} else if float64(inflight)*2 >= limit {
+			// Only grows while the limit is being used.
+			limit++
+		}
+	}
+
+	return max(float64(a.cfg.MinLimit), min(float64(a.cfg.MaxLimit), limit))
+}
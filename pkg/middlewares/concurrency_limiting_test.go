@@ -0,0 +1,200 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestConcurrencyLimitMdw(t *testing.T) {
+	type TestCase struct {
+		Name   string
+		Config ConcurrencyLimitConfig
+		// Path of the request sent while another request of
+		// /slow/1 is being handled.
+		Path string
+		// Release releases the handled request after the given
+		// time, so a queued request can acquire its slot.
+		Release    time.Duration
+		WantStatus int
+	}
+
+	testCases := []TestCase{}
+	testCases = append(testCases, TestCase{
+		Name:       "requests over the limit should be shed",
+		Config:     ConcurrencyLimitConfig{Limit: 1},
+		Path:       "/fast",
+		WantStatus: http.StatusServiceUnavailable,
+	})
+	testCases = append(testCases, TestCase{
+		Name:       "requests under the limit should be handled",
+		Config:     ConcurrencyLimitConfig{Limit: 2},
+		Path:       "/fast",
+		WantStatus: http.StatusOK,
+	})
+	testCases = append(testCases, TestCase{
+		Name: "queued requests should be handled once a slot is released",
+		Config: ConcurrencyLimitConfig{
+			Limit:        1,
+			QueueSize:    1,
+			QueueTimeout: time.Second,
+		},
+		Path:       "/fast",
+		Release:    20 * time.Millisecond,
+		WantStatus: http.StatusOK,
+	})
+	testCases = append(testCases, TestCase{
+		Name: "queued requests should be shed after the timeout",
+		Config: ConcurrencyLimitConfig{
+			Limit:        1,
+			QueueSize:    1,
+			QueueTimeout: 10 * time.Millisecond,
+		},
+		Path:       "/fast",
+		WantStatus: http.StatusServiceUnavailable,
+	})
+	testCases = append(testCases, TestCase{
+		Name: "route limits should only apply to their routes",
+		Config: ConcurrencyLimitConfig{
+			RouteLimits: map[string]int{"/slow/{id}": 1},
+		},
+		Path:       "/fast",
+		WantStatus: http.StatusOK,
+	})
+	testCases = append(testCases, TestCase{
+		Name: "route limits should shed their routes",
+		Config: ConcurrencyLimitConfig{
+			Limit:       10,
+			RouteLimits: map[string]int{"GET /slow/{id}": 1},
+		},
+		Path:       "/slow/2",
+		WantStatus: http.StatusServiceUnavailable,
+	})
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			started, release := make(chan struct{}), make(chan struct{})
+			r := chi.NewRouter()
+			r.Use(NewConcurrencyLimitMdw(tc.Config))
+			r.Get("/slow/{id}", func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/slow/1" {
+					close(started)
+					<-release
+				}
+			})
+			r.Get("/fast", func(w http.ResponseWriter, r *http.Request) {})
+
+			wg := sync.WaitGroup{}
+			wg.Go(func() {
+				r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow/1", nil))
+			})
+			<-started
+
+			if tc.Release > 0 {
+				time.AfterFunc(tc.Release, func() { close(release) })
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.Path, nil))
+			if tc.Release == 0 {
+				close(release)
+			}
+			wg.Wait()
+
+			if w.Code != tc.WantStatus {
+				t.Fatalf("got status %d, want %d", w.Code, tc.WantStatus)
+			}
+			if w.Code != http.StatusServiceUnavailable {
+				return
+			}
+			if got := w.Header().Get("Retry-After"); got != "1" {
+				t.Errorf("got Retry-After %q, want %q", got, "1")
+			}
+			if got := w.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("got content type %q, want %q", got, "application/json")
+			}
+		})
+	}
+}
+
+func TestConcurrencyAdapter(t *testing.T) {
+	type TestCase struct {
+		Name      string
+		Config    AdaptiveConcurrencyConfig
+		Limit     float64
+		Inflight  int
+		Latencies []time.Duration
+		Want      func(limit float64) bool
+	}
+
+	testCases := []TestCase{}
+	testCases = append(testCases, TestCase{
+		Name:      "aimd should decrease the limit of slow requests",
+		Config:    AdaptiveConcurrencyConfig{LatencyThreshold: time.Second},
+		Limit:     10,
+		Inflight:  10,
+		Latencies: []time.Duration{2 * time.Second},
+		Want:      func(limit float64) bool { return limit == 9 },
+	})
+	testCases = append(testCases, TestCase{
+		Name:      "aimd should increase the limit of used limits",
+		Config:    AdaptiveConcurrencyConfig{LatencyThreshold: time.Second},
+		Limit:     10,
+		Inflight:  5,
+		Latencies: []time.Duration{time.Millisecond},
+		Want:      func(limit float64) bool { return limit == 11 },
+	})
+	testCases = append(testCases, TestCase{
+		Name:      "aimd should keep the limit of unused limits",
+		Config:    AdaptiveConcurrencyConfig{LatencyThreshold: time.Second},
+		Limit:     10,
+		Inflight:  1,
+		Latencies: []time.Duration{time.Millisecond},
+		Want:      func(limit float64) bool { return limit == 10 },
+	})
+	testCases = append(testCases, TestCase{
+		Name:      "aimd should respect the min limit",
+		Config:    AdaptiveConcurrencyConfig{LatencyThreshold: time.Second, MinLimit: 10},
+		Limit:     10,
+		Inflight:  10,
+		Latencies: []time.Duration{2 * time.Second},
+		Want:      func(limit float64) bool { return limit == 10 },
+	})
+	testCases = append(testCases, TestCase{
+		Name:     "gradient should decrease the limit when latency grows",
+		Config:   AdaptiveConcurrencyConfig{Algorithm: CONCURRENCY_LIMIT_GRADIENT, LongWindow: 100},
+		Limit:    100,
+		Inflight: 100,
+		Latencies: []time.Duration{
+			10 * time.Millisecond,
+			10 * time.Millisecond,
+			100 * time.Millisecond,
+			100 * time.Millisecond,
+		},
+		Want: func(limit float64) bool { return limit < 100 },
+	})
+	testCases = append(testCases, TestCase{
+		Name:      "gradient should increase the limit when latency is stable",
+		Config:    AdaptiveConcurrencyConfig{Algorithm: CONCURRENCY_LIMIT_GRADIENT},
+		Limit:     100,
+		Inflight:  100,
+		Latencies: []time.Duration{10 * time.Millisecond, 10 * time.Millisecond},
+		Want:      func(limit float64) bool { return limit > 100 },
+	})
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			a := newConcurrencyAdapter(tc.Config, int(tc.Limit))
+			limit := tc.Limit
+			for _, latency := range tc.Latencies {
+				limit = a.update(limit, tc.Inflight, latency)
+			}
+			if !tc.Want(limit) {
+				t.Errorf("got unexpected limit %v", limit)
+			}
+		})
+	}
+}
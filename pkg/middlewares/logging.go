@@ -2,17 +2,28 @@ package middlewares
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"io"
+	"maps"
+	"mime"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/iolave/go-betsi/internal/utils"
+	"github.com/iolave/go-errors"
 	"github.com/iolave/go-logger"
 )
 
+// DEFAULT_LOG_MAX_BODY_SIZE is the default maximum number of
+// body bytes captured by the request logging middleware.
+const DEFAULT_LOG_MAX_BODY_SIZE int64 = 64 << 10
+
+// TRUNCATED is appended to the logged bodies that exceeded
+// the maximum body size.
+const TRUNCATED = "[TRUNCATED]"
+
 // RequestLoggingMdwConfig holds the configuration for the request logging middleware.
 type RequestLoggingMdwConfig struct {
 	// Logger is the logger to use for logging requests.
@@ -27,9 +38,79 @@ type RequestLoggingMdwConfig struct {
 	// LogQueryParams determines whether to log the request query parameters.
 	LogQueryParams bool
 
-	// LogJSONBody determines whether to log the request body for POST and PUT requests
-	// with "application/json" content type.
+	// LogClientIP determines whether to log the client IP, which is
+	// resolved by [NewClientIPMdw] (or is the remote address of the
+	// request when the middleware is not used).
+	LogClientIP bool
+
+	// LogJSONBody determines whether to log the request body for POST, PUT,
+	// PATCH and DELETE requests with a JSON content type (i.e
+	// "application/json; charset=utf-8" or "application/problem+json").
 	LogJSONBody bool
+
+	// LogJSONResponseBody determines whether to log the response
+	// body, when it has a JSON content type, within the completion
+	// event.
+	LogJSONResponseBody bool
+
+	// MaxBodySize is the maximum number of bytes of the request and
+	// response bodies that are captured to be logged, larger bodies
+	// are logged as a string truncated to MaxBodySize bytes followed by
+	// [TRUNCATED]. Defaults to DEFAULT_LOG_MAX_BODY_SIZE.
+	MaxBodySize int64
+
+	// LogDuration determines whether to log the time it took to handle
+	// the request, in milliseconds, within the completion event.
+	LogDuration bool
+
+	// LogStatus determines whether to log the response status code
+	// within the completion event.
+	LogStatus bool
+
+	// LogResponseSize determines whether to log the number of response
+	// body bytes within the completion event.
+	LogResponseSize bool
+
+	// LogRequestSize determines whether to log the number of request
+	// body bytes within the completion event, which is the content
+	// length or, when it's unknown, the number of bytes read.
+	LogRequestSize bool
+
+	// LogUserAgent determines whether to log the request user agent
+	// within the completion event.
+	LogUserAgent bool
+
+	// LogHeaders determines whether to log the request headers, the
+	// values of the headers redacted by Redaction are masked.
+	LogHeaders bool
+
+	// IncludeRoutes are the routes whose requests are logged, every
+	// route is logged when it's empty. Routes are [path.Match] patterns
+	// of the route patterns, optionally prefixed by a method (i.e
+	// "/users/*" or "GET /users/{id}").
+	IncludeRoutes []string
+
+	// ExcludeRoutes are the routes whose requests are not logged (i.e
+	// "/health"), see IncludeRoutes.
+	ExcludeRoutes []string
+
+	// Sampling samples the successful requests to be logged, failed
+	// requests are always logged. The started event of the requests that
+	// are not sampled is not logged, so only their failed event is.
+	Sampling LogSampling
+
+	// RouteSampling overrides the Sampling of the routes, keyed by
+	// "<method> <pattern>" or "<pattern>" (i.e "GET /users/{id}").
+	RouteSampling map[string]LogSampling
+
+	// DebugRoutes are the routes whose started and succeeded events
+	// are logged at debug level, see IncludeRoutes.
+	DebugRoutes []string
+
+	// Redaction holds the rules used to redact the logged path
+	// params, query params, headers and JSON body. The `log:"redact"`
+	// tags of the route request type are also honored, see [Redaction].
+	Redaction Redaction
 }
 
 // NewRequestLoggingMdw creates a new request logging middleware.
@@ -37,30 +118,62 @@ type RequestLoggingMdwConfig struct {
 // This middleware logs the start, success, or failure of each request.
 // It can be configured to log the request path, path parameters, query parameters, and JSON body.
 // It uses a custom response writer to capture the status code and any errors that occur during the request.
-// The log messages are formatted as "<method>_<path>_<status>".
+// Requests whose handlers panic are logged as failed, see [NewRecoveryMdw].
+// The log messages are formatted as "<method>_<path>_<status>", the
+// completion (succeeded or failed) message can also log the duration,
+// status code, request and response sizes and user agent.
 //
 // Example:
 //
 //	r.Use(middlewares.NewRequestLoggingMdw(middlewares.RequestLoggingMdwConfig{
 //		Logger:         l,
 //		LogPath:        true,
+//		LogClientIP:    true,
 //		LogPathParams:  true,
 //		LogQueryParams: true,
 //		LogJSONBody:    true,
+//		LogDuration:    true,
+//		LogStatus:      true,
+//		Redaction: middlewares.Redaction{
+//			Keys:     []string{"password"},
+//			Paths:    []string{"$.card.number"},
+//			Strategy: middlewares.REDACTION_PARTIAL,
+//		},
 //	}))
 func NewRequestLoggingMdw(cfg RequestLoggingMdwConfig) func(next http.Handler) http.Handler {
 	if cfg.Logger == nil {
 		panic("logger cannot be nil")
 	}
+	cfg.Redaction.validate()
+
+	validateRoutePatterns(cfg.IncludeRoutes)
+	validateRoutePatterns(cfg.ExcludeRoutes)
+	validateRoutePatterns(cfg.DebugRoutes)
+
+	sampler := newLogSampler(cfg.Sampling)
+	routeSamplers := map[string]*logSampler{}
+	for route, sampling := range cfg.RouteSampling {
+		routeSamplers[route] = newLogSampler(sampling)
+	}
+
+	if cfg.MaxBodySize <= 0 {
+		cfg.MaxBodySize = DEFAULT_LOG_MAX_BODY_SIZE
+	}
+
+	types := &typeRedactions{}
 
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
 			// Create a new custom response writer
 			// that stores the sent status code (and error if any)
 			// when writing the header and body.
-			w = &utils.ResponseWriter{
+			rw := &utils.ResponseWriter{
 				Original: w,
 			}
+			if cfg.LogJSONResponseBody {
+				rw.CaptureLimit = cfg.MaxBodySize
+			}
+			w = rw.Wrap()
 
 			l := cfg.Logger
 
@@ -71,22 +184,36 @@ func NewRequestLoggingMdw(cfg RequestLoggingMdwConfig) func(next http.Handler) h
 			// Determine if the request path belongs to a
 			// pattern that has been registered with the router.
 			// If not, we can skip the logging middleware.
-			path := rc.Routes.Find(rc, r.Method, r.URL.Path)
-			if path == "" {
+			pattern := rc.Routes.Find(rc, r.Method, r.URL.Path)
+			if pattern == "" {
 				next.ServeHTTP(w, r)
 				return
 			}
 
-			// Convert the path to lower case and replaces
-			// "/", "-", "{", and "}" with "_".
-			if path[0] == '/' {
-				path = path[1:]
+			if len(cfg.IncludeRoutes) > 0 && !routeMatches(cfg.IncludeRoutes, r.Method, pattern) ||
+				routeMatches(cfg.ExcludeRoutes, r.Method, pattern) {
+				next.ServeHTTP(w, r)
+				return
 			}
-			path = strings.ToLower(path)
-			path = strings.ReplaceAll(path, "/", "_")
-			path = strings.ReplaceAll(path, "-", "_")
-			path = strings.ReplaceAll(path, "{", "")
-			path = strings.ReplaceAll(path, "}", "")
+
+			// sampled is false when the request has to be logged
+			// only if it fails.
+			s, ok := routeSamplers[r.Method+" "+pattern]
+			if !ok {
+				s, ok = routeSamplers[pattern]
+			}
+			if !ok {
+				s = sampler
+			}
+			sampled := s.sample()
+
+			// info logs the started and succeeded events.
+			info := l.InfoWithData
+			if routeMatches(cfg.DebugRoutes, r.Method, pattern) {
+				info = l.DebugWithData
+			}
+
+			path := formatLogPath(pattern)
 
 			// Build the log message for starting the request
 			msg := fmt.Sprintf(
@@ -105,55 +232,124 @@ func NewRequestLoggingMdw(cfg RequestLoggingMdwConfig) func(next http.Handler) h
 				data["path"] = r.URL.Path
 			}
 
+			if cfg.LogClientIP {
+				if ip, err := getIPFromRequest(r); err == nil {
+					data["clientIp"] = ip
+				}
+			}
+
+			// tr are the fields redacted by the route request type.
+			var tr typeRedaction
+			if cfg.LogPathParams || cfg.LogJSONBody {
+				tr = types.get(rc.Routes, r.Method, pattern)
+			}
+
 			if cfg.LogPathParams {
 				pathParams := map[string]string{}
 				for _, k := range rc.URLParams.Keys {
 					pathParams[k] = rc.URLParam(k)
 				}
-				data["pathParams"] = pathParams
+				data["pathParams"] = cfg.Redaction.redactPathParams(pathParams, tr.pathParams)
 			}
 
 			if cfg.LogQueryParams {
-				queryParams := map[string]string{}
-				for k, v := range r.URL.Query() {
-					queryParams[k] = v[0]
-				}
-				data["queryParams"] = queryParams
+				data["queryParams"] = cfg.Redaction.redactQuery(r.URL.Query())
 			}
 
-			if cfg.LogJSONBody {
-				if r.Method == "POST" || r.Method == "PUT" {
-					if r.Header.Get("Content-Type") == "application/json" {
-						buf, _ := io.ReadAll(r.Body)
-						reader := io.NopCloser(bytes.NewBuffer(buf))
-						r.Body = reader
+			if cfg.LogHeaders {
+				data["headers"] = cfg.Redaction.redactHeaders(r.Header)
+			}
 
-						var body any
-						err := json.Unmarshal(buf, &body)
-						if err == nil {
-							data["body"] = body
-						} else {
-							data["body"] = nil
+			if cfg.LogJSONBody && r.Body != nil && isJSONContentType(r.Header.Get("Content-Type")) {
+				switch r.Method {
+				case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+					// Only up to MaxBodySize bytes are buffered, the
+					// next handlers read them before the rest of the body.
+					buf, _ := io.ReadAll(io.LimitReader(r.Body, cfg.MaxBodySize+1))
+					r.Body = readCloser{
+						Reader: io.MultiReader(bytes.NewReader(buf), r.Body),
+						Closer: r.Body,
+					}
 
-						}
+					truncated := int64(len(buf)) > cfg.MaxBodySize
+					if truncated {
+						buf = buf[:cfg.MaxBodySize]
 					}
+					data["body"] = cfg.Redaction.logBody(buf, truncated, tr.body...)
 				}
 			}
 
+			// body counts the request body bytes read by the next
+			// handlers when the content length is unknown.
+			var body *countingReadCloser
+			if cfg.LogRequestSize && r.ContentLength < 0 && r.Body != nil {
+				body = &countingReadCloser{ReadCloser: r.Body}
+				r.Body = body
+			}
+			start := time.Now()
+
+			// completed is set once the next handler returns, if it
+			// is still false within the deferred function, the next
+			// handler panicked and the panic is being propagated.
+			completed := false
+
 			// Defers a function call to be executed after the function returns.
 			// This function uses the custom response writer to determine
 			// if the request was successful or not and then logs the message
 			// accordingly.
 			defer func() {
-				w := w.(*utils.ResponseWriter)
-				if w.SentErr == nil {
+				if !completed && rw.SentErr == nil {
+					rw.SentErr = errors.NewInternalServerError(
+						"request panicked",
+						nil,
+					)
+				}
+
+				// The completion fields are only logged with the
+				// completion message.
+				data := maps.Clone(data)
+				if cfg.LogDuration {
+					data["durationMs"] = time.Since(start).Milliseconds()
+				}
+				if cfg.LogStatus {
+					status := rw.SentStatus
+					if status == 0 {
+						status = http.StatusOK
+					}
+					if !completed && !rw.Written() {
+						status = http.StatusInternalServerError
+					}
+					data["statusCode"] = status
+				}
+				if cfg.LogResponseSize {
+					data["responseSize"] = rw.SentBytes
+				}
+				if cfg.LogRequestSize {
+					size := max(r.ContentLength, 0)
+					if body != nil {
+						size = body.n
+					}
+					data["requestSize"] = size
+				}
+				if cfg.LogUserAgent {
+					data["userAgent"] = r.UserAgent()
+				}
+				if cfg.LogJSONResponseBody && isJSONContentType(rw.Header().Get("Content-Type")) {
+					buf, truncated := rw.Captured()
+					data["responseBody"] = cfg.Redaction.logBody(buf, truncated)
+				}
+				if rw.SentErr == nil {
+					if !sampled {
+						return
+					}
+
 					// Logs the request succeeded message
 					msg := fmt.Sprintf(
 						"%s_%s_succeeded",
 						strings.ToLower(r.Method),
 						path,
 					)
-					l.InfoWithData(ctx, msg, data)
+					info(ctx, msg, data)
 					return
 				} else {
 					// Logs the request failed message
@@ -162,17 +358,59 @@ func NewRequestLoggingMdw(cfg RequestLoggingMdwConfig) func(next http.Handler) h
 						strings.ToLower(r.Method),
 						path,
 					)
-					l.ErrorWithData(ctx, msg, w.SentErr, data)
+					l.ErrorWithData(ctx, msg, rw.SentErr, data)
 					return
 				}
 			}()
 
 			// Logs the request started message
-			l.InfoWithData(ctx, msg, data)
+			if sampled {
+				info(ctx, msg, data)
+			}
 
 			next.ServeHTTP(w, r)
+			completed = true
 		}
 
 		return http.HandlerFunc(fn)
 	}
 }
+
+// formatLogPath converts the path to lower case, removes the leading
+// "/" and the "{" and "}" characters and replaces "/" and "-" with "_",
+// so it can be used within log messages.
+func formatLogPath(path string) string {
+	if path != "" && path[0] == '/' {
+		path = path[1:]
+	}
+	path = strings.ToLower(path)
+	path = strings.ReplaceAll(path, "/", "_")
+	path = strings.ReplaceAll(path, "-", "_")
+	path = strings.ReplaceAll(path, "{", "")
+	path = strings.ReplaceAll(path, "}", "")
+
+	return path
+}
+
+// countingReadCloser is an io.ReadCloser that counts the bytes read.
+type countingReadCloser struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// isJSONContentType returns true if the media type of the
+// content type ct is "application/json" or ends with "+json".
+func isJSONContentType(ct string) bool {
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false
+	}
+
+	return mt == "application/json" || strings.HasSuffix(mt, "+json")
+}
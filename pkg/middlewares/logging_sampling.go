@@ -0,0 +1,108 @@
+package middlewares
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogSampling holds the configuration used to sample the successful
+// requests logged by the request logging middleware. Failed requests
+// are always logged.
+type LogSampling struct {
+	// Rate is the probability, between 0 and 1, of a successful
+	// request to be logged. Defaults to 1 (every request).
+	Rate float64
+
+	// PerSecond is the maximum number of successful requests
+	// logged per second. Defaults to no limit.
+	PerSecond int
+}
+
+// logSampler samples requests following a LogSampling.
+type logSampler struct {
+	cfg    LogSampling
+	now    func() time.Time
+	random func() float64
+
+	mu     sync.Mutex
+	window time.Time
+	count  int
+}
+
+// newLogSampler creates a new logSampler, it panics
+// if the sampling configuration is invalid.
+func newLogSampler(cfg LogSampling) *logSampler {
+	if cfg.Rate < 0 || cfg.Rate > 1 {
+		panic(fmt.Sprintf("invalid log sampling rate %v", cfg.Rate))
+	}
+	if cfg.PerSecond < 0 {
+		panic(fmt.Sprintf("invalid log sampling per second %d", cfg.PerSecond))
+	}
+
+	return &logSampler{
+		cfg:    cfg,
+		now:    time.Now,
+		random: rand.Float64,
+	}
+}
+
+// sample returns true if the request has to be logged.
+func (s *logSampler) sample() bool {
+	if s.cfg.Rate > 0 && s.cfg.Rate < 1 && s.random() >= s.cfg.Rate {
+		return false
+	}
+	if s.cfg.PerSecond == 0 {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now().Truncate(time.Second)
+	if !now.Equal(s.window) {
+		s.window = now
+		s.count = 0
+	}
+	if s.count >= s.cfg.PerSecond {
+		return false
+	}
+	s.count++
+
+	return true
+}
+
+// routeMatches returns true if the method and route pattern match any
+// of the patterns, which are [path.Match] patterns of route patterns
+// that can be prefixed by a method (i.e "/health" or "GET /internal/*").
+func routeMatches(patterns []string, method, route string) bool {
+	for _, p := range patterns {
+		if m, pattern, ok := strings.Cut(p, " "); ok {
+			if m != method {
+				continue
+			}
+			p = pattern
+		}
+		if ok, _ := path.Match(p, route); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validateRoutePatterns panics if any of the
+// route patterns is malformed.
+func validateRoutePatterns(patterns []string) {
+	for _, p := range patterns {
+		if _, pattern, ok := strings.Cut(p, " "); ok {
+			p = pattern
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			panic(fmt.Sprintf("invalid route pattern %q", p))
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package middlewares
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestLogSampler(t *testing.T) {
+	type TestCase struct {
+		Name     string
+		Sampling LogSampling
+		Random   float64
+		Requests int
+		Advance  time.Duration
+		Want     int
+	}
+
+	testCases := []TestCase{}
+	testCases = append(testCases, TestCase{
+		Name:     "every request should be sampled by default",
+		Requests: 5,
+		Want:     5,
+	})
+	testCases = append(testCases, TestCase{
+		Name:     "requests over the rate should not be sampled",
+		Sampling: LogSampling{Rate: 0.1},
+		Random:   0.5,
+		Requests: 5,
+		Want:     0,
+	})
+	testCases = append(testCases, TestCase{
+		Name:     "requests under the rate should be sampled",
+		Sampling: LogSampling{Rate: 0.1},
+		Random:   0.05,
+		Requests: 5,
+		Want:     5,
+	})
+	testCases = append(testCases, TestCase{
+		Name:     "requests over the per second limit should not be sampled",
+		Sampling: LogSampling{PerSecond: 2},
+		Requests: 5,
+		Want:     2,
+	})
+	testCases = append(testCases, TestCase{
+		Name:     "per second limit should be reset every second",
+		Sampling: LogSampling{PerSecond: 2},
+		Requests: 5,
+		Advance:  time.Second,
+		Want:     5,
+	})
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			clock := &testClock{now: time.Unix(1_700_000_000, 0)}
+			s := newLogSampler(tc.Sampling)
+			s.now = clock.Now
+			s.random = func() float64 { return tc.Random }
+
+			got := 0
+			for range tc.Requests {
+				if s.sample() {
+					got++
+				}
+				clock.Advance(tc.Advance)
+			}
+			if got != tc.Want {
+				t.Errorf("got %d sampled requests, want %d", got, tc.Want)
+			}
+		})
+	}
+}
+
+func TestRequestLoggingMdwRoutes(t *testing.T) {
+	type TestCase struct {
+		Name       string
+		Config     RequestLoggingMdwConfig
+		Path       string
+		WantLevels []string
+	}
+
+	testCases := []TestCase{}
+	testCases = append(testCases, TestCase{
+		Name:       "excluded routes should not be logged",
+		Config:     RequestLoggingMdwConfig{ExcludeRoutes: []string{"/health"}},
+		Path:       "/health",
+		WantLevels: []string{},
+	})
+	testCases = append(testCases, TestCase{
+		Name:       "not included routes should not be logged",
+		Config:     RequestLoggingMdwConfig{IncludeRoutes: []string{"GET /users/*"}},
+		Path:       "/health",
+		WantLevels: []string{},
+	})
+	testCases = append(testCases, TestCase{
+		Name:       "included routes should be logged",
+		Config:     RequestLoggingMdwConfig{IncludeRoutes: []string{"GET /users/*"}},
+		Path:       "/users/1",
+		WantLevels: []string{"info", "info"},
+	})
+	testCases = append(testCases, TestCase{
+		Name:       "debug routes should be logged at debug level",
+		Config:     RequestLoggingMdwConfig{DebugRoutes: []string{"/health"}},
+		Path:       "/health",
+		WantLevels: []string{"debug", "debug"},
+	})
+	testCases = append(testCases, TestCase{
+		Name:       "debug routes should log failures as errors",
+		Config:     RequestLoggingMdwConfig{DebugRoutes: []string{"/fail"}},
+		Path:       "/fail",
+		WantLevels: []string{"debug", "error"},
+	})
+	testCases = append(testCases, TestCase{
+		Name: "not sampled requests should not be logged",
+		Config: RequestLoggingMdwConfig{
+			RouteSampling: map[string]LogSampling{"GET /health": {Rate: math.SmallestNonzeroFloat64}},
+		},
+		Path:       "/health",
+		WantLevels: []string{},
+	})
+	testCases = append(testCases, TestCase{
+		Name: "not sampled failed requests should be logged",
+		Config: RequestLoggingMdwConfig{
+			Sampling: LogSampling{Rate: math.SmallestNonzeroFloat64},
+		},
+		Path:       "/fail",
+		WantLevels: []string{"error"},
+	})
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			l := &recordingLogger{}
+			tc.Config.Logger = l
+
+			r := chi.NewRouter()
+			r.Use(NewRequestLoggingMdw(tc.Config))
+			r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			r.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			r.Get("/fail", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			})
+
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tc.Path, nil))
+
+			got := []string{}
+			for _, log := range l.Logs() {
+				got = append(got, log.Level)
+			}
+			if len(got) != len(tc.WantLevels) {
+				t.Fatalf("got levels %v, want %v", got, tc.WantLevels)
+			}
+			for i := range got {
+				if got[i] != tc.WantLevels[i] {
+					t.Errorf("got levels %v, want %v", got, tc.WantLevels)
+				}
+			}
+		})
+	}
+}
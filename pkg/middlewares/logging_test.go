@@ -0,0 +1,279 @@
+package middlewares
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// recordedLog is a log recorded by recordingLogger.
+type recordedLog struct {
+	Level string
+	Msg   string
+	Err   error
+	Data  map[string]any
+}
+
+// recordingLogger is a logger.Logger that records the logs.
+type recordingLogger struct {
+	mu   sync.Mutex
+	logs []recordedLog
+}
+
+func (l *recordingLogger) record(level, msg string, err error, data map[string]any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.logs = append(l.logs, recordedLog{Level: level, Msg: msg, Err: err, Data: data})
+}
+
+func (l *recordingLogger) Debug(ctx context.Context, msg string) { l.record("debug", msg, nil, nil) }
+func (l *recordingLogger) DebugWithData(ctx context.Context, msg string, data map[string]any) {
+	l.record("debug", msg, nil, data)
+}
+func (l *recordingLogger) Info(ctx context.Context, msg string) { l.record("info", msg, nil, nil) }
+func (l *recordingLogger) InfoWithData(ctx context.Context, msg string, data map[string]any) {
+	l.record("info", msg, nil, data)
+}
+func (l *recordingLogger) Error(ctx context.Context, msg string, err error) {
+	l.record("error", msg, err, nil)
+}
+func (l *recordingLogger) ErrorWithData(ctx context.Context, msg string, err error, data map[string]any) {
+	l.record("error", msg, err, data)
+}
+func (l *recordingLogger) Fatal(ctx context.Context, msg string, err error) {
+	l.record("fatal", msg, err, nil)
+}
+func (l *recordingLogger) FatalWithData(ctx context.Context, msg string, err error, data map[string]any) {
+	l.record("fatal", msg, err, data)
+}
+
+// Logs returns the recorded logs.
+func (l *recordingLogger) Logs() []recordedLog {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]recordedLog{}, l.logs...)
+}
+
+func TestRequestLoggingMdwCompletionFields(t *testing.T) {
+	type TestCase struct {
+		Name        string
+		Config      RequestLoggingMdwConfig
+		Body        string
+		Chunked     bool
+		Status      int
+		WantMsg     string
+		WantData    map[string]any
+		WantMissing []string
+	}
+
+	testCases := []TestCase{}
+	testCases = append(testCases, TestCase{
+		Name: "completion fields should be logged",
+		Config: RequestLoggingMdwConfig{
+			LogStatus:       true,
+			LogResponseSize: true,
+			LogRequestSize:  true,
+			LogUserAgent:    true,
+			LogClientIP:     true,
+		},
+		Body:    `{"name":"betsi"}`,
+		WantMsg: "post_users_id_succeeded",
+		WantData: map[string]any{
+			"statusCode":   http.StatusOK,
+			"responseSize": int64(5),
+			"requestSize":  int64(16),
+			"userAgent":    "test-agent",
+			"clientIp":     "1.1.1.1",
+		},
+	})
+	testCases = append(testCases, TestCase{
+		Name:    "unknown content length should count the read bytes",
+		Config:  RequestLoggingMdwConfig{LogRequestSize: true},
+		Body:    "0123456789",
+		Chunked: true,
+		WantMsg: "post_users_id_succeeded",
+		WantData: map[string]any{
+			"requestSize": int64(10),
+		},
+	})
+	testCases = append(testCases, TestCase{
+		Name:    "error status should be logged",
+		Config:  RequestLoggingMdwConfig{LogStatus: true},
+		Status:  http.StatusNotFound,
+		WantMsg: "post_users_id_failed",
+		WantData: map[string]any{
+			"statusCode": http.StatusNotFound,
+		},
+	})
+	testCases = append(testCases, TestCase{
+		Name:        "disabled fields should not be logged",
+		WantMsg:     "post_users_id_succeeded",
+		WantMissing: []string{"statusCode", "durationMs", "responseSize", "requestSize", "userAgent"},
+	})
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			l := &recordingLogger{}
+			tc.Config.Logger = l
+			tc.Config.LogDuration = tc.WantMissing == nil
+
+			r := chi.NewRouter()
+			r.Use(NewRequestLoggingMdw(tc.Config))
+			r.Post("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+				buf := make([]byte, 64)
+				for {
+					if _, err := r.Body.Read(buf); err != nil {
+						break
+					}
+				}
+				if tc.Status != 0 {
+					w.WriteHeader(tc.Status)
+					w.Write([]byte(`{"statusCode":404,"name":"not_found","message":"not found"}`))
+					return
+				}
+				w.Write([]byte("hello"))
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/users/1", strings.NewReader(tc.Body))
+			req.RemoteAddr = "1.1.1.1:1234"
+			req.Header.Set("User-Agent", "test-agent")
+			if tc.Chunked {
+				req.ContentLength = -1
+			}
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			logs := l.Logs()
+			if len(logs) != 2 {
+				t.Fatalf("got %d logs, want 2", len(logs))
+			}
+			if logs[0].Data["statusCode"] != nil {
+				t.Errorf("started log should not have completion fields")
+			}
+			got := logs[1]
+			if got.Msg != tc.WantMsg {
+				t.Errorf("got message %q, want %q", got.Msg, tc.WantMsg)
+			}
+			for k, want := range tc.WantData {
+				if got.Data[k] != want {
+					t.Errorf("got %s %v (%T), want %v (%T)", k, got.Data[k], got.Data[k], want, want)
+				}
+			}
+			for _, k := range tc.WantMissing {
+				if _, ok := got.Data[k]; ok {
+					t.Errorf("got %s, want none", k)
+				}
+			}
+			if tc.WantMissing == nil {
+				if _, ok := got.Data["durationMs"].(int64); !ok {
+					t.Errorf("got duration %v, want an int64", got.Data["durationMs"])
+				}
+			}
+		})
+	}
+}
+
+func TestRequestLoggingMdwBodies(t *testing.T) {
+	type TestCase struct {
+		Name         string
+		Config       RequestLoggingMdwConfig
+		Method       string
+		ContentType  string
+		Body         string
+		ResponseType string
+		Response     string
+		WantBody     any
+		WantResponse any
+	}
+
+	testCases := []TestCase{}
+	testCases = append(testCases, TestCase{
+		Name:         "json bodies with parameters should be logged",
+		Config:       RequestLoggingMdwConfig{LogJSONBody: true, LogJSONResponseBody: true},
+		Method:       http.MethodPatch,
+		ContentType:  "application/json; charset=utf-8",
+		Body:         `{"name":"betsi"}`,
+		ResponseType: "application/problem+json",
+		Response:     `{"id":1}`,
+		WantBody:     map[string]any{"name": "betsi"},
+		WantResponse: map[string]any{"id": float64(1)},
+	})
+	testCases = append(testCases, TestCase{
+		Name:         "large bodies should be truncated",
+		Config:       RequestLoggingMdwConfig{LogJSONBody: true, LogJSONResponseBody: true, MaxBodySize: 4},
+		Method:       http.MethodDelete,
+		ContentType:  "application/json",
+		Body:         `{"name":"betsi"}`,
+		ResponseType: "application/json",
+		Response:     `{"id":1}`,
+		WantBody:     `{"na` + TRUNCATED,
+		WantResponse: `{"id` + TRUNCATED,
+	})
+	testCases = append(testCases, TestCase{
+		Name: "truncated bodies should not be logged with redaction rules",
+		Config: RequestLoggingMdwConfig{
+			LogJSONBody: true,
+			MaxBodySize: 4,
+			Redaction:   Redaction{Keys: []string{"name"}},
+		},
+		Method:      http.MethodPost,
+		ContentType: "application/json",
+		Body:        `{"name":"betsi"}`,
+		WantBody:    TRUNCATED,
+	})
+	testCases = append(testCases, TestCase{
+		Name:         "non json bodies should not be logged",
+		Config:       RequestLoggingMdwConfig{LogJSONBody: true, LogJSONResponseBody: true},
+		Method:       http.MethodPost,
+		ContentType:  "text/plain",
+		Body:         "betsi",
+		ResponseType: "text/plain",
+		Response:     "betsi",
+	})
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			l := &recordingLogger{}
+			tc.Config.Logger = l
+
+			var received []byte
+			r := chi.NewRouter()
+			r.Use(NewRequestLoggingMdw(tc.Config))
+			r.HandleFunc("/users", func(w http.ResponseWriter, r *http.Request) {
+				received, _ = io.ReadAll(r.Body)
+				w.Header().Set("Content-Type", tc.ResponseType)
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(tc.Response))
+			})
+
+			req := httptest.NewRequest(tc.Method, "/users", strings.NewReader(tc.Body))
+			req.Header.Set("Content-Type", tc.ContentType)
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			if string(received) != tc.Body {
+				t.Errorf("handler got body %q, want %q", received, tc.Body)
+			}
+			if rec.Body.String() != tc.Response {
+				t.Errorf("got response %q, want %q", rec.Body.String(), tc.Response)
+			}
+
+			logs := l.Logs()
+			if len(logs) != 2 {
+				t.Fatalf("got %d logs, want 2", len(logs))
+			}
+			if got := logs[0].Data["body"]; !reflect.DeepEqual(got, tc.WantBody) {
+				t.Errorf("got body %v, want %v", got, tc.WantBody)
+			}
+			if got := logs[1].Data["responseBody"]; !reflect.DeepEqual(got, tc.WantResponse) {
+				t.Errorf("got response body %v, want %v", got, tc.WantResponse)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/iolave/go-betsi/internal/utils"
+	"github.com/iolave/go-errors"
+	"github.com/iolave/go-logger"
+	"github.com/iolave/go-trace"
+)
+
+// maxLoggedErrorBodySize is the maximum number of bytes of an
+// error response body that are read to log the error.
+const maxLoggedErrorBodySize = 64 << 10
+
+var _ http.RoundTripper = &loggingTransport{}
+
+// LoggingTransportConfig holds the configuration for the
+// outgoing requests logging transport.
+type LoggingTransportConfig struct {
+	// Logger is the logger to use for logging requests.
+	Logger logger.Logger
+
+	// Base is the transport used to send the requests. If nil,
+	// [http.DefaultTransport] is used.
+	Base http.RoundTripper
+
+	// LogPath determines whether to log the request path.
+	LogPath bool
+
+	// LogQueryParams determines whether to log the request query parameters.
+	LogQueryParams bool
+
+	// LogJSONBody determines whether to log the request body for requests
+	// with "application/json" content type.
+	LogJSONBody bool
+
+	// Redaction holds the rules used to redact the logged
+	// query parameters and JSON body.
+	Redaction Redaction
+}
+
+// loggingTransport is the http.RoundTripper returned by
+// NewLoggingTransport.
+type loggingTransport struct {
+	cfg  LoggingTransportConfig
+	base http.RoundTripper
+}
+
+// NewLoggingTransport creates a new http.RoundTripper that logs outgoing
+// requests the same way [NewRequestLoggingMdw] logs incoming ones.
+//
+// It logs the start, success, or failure of each request, along with the
+// request host, method, status code and duration (in milliseconds). It can
+// be configured to log the request path, query parameters and JSON body.
+// A request fails when it can't be sent or the response status is not 2xx.
+//
+// The log messages are formatted as "<method>_<host>_<path>_<status>". The
+// path is the path pattern the request was built with when created using
+// [github.com/iolave/go-betsi.NewRequest] (i.e "users_id") or the request
+// path otherwise.
+//
+// Trace headers found in the request context are set in the request headers.
+//
+// Example:
+//
+//	client := &http.Client{
+//		Transport: middlewares.NewLoggingTransport(middlewares.LoggingTransportConfig{
+//			Logger:         l,
+//			LogPath:        true,
+//			LogQueryParams: true,
+//			Redaction:      middlewares.Redaction{Keys: []string{"password"}},
+//		}),
+//	}
+func NewLoggingTransport(cfg LoggingTransportConfig) http.RoundTripper {
+	if cfg.Logger == nil {
+		panic("logger cannot be nil")
+	}
+	cfg.Redaction.validate()
+
+	base := cfg.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &loggingTransport{
+		cfg:  cfg,
+		base: base,
+	}
+}
+
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	l := t.cfg.Logger
+
+	// A round tripper must not modify the request, so the
+	// trace headers are set within a clone.
+	req = req.Clone(ctx)
+	tr := trace.GetFromContext(ctx)
+	tr.SetHTTPHeaders(req.Header)
+
+	path := utils.GetPathPatternFromContext(ctx)
+	if path == "" {
+		path = req.URL.Path
+	}
+	host := strings.ToLower(req.URL.Hostname())
+	host = strings.NewReplacer(".", "_", "-", "_").Replace(host)
+	prefix := fmt.Sprintf(
+		"%s_%s_%s",
+		strings.ToLower(req.Method),
+		host,
+		formatLogPath(path),
+	)
+	prefix = strings.TrimSuffix(prefix, "_")
+
+	data := map[string]any{
+		"method": req.Method,
+		"host":   req.URL.Host,
+	}
+
+	if t.cfg.LogPath {
+		data["path"] = req.URL.Path
+	}
+
+	if t.cfg.LogQueryParams {
+		data["queryParams"] = t.cfg.Redaction.redactQuery(req.URL.Query())
+	}
+
+	if t.cfg.LogJSONBody && req.Body != nil && req.Body != http.NoBody {
+		mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		if mediaType == "application/json" {
+			buf, err := io.ReadAll(req.Body)
+			req.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = io.NopCloser(bytes.NewReader(buf))
+
+			var body any
+			if err := json.Unmarshal(buf, &body); err == nil {
+				data["body"] = t.cfg.Redaction.redactJSON(body)
+			} else {
+				data["body"] = nil
+			}
+		}
+	}
+
+	l.InfoWithData(ctx, prefix+"_started", data)
+
+	start := time.Now()
+	res, err := t.base.RoundTrip(req)
+	data["durationMs"] = time.Since(start).Milliseconds()
+
+	if err != nil {
+		l.ErrorWithData(ctx, prefix+"_failed", errors.Wrap(err), data)
+		return res, err
+	}
+
+	data["statusCode"] = res.StatusCode
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		// Reads the beginning of the body to log the error and
+		// gives it back to the response body.
+		buf, _ := io.ReadAll(io.LimitReader(res.Body, maxLoggedErrorBodySize))
+		res.Body = readCloser{
+			Reader: io.MultiReader(bytes.NewReader(buf), res.Body),
+			Closer: res.Body,
+		}
+		l.ErrorWithData(ctx, prefix+"_failed", utils.ParseHTTPError(res.StatusCode, buf), data)
+		return res, nil
+	}
+
+	l.InfoWithData(ctx, prefix+"_succeeded", data)
+	return res, nil
+}
+
+// readCloser combines a reader with the closer of
+// another one.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
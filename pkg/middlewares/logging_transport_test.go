@@ -0,0 +1,260 @@
+package middlewares
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/iolave/go-betsi/internal/utils"
+	"github.com/iolave/go-trace"
+)
+
+func TestLoggingTransport(t *testing.T) {
+	type TestCase struct {
+		Name        string
+		Config      LoggingTransportConfig
+		Method      string
+		Path        string
+		Body        string
+		Pattern     string
+		WantMsg     string
+		WantData    map[string]any
+		WantMissing []string
+		WantErr     string
+	}
+
+	testCases := []TestCase{}
+	testCases = append(testCases, TestCase{
+		Name:     "succeeded requests should be logged",
+		Method:   http.MethodGet,
+		Path:     "/users/1",
+		WantMsg:  "get_127_0_0_1_users_1_succeeded",
+		WantData: map[string]any{"method": http.MethodGet, "statusCode": http.StatusOK},
+		WantMissing: []string{
+			"path",
+			"queryParams",
+			"body",
+		},
+	})
+	testCases = append(testCases, TestCase{
+		Name:     "failed requests should be logged with their error",
+		Method:   http.MethodPost,
+		Path:     "/fail",
+		WantMsg:  "post_127_0_0_1_fail_failed",
+		WantData: map[string]any{"method": http.MethodPost, "statusCode": http.StatusConflict},
+		WantErr:  "user already exists",
+	})
+	testCases = append(testCases, TestCase{
+		Name:     "path patterns should be used within the message",
+		Method:   http.MethodGet,
+		Path:     "/users/1",
+		Pattern:  "/users/{id}",
+		WantMsg:  "get_127_0_0_1_users_id_succeeded",
+		WantData: map[string]any{"method": http.MethodGet},
+	})
+	testCases = append(testCases, TestCase{
+		Name: "path, query params and body should be logged redacted",
+		Config: LoggingTransportConfig{
+			LogPath:        true,
+			LogQueryParams: true,
+			LogJSONBody:    true,
+			Redaction: Redaction{
+				Keys:        []string{"password"},
+				QueryParams: []string{"token"},
+			},
+		},
+		Method:  http.MethodPost,
+		Path:    "/users?token=secret&page=2",
+		Body:    `{"name":"betsi","password":"secret"}`,
+		WantMsg: "post_127_0_0_1_users_succeeded",
+		WantData: map[string]any{
+			"path":        "/users",
+			"queryParams": map[string]string{"token": REDACTED, "page": "2"},
+			"body":        map[string]any{"name": "betsi", "password": REDACTED},
+		},
+	})
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			var gotBody string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				gotBody = string(b)
+				if r.URL.Path == "/fail" {
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusConflict)
+					w.Write([]byte(`{"statusCode":409,"name":"ConflictError","message":"user already exists"}`))
+				}
+			}))
+			defer srv.Close()
+
+			l := &recordingLogger{}
+			tc.Config.Logger = l
+			client := &http.Client{Transport: NewLoggingTransport(tc.Config)}
+
+			req, _ := http.NewRequest(tc.Method, srv.URL+tc.Path, strings.NewReader(tc.Body))
+			req.Header.Set("Content-Type", "application/json")
+			if tc.Pattern != "" {
+				req = req.WithContext(utils.SetPathPatternInContext(req.Context(), tc.Pattern))
+			}
+			res, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+
+			if gotBody != tc.Body {
+				t.Errorf("server got body %q, want %q", gotBody, tc.Body)
+			}
+
+			logs := l.Logs()
+			if len(logs) != 2 {
+				t.Fatalf("got logs %+v, want 2", logs)
+			}
+			wantStarted := strings.TrimSuffix(tc.WantMsg, "_succeeded")
+			wantStarted = strings.TrimSuffix(wantStarted, "_failed") + "_started"
+			if logs[0].Msg != wantStarted {
+				t.Errorf("got message %s, want %s", logs[0].Msg, wantStarted)
+			}
+			log := logs[1]
+			if log.Msg != tc.WantMsg {
+				t.Errorf("got message %s, want %s", log.Msg, tc.WantMsg)
+			}
+			if _, ok := log.Data["durationMs"].(int64); !ok {
+				t.Errorf("got durationMs %v, want an int64", log.Data["durationMs"])
+			}
+			if log.Data["host"] != strings.TrimPrefix(srv.URL, "http://") {
+				t.Errorf("got host %v", log.Data["host"])
+			}
+			for k, want := range tc.WantData {
+				if got := log.Data[k]; !reflect.DeepEqual(got, want) {
+					t.Errorf("got %s %#v, want %#v", k, got, want)
+				}
+			}
+			for _, k := range tc.WantMissing {
+				if _, ok := log.Data[k]; ok {
+					t.Errorf("got %s %v, want it missing", k, log.Data[k])
+				}
+			}
+			if tc.WantErr == "" && log.Err != nil {
+				t.Errorf("got error %v", log.Err)
+			}
+			if tc.WantErr != "" && (log.Err == nil || !strings.Contains(log.Err.Error(), tc.WantErr)) {
+				t.Errorf("got error %v, want %q", log.Err, tc.WantErr)
+			}
+		})
+	}
+}
+
+func TestLoggingTransportTraceHeaders(t *testing.T) {
+	got := http.Header{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer srv.Close()
+
+	tr := trace.GetFromContext(t.Context())
+	tr.Set("X-Test", "value")
+	ctx := tr.SetInContext(t.Context())
+	want := http.Header{}
+	tr.SetHTTPHeaders(want)
+
+	client := &http.Client{Transport: NewLoggingTransport(LoggingTransportConfig{Logger: &recordingLogger{}})}
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if len(want) == 0 {
+		t.Fatal("got no trace headers to compare")
+	}
+	for k := range want {
+		if got.Get(k) != want.Get(k) {
+			t.Errorf("got %s header %q, want %q", k, got.Get(k), want.Get(k))
+		}
+	}
+	for k := range want {
+		if req.Header.Get(k) != "" {
+			t.Errorf("got %s header within the original request", k)
+		}
+	}
+}
+
+func TestLoggingTransportLargeErrorBody(t *testing.T) {
+	body := strings.Repeat("a", maxLoggedErrorBodySize*2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	l := &recordingLogger{}
+	client := &http.Client{Transport: NewLoggingTransport(LoggingTransportConfig{Logger: l})}
+	res, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil || string(b) != body {
+		t.Errorf("got %d bytes and error %v, want %d bytes", len(b), err, len(body))
+	}
+	if logs := l.Logs(); len(logs) != 2 || !strings.HasSuffix(logs[1].Msg, "_failed") {
+		t.Errorf("got logs %+v, want a failed log", logs)
+	}
+}
+
+func TestLoggingTransportError(t *testing.T) {
+	l := &recordingLogger{}
+	client := &http.Client{Transport: NewLoggingTransport(LoggingTransportConfig{
+		Logger: l,
+		Base: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			return nil, errors.New("connection refused")
+		}),
+	})}
+
+	_, err := client.Get("http://api.example.com/users")
+	if err == nil {
+		t.Fatal("got no error")
+	}
+
+	logs := l.Logs()
+	if len(logs) != 2 || logs[1].Msg != "get_api_example_com_users_failed" || logs[1].Level != "error" {
+		t.Fatalf("got logs %+v, want a failed log", logs)
+	}
+	if logs[1].Err == nil || !strings.Contains(logs[1].Err.Error(), "connection refused") {
+		t.Errorf("got error %v", logs[1].Err)
+	}
+	if _, ok := logs[1].Data["durationMs"]; !ok {
+		t.Errorf("got data %+v, want durationMs", logs[1].Data)
+	}
+	if _, ok := logs[1].Data["statusCode"]; ok {
+		t.Errorf("got data %+v, want no statusCode", logs[1].Data)
+	}
+}
+
+func TestLoggingTransportInvalidRedaction(t *testing.T) {
+	defer func() {
+		if rec := recover(); rec == nil {
+			t.Error("got no panic, want an invalid redaction key pattern panic")
+		}
+	}()
+	NewLoggingTransport(LoggingTransportConfig{
+		Logger:    &recordingLogger{},
+		Redaction: Redaction{KeyPatterns: []string{"[token"}},
+	})
+}
+
+// roundTripperFunc is an http.RoundTripper function.
+type roundTripperFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
@@ -1,11 +1,15 @@
 package middlewares
 
 import (
-	"net"
+	"fmt"
+	"hash/maphash"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/iolave/go-betsi/internal/utils"
 	"github.com/iolave/go-errors"
 	"github.com/iolave/go-logger"
 )
@@ -30,6 +34,29 @@ type RateLimit struct {
 	// Remaining is the number of requests remaining within the
 	// time metric.
 	Remaining int `json:"remaining"`
+
+	// Algorithm is the algorithm that manages the rate limit,
+	// empty means [RATE_LIMIT_FIXED_WINDOW].
+	Algorithm RateLimitAlgorithm `json:"algorithm,omitempty"`
+
+	// ResetAt is the time at which the next request is allowed when
+	// the rate limit is limited, otherwise it is the time at which
+	// Remaining is back to Limit.
+	ResetAt time.Time `json:"resetAt,omitzero"`
+
+	// Tokens are the tokens of the [RATE_LIMIT_TOKEN_BUCKET]
+	// algorithm bucket.
+	Tokens float64 `json:"tokens,omitempty"`
+
+	// Log holds the time of the requests within the sliding
+	// window of the [RATE_LIMIT_SLIDING_WINDOW_LOG] algorithm.
+	Log []time.Time `json:"log,omitempty"`
+
+	// Count and PreviousCount are the requests of the current and
+	// previous windows of the [RATE_LIMIT_SLIDING_WINDOW_COUNTER]
+	// algorithm.
+	Count         int `json:"count,omitempty"`
+	PreviousCount int `json:"previousCount,omitempty"`
 }
 
 // Decrement decrements the remaining requests by 1.
@@ -59,11 +86,18 @@ func (r RateLimit) IsLimited() bool {
 
 // SetResponseHeaders sets the response headers for the rate limit.
 // It sets the X-Rate-Limit-Limit, X-Rate-Limit-Remaining, and
-// X-Rate-Limit-Reset headers.
+// X-Rate-Limit-Reset headers, the reset is ResetAt (rounded up to
+// the second) or the end of the fixed window when it's not set.
 func (r RateLimit) SetResponseHeaders(w http.ResponseWriter) {
+	reset := r.reset()
+	resetUnix := reset.Unix()
+	if reset.After(time.Unix(resetUnix, 0)) {
+		resetUnix++
+	}
+
 	w.Header().Set("X-Rate-Limit-Limit", strconv.Itoa(r.Limit))
 	w.Header().Set("X-Rate-Limit-Remaining", strconv.Itoa(r.Remaining))
-	w.Header().Set("X-Rate-Limit-Reset", strconv.FormatInt(r.LastRequestedAt.Add(r.Metric).Unix(), 10))
+	w.Header().Set("X-Rate-Limit-Reset", strconv.FormatInt(resetUnix, 10))
 }
 
 // RateLimitStore is the interface for a store to use for rate limiting.
@@ -72,9 +106,113 @@ type RateLimitStore interface {
 	UpsertLimit(limit RateLimit) error
 }
 
+// AtomicRateLimitStore is a store that takes requests from rate limits
+// atomically, so concurrent requests (even from different replicas when
+// the store is shared) can't exceed the limit.
+type AtomicRateLimitStore interface {
+	// Take takes a request from the rate limit of key, creating it
+	// with limit and window when it doesn't exist or its window has
+	// ended. It returns the rate limit after taking the request and
+	// whether the request is allowed.
+	Take(key string, limit int, window time.Duration) (RateLimit, bool, error)
+}
+
+// AlgorithmRateLimitStore is an [AtomicRateLimitStore] that supports
+// every [RateLimitAlgorithm].
+type AlgorithmRateLimitStore interface {
+	AtomicRateLimitStore
+
+	// TakeWithAlgorithm takes a request from the rate limit of key
+	// using algorithm, the rate limit is reset when it was created by
+	// another algorithm. It returns the rate limit after taking the
+	// request and whether the request is allowed.
+	TakeWithAlgorithm(key string, limit int, window time.Duration, algorithm RateLimitAlgorithm) (RateLimit, bool, error)
+}
+
+// NewAtomicRateLimitStore returns store as an [AtomicRateLimitStore]. Stores
+// that don't implement it are wrapped, so GetLimit and UpsertLimit calls
+// of the same key are serialized with a lock.
+//
+// The lock is local to the process, so wrapped stores shared by several
+// replicas are still subject to races between replicas, use a store that
+// implements [AtomicRateLimitStore] (i.e [RedisRateLimitStore]) instead.
+func NewAtomicRateLimitStore(store RateLimitStore) AtomicRateLimitStore {
+	if s, ok := store.(AtomicRateLimitStore); ok {
+		return s
+	}
+
+	return &lockedRateLimitStore{
+		store: store,
+		seed:  maphash.MakeSeed(),
+	}
+}
+
+// lockedRateLimitStore is a [RateLimitStore] wrapped with per key locks.
+type lockedRateLimitStore struct {
+	store RateLimitStore
+	seed  maphash.Seed
+
+	// locks are shared by the keys with the same hash
+	// (modulo the number of locks).
+	locks [256]sync.Mutex
+}
+
+func (s *lockedRateLimitStore) Take(key string, limit int, window time.Duration) (RateLimit, bool, error) {
+	return s.TakeWithAlgorithm(key, limit, window, RATE_LIMIT_FIXED_WINDOW)
+}
+
+func (s *lockedRateLimitStore) TakeWithAlgorithm(
+	key string,
+	limit int,
+	window time.Duration,
+	algorithm RateLimitAlgorithm,
+) (RateLimit, bool, error) {
+	mu := &s.locks[maphash.String(s.seed, key)%uint64(len(s.locks))]
+	mu.Lock()
+	defer mu.Unlock()
+
+	rl, err := s.store.GetLimit(key)
+	if err != nil {
+		return RateLimit{}, false, err
+	}
+
+	taken, allowed := takeRateLimit(rl, key, limit, window, algorithm, time.Now())
+	if !allowed {
+		return taken, false, nil
+	}
+	if err := s.store.UpsertLimit(taken); err != nil {
+		return RateLimit{}, false, err
+	}
+
+	return taken, true, nil
+}
+
+// RateLimitPolicy is a rate limit that is applied to the requests of
+// every key, the middleware can stack several of them (i.e 10 requests
+// per second and 1000 per hour).
+type RateLimitPolicy struct {
+	// Name identifies the rate limits of the policy within the
+	// store. Defaults to the algorithm, limit and metric of the
+	// policy (i.e "fixed_window_10_1s").
+	Name string
+
+	// Metric is the time metric to use for rate limiting.
+	Metric time.Duration
+
+	// Limit is the maximum number of requests allowed within the
+	// time metric.
+	Limit int
+
+	// Algorithm is the rate limiting algorithm. Defaults to
+	// [RATE_LIMIT_FIXED_WINDOW].
+	Algorithm RateLimitAlgorithm
+}
+
 // RateLimitConfig is the configuration for the rate limiting middleware.
 type RateLimitConfig struct {
-	// Store is the store to use for rate limiting.
+	// Store is the store to use for rate limiting. Stores that
+	// don't implement [AtomicRateLimitStore] are wrapped with
+	// [NewAtomicRateLimitStore].
 	Store RateLimitStore
 
 	// Metric is the time metric to use for rate limiting.
@@ -86,26 +224,164 @@ type RateLimitConfig struct {
 	// time metric.
 	Limit int
 
+	// Algorithm is the rate limiting algorithm. Defaults to
+	// [RATE_LIMIT_FIXED_WINDOW], other algorithms require the
+	// store to implement [AlgorithmRateLimitStore] (or to only
+	// implement [RateLimitStore]).
+	Algorithm RateLimitAlgorithm
+
+	// Policies are stacked rate limits, requests are allowed when
+	// every policy allows them. When set, Metric, Limit and Algorithm
+	// are ignored.
+	//
+	// Policies are taken in order until one of them denies the request,
+	// so denied requests still count against the policies before it.
+	Policies []RateLimitPolicy
+
+	// RoutePolicies override the policies of the routes whose pattern
+	// (i.e "/users/{id}") or method and pattern (i.e "POST /users") is
+	// a key of the map, the latter takes precedence. Routes with no
+	// policies are not rate limited.
+	//
+	// The policies of a route can also be overridden through
+	// [github.com/iolave/go-betsi.Router.With], see [NewRateLimitOverrideMdw].
+	// Limits that are added to the ones of the router, instead of
+	// overriding them, can be set with another rate limiting
+	// middleware through With (using another KeyPrefix).
+	RoutePolicies map[string][]RateLimitPolicy
+
+	// KeyFunc returns the key requests are rate limited by. Defaults
+	// to [RateLimitKeyByIP], see the other RateLimitKeyBy functions.
+	KeyFunc RateLimitKeyFunc
+
+	// KeyPrefix is prepended to the keys of the store, it has to be
+	// set when several middlewares share a store.
+	KeyPrefix string
+
+	// ExemptCIDRs are the IPs and CIDRs (i.e "10.0.0.0/8") whose
+	// requests are not rate limited.
+	ExemptCIDRs []string
+
+	// ExemptKeys are the keys (as returned by KeyFunc) whose requests
+	// are not rate limited.
+	ExemptKeys []string
+
+	// HeaderScheme is the scheme of the rate limit response headers.
+	// Defaults to [RATE_LIMIT_HEADERS_LEGACY].
+	HeaderScheme RateLimitHeaderScheme
+
+	// ErrorHandler writes the 429 and 500 error responses. Defaults
+	// to writing them as the router's SendJSONError does, with the
+	// trace headers and the "application/json" content type.
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, err *errors.HTTPError)
+
+	// FailurePolicy is how requests are handled when their rate limit
+	// can't be taken from the store. Defaults to [RATE_LIMIT_FAIL_CLOSED].
+	FailurePolicy RateLimitFailurePolicy
+
+	// CircuitBreaker configures the circuit breaker around the store,
+	// which is disabled by default.
+	CircuitBreaker RateLimitCircuitBreakerConfig
+
+	// Metrics is an optional receiver of the outcome of every request
+	// (allowed, limited or store error), see [RateLimitCounters].
+	Metrics RateLimitMetrics
+
 	// Logger is an optional logger to use for logging errors and
 	// rate limit exceeded errors.
 	Logger logger.Logger
 }
 
+// rateLimitPolicy is a validated policy bound to its store.
+type rateLimitPolicy struct {
+	name string
+	// prefix is prepended to the keys of the policy.
+	prefix string
+	limit  int
+	metric time.Duration
+	take   func(key string) (RateLimit, bool, error)
+}
+
+// NewRateLimitMdwWithJSONError creates a new rate limiting middleware that
+// limits the requests of every key (the IP by default) to config.Limit per
+// config.Metric using config.Algorithm, or to every one of config.Policies.
+// Requests are taken atomically from the store (see [AtomicRateLimitStore])
+// and the rate limit of the most restrictive policy is sent within the
+// headers of config.HeaderScheme.
+//
+// Limited requests are responded with a 429 JSON error along with the
+// Retry-After header and store errors are handled with
+// config.FailurePolicy, errors are written by config.ErrorHandler.
+// Store errors, as well as the circuit breaker opening and closing,
+// are logged with the request context (and its trace).
+//
+// It panics when the configuration is invalid.
+//
+// Example:
+//
+//	r.Use(middlewares.NewRateLimitMdwWithJSONError(middlewares.RateLimitConfig{
+//		Store:   store,
+//		KeyFunc: middlewares.RateLimitKeyByHeader("X-Api-Key"),
+//		Policies: []middlewares.RateLimitPolicy{
+//			{Limit: 10, Metric: time.Second},
+//			{Limit: 1000, Metric: time.Hour},
+//		},
+//		RoutePolicies: map[string][]middlewares.RateLimitPolicy{
+//			"POST /login": {{Limit: 5, Metric: time.Minute}},
+//			"/health":     {},
+//		},
+//		ExemptCIDRs: []string{"10.0.0.0/8"},
+//	}))
 func NewRateLimitMdwWithJSONError(config RateLimitConfig) func(next http.Handler) http.Handler {
 	if config.Store == nil {
 		panic("store is required")
 	}
+	if config.KeyFunc == nil {
+		config.KeyFunc = RateLimitKeyByIP
+	}
+	if config.HeaderScheme == "" {
+		config.HeaderScheme = RATE_LIMIT_HEADERS_LEGACY
+	}
+	if !config.HeaderScheme.valid() {
+		panic("unknown rate limit header scheme " + string(config.HeaderScheme))
+	}
+	if config.FailurePolicy == "" {
+		config.FailurePolicy = RATE_LIMIT_FAIL_CLOSED
+	}
+	if !config.FailurePolicy.valid() {
+		panic("unknown rate limit failure policy " + string(config.FailurePolicy))
+	}
+	if config.ErrorHandler == nil {
+		config.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err *errors.HTTPError) {
+			utils.WriteHTTPError(r.Context(), w, err)
+		}
+	}
+
+	store := NewAtomicRateLimitStore(config.Store)
+	policies := newRateLimitPolicies(store, config.KeyPrefix, config.Policies)
+	if len(config.Policies) == 0 {
+		// Keys are not prefixed with the policy name, so rate limits
+		// stored before policies existed are still used.
+		policies = newRateLimitPolicies(store, "", []RateLimitPolicy{{
+			Metric:    config.Metric,
+			Limit:     config.Limit,
+			Algorithm: config.Algorithm,
+		}})
+		policies[0].prefix = config.KeyPrefix
+	}
+	routePolicies := map[string][]rateLimitPolicy{}
+	for route, p := range config.RoutePolicies {
+		routePolicies[route] = newRateLimitPolicies(store, config.KeyPrefix+route+":", p)
+	}
+	overrides := &rateLimitOverrides{store: store, prefix: config.KeyPrefix}
+	exemptions := newRateLimitExemptions(config.ExemptCIDRs, config.ExemptKeys)
+	breaker := newRateLimitBreaker(config.CircuitBreaker)
 
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			ip, err := getIPFromRequest(r)
-			if err != nil {
-				httpErr := errors.NewInternalServerError(
-					"failed to get determine rate limit for incoming request",
-					err,
-				).(*errors.HTTPError)
-				w.WriteHeader(httpErr.StatusCode)
-				w.Write([]byte(httpErr.JSON()))
+			fail := func(msg string, err error) {
+				httpErr := errors.NewInternalServerError(msg, err).(*errors.HTTPError)
+				config.ErrorHandler(w, r, httpErr)
 				if config.Logger != nil {
 					config.Logger.Error(
 						r.Context(),
@@ -113,94 +389,290 @@ func NewRateLimitMdwWithJSONError(config RateLimitConfig) func(next http.Handler
 						err,
 					)
 				}
-				return
 			}
 
-			rl, err := config.Store.GetLimit(ip)
+			ip, err := getIPFromRequest(r)
 			if err != nil {
-				httpErr := errors.NewInternalServerError(
-					"failed to get rate limit",
-					err,
-				).(*errors.HTTPError)
+				fail("failed to get determine rate limit for incoming request", err)
+				return
+			}
+			key, err := config.KeyFunc(r)
+			if err != nil {
+				fail("failed to get determine rate limit for incoming request", err)
+				return
+			}
+			if key == "" {
+				key = ip
+			}
+			if exemptions.exempt(ip, key) {
+				next.ServeHTTP(w, r)
+				return
+			}
 
-				w.WriteHeader(httpErr.StatusCode)
-				w.Write([]byte(httpErr.JSON()))
-				if config.Logger != nil {
-					config.Logger.Error(
-						r.Context(),
-						"middleware_rate_limiting_failed",
-						err,
-					)
+			policies := policies
+			if len(routePolicies) > 0 {
+				if p, ok := routeValue(routePolicies, r); ok {
+					policies = p
 				}
+			}
+			override, err := overrides.get(r)
+			if err != nil {
+				fail("failed to override the rate limit policies", err)
 				return
 			}
-			if rl == nil {
-				rl = &RateLimit{
-					IP:              ip,
-					LastRequestedAt: time.Now(),
-					Metric:          config.Metric,
-					Limit:           config.Limit,
-					Remaining:       config.Limit,
-				}
-				err := config.Store.UpsertLimit(*rl)
-				if err != nil {
-					httpErr := errors.NewInternalServerError(
-						"failed to update rate limit",
-						err,
-					).(*errors.HTTPError)
+			if override != nil {
+				policies = override
+			}
 
-					w.WriteHeader(httpErr.StatusCode)
-					w.Write([]byte(httpErr.JSON()))
-					if config.Logger != nil {
-						config.Logger.Error(
-							r.Context(),
-							"middleware_rate_limiting_failed",
-							err,
-						)
+			var reported RateLimit
+			for i, p := range policies {
+				rl, allowed, err := takeWithBreaker(r, breaker, p, key, config.Logger)
+				if err != nil {
+					if config.Metrics != nil {
+						config.Metrics.StoreError(r)
 					}
+					if config.FailurePolicy == RATE_LIMIT_FAIL_OPEN {
+						if config.Logger != nil {
+							config.Logger.Error(r.Context(), "middleware_rate_limiting_failed", err)
+						}
+						next.ServeHTTP(w, r)
+						return
+					}
+					fail("failed to take rate limit", err)
 					return
 				}
-			}
-			if rl.IsLimited() {
-				if !rl.CanReset() {
+				if !allowed {
 					err := errors.NewTooManyRequestsError(
 						"rate limit exceeded",
 						nil,
 					).(*errors.HTTPError)
-					rl.SetResponseHeaders(w)
-					w.WriteHeader(err.StatusCode)
-					w.Write(err.JSON())
+					if config.Metrics != nil {
+						config.Metrics.Limited(r)
+					}
+					setRateLimitHeaders(w, config.HeaderScheme, rl, policies)
+					rl.SetRetryAfterHeader(w)
+					config.ErrorHandler(w, r, err)
 					if config.Logger != nil {
-						config.Logger.ErrorWithData(r.Context(), "rate_limit_exceeded_error", err, map[string]any{"ip": ip})
+						config.Logger.ErrorWithData(r.Context(), "rate_limit_exceeded_error", err, map[string]any{
+							"ip":     ip,
+							"key":    key,
+							"policy": p.name,
+						})
 					}
 					return
 				}
-
-				rl.Reset()
+				if i == 0 || rl.Remaining < reported.Remaining {
+					reported = rl
+				}
 			}
 
-			rl.Decrement()
-			config.Store.UpsertLimit(*rl)
-			rl.SetResponseHeaders(w)
+			if config.Metrics != nil {
+				config.Metrics.Allowed(r)
+			}
+			if len(policies) > 0 {
+				setRateLimitHeaders(w, config.HeaderScheme, reported, policies)
+			}
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
-// getIPFromRequest returns the IP address of the request.
-func getIPFromRequest(r *http.Request) (string, error) {
-	if ip := r.Header.Get("X-Real-Ip"); ip != "" {
-		return ip, nil
+// takeWithBreaker takes the rate limit of key from the store of p unless
+// the circuit breaker is open, the changes of the circuit breaker state
+// are logged.
+func takeWithBreaker(
+	r *http.Request,
+	breaker *rateLimitBreaker,
+	p rateLimitPolicy,
+	key string,
+	l logger.Logger,
+) (RateLimit, bool, error) {
+	probe, err := breaker.allow()
+	if err != nil {
+		return RateLimit{}, false, err
+	}
+
+	rl, allowed, err := p.take(p.prefix + key)
+	changed := breaker.done(probe, err)
+	if l == nil {
+		return rl, allowed, err
 	}
 
-	if ip := r.Header.Get("X-Forwarded-For"); ip != "" {
-		return ip, nil
+	switch {
+	case changed && err != nil:
+		l.Error(r.Context(), "rate_limit_circuit_breaker_opened", err)
+	case changed:
+		l.Info(r.Context(), "rate_limit_circuit_breaker_closed")
 	}
 
-	ip, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		return "", err
+	return rl, allowed, err
+}
+
+// NewRateLimitOverrideMdw creates a new middleware that overrides the
+// policies of the rate limiting middlewares (see
+// [NewRateLimitMdwWithJSONError]) for the routes it is added to through
+// [github.com/iolave/go-betsi.Router.With]. Routes with no policies are
+// not rate limited. The override takes precedence over
+// [RateLimitConfig.RoutePolicies].
+//
+// The rate limiting middlewares run before the routes are matched, so
+// they find the overrides by walking the routes of the router when they
+// receive their first request. Routes registered later on are not
+// overridden.
+//
+// It panics when a policy is invalid.
+//
+// Example:
+//
+//	r.Use(middlewares.NewRateLimitMdwWithJSONError(middlewares.RateLimitConfig{
+//		Store:  store,
+//		Limit:  100,
+//		Metric: time.Minute,
+//	}))
+//	r.With(middlewares.NewRateLimitOverrideMdw(middlewares.RateLimitPolicy{
+//		Limit:  5,
+//		Metric: time.Minute,
+//	})).Post("/login", loginHandler)
+func NewRateLimitOverrideMdw(policies ...RateLimitPolicy) func(next http.Handler) http.Handler {
+	policies = validateRateLimitPolicies(policies)
+
+	return func(next http.Handler) http.Handler {
+		return &rateLimitOverrideHandler{policies: policies, next: next}
+	}
+}
+
+// rateLimitOverrideHandler is the handler returned by the middleware
+// of NewRateLimitOverrideMdw, it holds the overriding policies.
+type rateLimitOverrideHandler struct {
+	policies []RateLimitPolicy
+	next     http.Handler
+}
+
+func (h *rateLimitOverrideHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.next.ServeHTTP(w, r)
+}
+
+// rateLimitOverrides are the policies set by NewRateLimitOverrideMdw,
+// keyed by the method and pattern of their routes (i.e "POST /login").
+type rateLimitOverrides struct {
+	store  AtomicRateLimitStore
+	prefix string
+
+	once     sync.Once
+	policies map[string][]rateLimitPolicy
+	err      error
+}
+
+// get returns the overriding policies of the route of r, or nil
+// when it has none. The routes are walked on the first call.
+func (o *rateLimitOverrides) get(r *http.Request) ([]rateLimitPolicy, error) {
+	rc := chi.RouteContext(r.Context())
+	if rc == nil || rc.Routes == nil {
+		return nil, nil
+	}
+
+	o.once.Do(func() {
+		o.policies, o.err = o.walk(rc.Routes)
+	})
+	if o.err != nil || len(o.policies) == 0 {
+		return nil, o.err
+	}
+
+	p, ok := o.policies[r.Method+" "+routePattern(r)]
+	if !ok {
+		return nil, nil
+	}
+
+	return p, nil
+}
+
+// walk returns the overriding policies of the routes, bound to the store.
+// It fails when the store doesn't support a policy.
+func (o *rateLimitOverrides) walk(routes chi.Routes) (policies map[string][]rateLimitPolicy, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = errors.New(fmt.Sprint(rec))
+		}
+	}()
+
+	policies = map[string][]rateLimitPolicy{}
+	err = chi.Walk(routes, func(
+		method, route string,
+		handler http.Handler,
+		middlewares ...func(http.Handler) http.Handler,
+	) error {
+		// chi wraps the handlers of the routes with their middlewares
+		// when they are registered, the overrides are found by
+		// wrapping them once more.
+		for _, mdw := range middlewares {
+			h, ok := mdw(handler).(*rateLimitOverrideHandler)
+			if !ok {
+				continue
+			}
+			key := method + " " + route
+			policies[key] = newRateLimitPolicies(o.store, o.prefix+key+":", h.policies)
+		}
+		return nil
+	})
+
+	return policies, err
+}
+
+// validateRateLimitPolicies returns policies with their defaults set.
+// It panics when a policy is invalid.
+func validateRateLimitPolicies(policies []RateLimitPolicy) []RateLimitPolicy {
+	names := map[string]bool{}
+	validated := make([]RateLimitPolicy, 0, len(policies))
+	for _, p := range policies {
+		if p.Algorithm == "" {
+			p.Algorithm = RATE_LIMIT_FIXED_WINDOW
+		}
+		if !p.Algorithm.valid() {
+			panic("unknown rate limit algorithm " + string(p.Algorithm))
+		}
+		if p.Algorithm != RATE_LIMIT_FIXED_WINDOW && p.Metric <= 0 {
+			panic("metric has to be greater than zero")
+		}
+		if p.Name == "" {
+			p.Name = fmt.Sprintf("%s_%d_%s", p.Algorithm, p.Limit, p.Metric)
+		}
+		if names[p.Name] {
+			panic("duplicated rate limit policy " + p.Name)
+		}
+		names[p.Name] = true
+		validated = append(validated, p)
+	}
+
+	return validated
+}
+
+// newRateLimitPolicies validates policies and binds them to store, the
+// keys of every policy are prefixed with prefix and the policy name.
+// It panics when a policy is invalid or store doesn't support it.
+func newRateLimitPolicies(store AtomicRateLimitStore, prefix string, policies []RateLimitPolicy) []rateLimitPolicy {
+	bound := make([]rateLimitPolicy, 0, len(policies))
+	for _, p := range validateRateLimitPolicies(policies) {
+		take := func(key string) (RateLimit, bool, error) {
+			return store.Take(key, p.Limit, p.Metric)
+		}
+		if p.Algorithm != RATE_LIMIT_FIXED_WINDOW {
+			s, ok := store.(AlgorithmRateLimitStore)
+			if !ok {
+				panic("store doesn't support the " + string(p.Algorithm) + " algorithm")
+			}
+			take = func(key string) (RateLimit, bool, error) {
+				return s.TakeWithAlgorithm(key, p.Limit, p.Metric, p.Algorithm)
+			}
+		}
+
+		bound = append(bound, rateLimitPolicy{
+			name:   p.Name,
+			prefix: prefix + p.Name + ":",
+			limit:  p.Limit,
+			metric: p.Metric,
+			take:   take,
+		})
 	}
 
-	return ip, nil
+	return bound
 }
@@ -0,0 +1,259 @@
+package middlewares
+
+import (
+	"math"
+	"time"
+)
+
+// RateLimitAlgorithm is the algorithm used to limit the requests.
+type RateLimitAlgorithm string
+
+const (
+	// RATE_LIMIT_FIXED_WINDOW allows Limit requests per window, the
+	// window starts with the first request and its requests are reset
+	// once it ends. Clients can send up to twice the limit around the
+	// window boundaries.
+	RATE_LIMIT_FIXED_WINDOW RateLimitAlgorithm = "fixed_window"
+
+	// RATE_LIMIT_TOKEN_BUCKET allows bursts of up to Limit requests and
+	// refills the bucket at a rate of Limit requests per window.
+	RATE_LIMIT_TOKEN_BUCKET RateLimitAlgorithm = "token_bucket"
+
+	// RATE_LIMIT_SLIDING_WINDOW_LOG keeps the time of the requests of
+	// the last window and allows Limit of them. It is exact, but it
+	// stores up to Limit timestamps per key.
+	RATE_LIMIT_SLIDING_WINDOW_LOG RateLimitAlgorithm = "sliding_window_log"
+
+	// RATE_LIMIT_SLIDING_WINDOW_COUNTER approximates the sliding window
+	// by weighting the count of the previous window with the portion of
+	// it that overlaps the sliding window. It only stores two counters
+	// per key.
+	RATE_LIMIT_SLIDING_WINDOW_COUNTER RateLimitAlgorithm = "sliding_window_counter"
+)
+
+// valid returns true if a is a known algorithm.
+func (a RateLimitAlgorithm) valid() bool {
+	switch a {
+	case RATE_LIMIT_FIXED_WINDOW,
+		RATE_LIMIT_TOKEN_BUCKET,
+		RATE_LIMIT_SLIDING_WINDOW_LOG,
+		RATE_LIMIT_SLIDING_WINDOW_COUNTER:
+		return true
+	}
+
+	return false
+}
+
+// takeRateLimit takes a request from rl using algorithm, rl is reset when
+// it is nil or it was created by another algorithm. It returns the rate
+// limit after taking the request and whether the request is allowed, rl
+// is not modified.
+//
+// The returned rate limit of a denied request is only updated with the
+// time passed since rl was taken, so stores don't need to store it.
+func takeRateLimit(
+	rl *RateLimit,
+	key string,
+	limit int,
+	window time.Duration,
+	algorithm RateLimitAlgorithm,
+	now time.Time,
+) (RateLimit, bool) {
+	if algorithm == "" {
+		algorithm = RATE_LIMIT_FIXED_WINDOW
+	}
+
+	taken := RateLimit{
+		IP:        key,
+		Algorithm: algorithm,
+		Metric:    window,
+		Limit:     limit,
+		Remaining: limit,
+	}
+	if rl != nil && rl.algorithm() == algorithm {
+		taken = *rl
+		taken.Log = append([]time.Time{}, rl.Log...)
+		taken.Algorithm = algorithm
+	}
+	if limit <= 0 {
+		taken.Remaining = 0
+		taken.ResetAt = now.Add(window)
+		return taken, false
+	}
+
+	var allowed bool
+	switch algorithm {
+	case RATE_LIMIT_TOKEN_BUCKET:
+		allowed = takeTokenBucket(&taken, limit, window, now)
+	case RATE_LIMIT_SLIDING_WINDOW_LOG:
+		allowed = takeSlidingWindowLog(&taken, limit, window, now)
+	case RATE_LIMIT_SLIDING_WINDOW_COUNTER:
+		allowed = takeSlidingWindowCounter(&taken, limit, window, now)
+	default:
+		allowed = takeFixedWindow(&taken, limit, window, now)
+	}
+
+	return taken, allowed
+}
+
+// takeFixedWindow starts a new window when rl doesn't have one or it has
+// ended, LastRequestedAt is the start of the window.
+func takeFixedWindow(rl *RateLimit, limit int, window time.Duration, now time.Time) bool {
+	if rl.LastRequestedAt.IsZero() || !now.Before(rl.LastRequestedAt.Add(rl.Metric)) {
+		rl.LastRequestedAt = now
+		rl.Metric = window
+		rl.Limit = limit
+		rl.Remaining = limit
+	}
+	rl.ResetAt = rl.LastRequestedAt.Add(rl.Metric)
+
+	if rl.IsLimited() {
+		return false
+	}
+	rl.Decrement()
+
+	return true
+}
+
+// takeTokenBucket refills the bucket with the tokens generated since
+// LastRequestedAt (the last refill) and takes a token from it.
+func takeTokenBucket(rl *RateLimit, limit int, window time.Duration, now time.Time) bool {
+	if rl.LastRequestedAt.IsZero() {
+		rl.Tokens = float64(limit)
+	} else if elapsed := now.Sub(rl.LastRequestedAt); elapsed > 0 {
+		rl.Tokens += float64(limit) * float64(elapsed) / float64(window)
+	}
+	rl.Tokens = min(rl.Tokens, float64(limit))
+	rl.LastRequestedAt = now
+	rl.Metric = window
+	rl.Limit = limit
+
+	allowed := rl.Tokens >= 1
+	if allowed {
+		rl.Tokens--
+	}
+	rl.Remaining = int(math.Floor(rl.Tokens))
+
+	// Time it takes to generate a token.
+	perToken := float64(window) / float64(limit)
+	if rl.Remaining == 0 {
+		rl.ResetAt = now.Add(time.Duration(math.Ceil((1 - rl.Tokens) * perToken)))
+	} else {
+		rl.ResetAt = now.Add(time.Duration(math.Ceil((float64(limit) - rl.Tokens) * perToken)))
+	}
+
+	return allowed
+}
+
+// takeSlidingWindowLog removes the requests that are out of the sliding
+// window from the log and logs the request if there's room for it.
+func takeSlidingWindowLog(rl *RateLimit, limit int, window time.Duration, now time.Time) bool {
+	start := now.Add(-window)
+	i := 0
+	for i < len(rl.Log) && !rl.Log[i].After(start) {
+		i++
+	}
+	rl.Log = rl.Log[i:]
+	rl.Metric = window
+	rl.Limit = limit
+
+	allowed := len(rl.Log) < limit
+	if allowed {
+		rl.Log = append(rl.Log, now)
+		rl.LastRequestedAt = now
+	}
+	rl.Remaining = max(limit-len(rl.Log), 0)
+
+	switch {
+	case len(rl.Log) == 0:
+		rl.ResetAt = now
+	case rl.Remaining == 0:
+		// The oldest request leaving the window makes room.
+		rl.ResetAt = rl.Log[max(len(rl.Log)-limit, 0)].Add(window)
+	default:
+		rl.ResetAt = rl.Log[len(rl.Log)-1].Add(window)
+	}
+
+	return allowed
+}
+
+// takeSlidingWindowCounter rolls the windows aligned to window when the
+// current one (starting at LastRequestedAt) has ended, and counts the
+// request if the estimated requests of the sliding window are below the
+// limit. The estimation is the count of the current window plus the
+// count of the previous one weighted by its overlap with the sliding
+// window.
+func takeSlidingWindowCounter(rl *RateLimit, limit int, window time.Duration, now time.Time) bool {
+	start := now.Truncate(window)
+	switch {
+	case rl.LastRequestedAt.Equal(start):
+	case rl.LastRequestedAt.Add(window).Equal(start):
+		rl.PreviousCount, rl.Count = rl.Count, 0
+	default:
+		rl.PreviousCount, rl.Count = 0, 0
+	}
+	rl.LastRequestedAt = start
+	rl.Metric = window
+	rl.Limit = limit
+
+	weight := 1 - float64(now.Sub(start))/float64(window)
+	estimated := float64(rl.PreviousCount)*weight + float64(rl.Count)
+	allowed := estimated+1 <= float64(limit)
+	if allowed {
+		rl.Count++
+		estimated++
+	}
+	rl.Remaining = max(int(math.Floor(float64(limit)-estimated)), 0)
+
+	if rl.Remaining > 0 {
+		// Both windows have to end for the limit to be fully restored.
+		rl.ResetAt = start.Add(2 * window)
+		return allowed
+	}
+
+	// Time at which the estimation leaves room for one more request.
+	room := float64(limit - 1)
+	switch {
+	case rl.Count <= limit-1 && rl.PreviousCount > 0:
+		w := (room - float64(rl.Count)) / float64(rl.PreviousCount)
+		rl.ResetAt = start.Add(time.Duration(math.Ceil((1 - w) * float64(window))))
+	default:
+		// The current window becomes the previous one.
+		w := room / float64(rl.Count)
+		rl.ResetAt = start.Add(window).Add(time.Duration(math.Ceil((1 - w) * float64(window))))
+	}
+
+	return allowed
+}
+
+// algorithm returns the algorithm of r, rate limits without one
+// were created by the fixed window algorithm.
+func (r RateLimit) algorithm() RateLimitAlgorithm {
+	if r.Algorithm == "" {
+		return RATE_LIMIT_FIXED_WINDOW
+	}
+
+	return r.Algorithm
+}
+
+// expiresAt returns the time after which r is equivalent to a
+// rate limit that doesn't exist, so stores can drop it.
+func (r RateLimit) expiresAt() time.Time {
+	switch r.algorithm() {
+	case RATE_LIMIT_TOKEN_BUCKET:
+		if r.Limit <= 0 {
+			return r.LastRequestedAt.Add(r.Metric)
+		}
+		missing := float64(r.Limit) - r.Tokens
+		return r.LastRequestedAt.Add(time.Duration(math.Ceil(missing * float64(r.Metric) / float64(r.Limit))))
+	case RATE_LIMIT_SLIDING_WINDOW_LOG:
+		if len(r.Log) == 0 {
+			return r.LastRequestedAt
+		}
+		return r.Log[len(r.Log)-1].Add(r.Metric)
+	case RATE_LIMIT_SLIDING_WINDOW_COUNTER:
+		return r.LastRequestedAt.Add(2 * r.Metric)
+	}
+
+	return r.LastRequestedAt.Add(r.Metric)
+}
@@ -0,0 +1,160 @@
+package middlewares
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/iolave/go-betsi/internal/resp/resptest"
+)
+
+func TestTakeRateLimitAlgorithms(t *testing.T) {
+	t0 := time.Unix(1_700_000_000, 0)
+
+	type Take struct {
+		At            time.Duration
+		WantAllowed   bool
+		WantRemaining int
+		WantReset     time.Duration
+	}
+	type TestCase struct {
+		Name      string
+		Algorithm RateLimitAlgorithm
+		Limit     int
+		Takes     []Take
+	}
+
+	testCases := []TestCase{}
+	testCases = append(testCases, TestCase{
+		Name:      "fixed window should reset once the window ends",
+		Algorithm: RATE_LIMIT_FIXED_WINDOW,
+		Limit:     2,
+		Takes: []Take{
+			{At: 0, WantAllowed: true, WantRemaining: 1, WantReset: 10 * time.Second},
+			{At: time.Second, WantAllowed: true, WantRemaining: 0, WantReset: 10 * time.Second},
+			{At: 9 * time.Second, WantAllowed: false, WantRemaining: 0, WantReset: 10 * time.Second},
+			{At: 10 * time.Second, WantAllowed: true, WantRemaining: 1, WantReset: 20 * time.Second},
+		},
+	})
+	testCases = append(testCases, TestCase{
+		Name:      "token bucket should refill over time",
+		Algorithm: RATE_LIMIT_TOKEN_BUCKET,
+		Limit:     2,
+		Takes: []Take{
+			{At: 0, WantAllowed: true, WantRemaining: 1, WantReset: 5 * time.Second},
+			{At: 0, WantAllowed: true, WantRemaining: 0, WantReset: 5 * time.Second},
+			{At: 0, WantAllowed: false, WantRemaining: 0, WantReset: 5 * time.Second},
+			{At: 5 * time.Second, WantAllowed: true, WantRemaining: 0, WantReset: 10 * time.Second},
+			{At: 20 * time.Second, WantAllowed: true, WantRemaining: 1, WantReset: 25 * time.Second},
+		},
+	})
+	testCases = append(testCases, TestCase{
+		Name:      "sliding window log should free requests as they leave the window",
+		Algorithm: RATE_LIMIT_SLIDING_WINDOW_LOG,
+		Limit:     2,
+		Takes: []Take{
+			{At: 0, WantAllowed: true, WantRemaining: 1, WantReset: 10 * time.Second},
+			{At: time.Second, WantAllowed: true, WantRemaining: 0, WantReset: 10 * time.Second},
+			{At: 5 * time.Second, WantAllowed: false, WantRemaining: 0, WantReset: 10 * time.Second},
+			{At: 10 * time.Second, WantAllowed: true, WantRemaining: 0, WantReset: 11 * time.Second},
+		},
+	})
+	testCases = append(testCases, TestCase{
+		Name:      "sliding window counter should weight the previous window",
+		Algorithm: RATE_LIMIT_SLIDING_WINDOW_COUNTER,
+		Limit:     4,
+		Takes: []Take{
+			{At: 0, WantAllowed: true, WantRemaining: 3, WantReset: 20 * time.Second},
+			{At: time.Second, WantAllowed: true, WantRemaining: 2, WantReset: 20 * time.Second},
+			{At: 2 * time.Second, WantAllowed: true, WantRemaining: 1, WantReset: 20 * time.Second},
+			{At: 3 * time.Second, WantAllowed: true, WantRemaining: 0, WantReset: 12500 * time.Millisecond},
+			{At: 5 * time.Second, WantAllowed: false, WantRemaining: 0, WantReset: 12500 * time.Millisecond},
+			{At: 12500 * time.Millisecond, WantAllowed: true, WantRemaining: 0, WantReset: 15 * time.Second},
+		},
+	})
+
+	for _, tt := range testCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			var rl *RateLimit
+			for i, take := range tt.Takes {
+				taken, allowed := takeRateLimit(rl, "1.1.1.1", tt.Limit, 10*time.Second, tt.Algorithm, t0.Add(take.At))
+				if allowed != take.WantAllowed {
+					t.Errorf("take %d got allowed %v, want %v", i, allowed, take.WantAllowed)
+				}
+				if taken.Remaining != take.WantRemaining {
+					t.Errorf("take %d got remaining %d, want %d", i, taken.Remaining, take.WantRemaining)
+				}
+				if want := t0.Add(take.WantReset); !taken.ResetAt.Equal(want) {
+					t.Errorf("take %d got reset %v, want %v", i, taken.ResetAt.Sub(t0), take.WantReset)
+				}
+				if taken.Algorithm != tt.Algorithm {
+					t.Errorf("take %d got algorithm %s, want %s", i, taken.Algorithm, tt.Algorithm)
+				}
+				rl = &taken
+			}
+		})
+	}
+}
+
+func TestTakeRateLimitAlgorithmChange(t *testing.T) {
+	now := time.Now()
+	rl, _ := takeRateLimit(nil, "1.1.1.1", 1, time.Minute, RATE_LIMIT_FIXED_WINDOW, now)
+
+	_, allowed := takeRateLimit(&rl, "1.1.1.1", 1, time.Minute, RATE_LIMIT_FIXED_WINDOW, now)
+	if allowed {
+		t.Errorf("expected the fixed window to be exhausted")
+	}
+	_, allowed = takeRateLimit(&rl, "1.1.1.1", 1, time.Minute, RATE_LIMIT_TOKEN_BUCKET, now)
+	if !allowed {
+		t.Errorf("expected the rate limit to be reset by the algorithm change")
+	}
+}
+
+func TestRateLimitSetResponseHeaders(t *testing.T) {
+	w := httptest.NewRecorder()
+	RateLimit{
+		Limit:     10,
+		Remaining: 3,
+		ResetAt:   time.Unix(100, int64(time.Millisecond)),
+	}.SetResponseHeaders(w)
+
+	if got := w.Header().Get("X-Rate-Limit-Reset"); got != "101" {
+		t.Errorf("got reset %s, want 101", got)
+	}
+	if got := w.Header().Get("X-Rate-Limit-Remaining"); got != "3" {
+		t.Errorf("got remaining %s, want 3", got)
+	}
+}
+
+func TestRateLimitAlgorithmStores(t *testing.T) {
+	srv := resptest.NewServer()
+	defer srv.Close()
+
+	stores := map[string]AlgorithmRateLimitStore{
+		"memory": NewMemoryRateLimitStore(MemoryRateLimitStoreConfig{}),
+		"redis":  NewRedisRateLimitStore(RedisRateLimitStoreConfig{Addr: srv.Addr}),
+		"locked": NewAtomicRateLimitStore(&mapRateLimitStore{limits: map[string]RateLimit{}}).(AlgorithmRateLimitStore),
+	}
+	algorithms := []RateLimitAlgorithm{
+		RATE_LIMIT_TOKEN_BUCKET,
+		RATE_LIMIT_SLIDING_WINDOW_LOG,
+		RATE_LIMIT_SLIDING_WINDOW_COUNTER,
+	}
+
+	for name, s := range stores {
+		for _, algorithm := range algorithms {
+			t.Run(name+"/"+string(algorithm), func(t *testing.T) {
+				key := name + string(algorithm)
+				for i, want := range []bool{true, true, true, false} {
+					_, allowed, err := s.TakeWithAlgorithm(key, 3, time.Hour, algorithm)
+					if err != nil {
+						t.Fatalf("take %d got error %v", i, err)
+					}
+					if allowed != want {
+						t.Errorf("take %d got allowed %v, want %v", i, allowed, want)
+					}
+				}
+			})
+		}
+	}
+}
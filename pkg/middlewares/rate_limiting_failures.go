@@ -0,0 +1,203 @@
+package middlewares
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/iolave/go-errors"
+)
+
+// Rate limiting errors
+const (
+	ERR_NAME_RATE_LIMIT         = "rate_limit_error"
+	ERR_RATE_LIMIT_CIRCUIT_OPEN = "rate limit store circuit breaker is open"
+)
+
+// DEFAULT_RATE_LIMIT_BREAKER_COOLDOWN is the default time the
+// circuit breaker of the rate limit store stays open.
+const DEFAULT_RATE_LIMIT_BREAKER_COOLDOWN = 30 * time.Second
+
+// RateLimitFailurePolicy is how the rate limiting middleware handles
+// requests whose rate limit can't be taken from the store.
+type RateLimitFailurePolicy string
+
+const (
+	// RATE_LIMIT_FAIL_CLOSED responds the requests with a 500 error.
+	RATE_LIMIT_FAIL_CLOSED RateLimitFailurePolicy = "fail_closed"
+
+	// RATE_LIMIT_FAIL_OPEN allows the requests without rate limiting
+	// them, so a store outage doesn't block the traffic.
+	RATE_LIMIT_FAIL_OPEN RateLimitFailurePolicy = "fail_open"
+)
+
+// valid returns true if p is a known failure policy.
+func (p RateLimitFailurePolicy) valid() bool {
+	return p == RATE_LIMIT_FAIL_CLOSED || p == RATE_LIMIT_FAIL_OPEN
+}
+
+// RateLimitCircuitBreakerConfig is the configuration for the circuit
+// breaker around the rate limit store.
+type RateLimitCircuitBreakerConfig struct {
+	// Threshold is the number of consecutive store errors that open
+	// the circuit, zero disables the circuit breaker. While the
+	// circuit is open, the store is not called and requests are
+	// handled with the failure policy.
+	Threshold int
+
+	// Cooldown is the time the circuit stays open before a single
+	// request is sent to the store to probe it, the circuit is closed
+	// when it succeeds. Defaults to DEFAULT_RATE_LIMIT_BREAKER_COOLDOWN.
+	Cooldown time.Duration
+}
+
+// RateLimitMetrics receives the outcome of every request handled by the
+// rate limiting middleware, so it can be exported to a metrics backend.
+// Implementations must be safe for concurrent use.
+type RateLimitMetrics interface {
+	// Allowed is called for requests allowed by the rate limit.
+	Allowed(r *http.Request)
+
+	// Limited is called for requests denied by the rate limit.
+	Limited(r *http.Request)
+
+	// StoreError is called for requests whose rate limit couldn't
+	// be taken from the store, including the ones rejected by the
+	// open circuit breaker.
+	StoreError(r *http.Request)
+}
+
+// RateLimitStats are the counters of [RateLimitCounters].
+type RateLimitStats struct {
+	// Allowed is the number of requests allowed by the rate limit.
+	Allowed uint64 `json:"allowed"`
+
+	// Limited is the number of requests denied by the rate limit.
+	Limited uint64 `json:"limited"`
+
+	// StoreErrors is the number of requests whose rate limit
+	// couldn't be taken from the store.
+	StoreErrors uint64 `json:"storeErrors"`
+}
+
+// RateLimitCounters is a [RateLimitMetrics] that counts the requests.
+//
+// Example:
+//
+//	counters := &middlewares.RateLimitCounters{}
+//	r.Use(middlewares.NewRateLimitMdwWithJSONError(middlewares.RateLimitConfig{
+//		Store:   store,
+//		Metric:  time.Minute,
+//		Limit:   60,
+//		Metrics: counters,
+//	}))
+//
+//	stats := counters.Stats()
+type RateLimitCounters struct {
+	allowed     atomic.Uint64
+	limited     atomic.Uint64
+	storeErrors atomic.Uint64
+}
+
+func (c *RateLimitCounters) Allowed(*http.Request)    { c.allowed.Add(1) }
+func (c *RateLimitCounters) Limited(*http.Request)    { c.limited.Add(1) }
+func (c *RateLimitCounters) StoreError(*http.Request) { c.storeErrors.Add(1) }
+
+// Stats returns the current counters.
+func (c *RateLimitCounters) Stats() RateLimitStats {
+	return RateLimitStats{
+		Allowed:     c.allowed.Load(),
+		Limited:     c.limited.Load(),
+		StoreErrors: c.storeErrors.Load(),
+	}
+}
+
+// rateLimitBreaker is a circuit breaker around the rate limit store.
+type rateLimitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	open     bool
+	probing  bool
+}
+
+// newRateLimitBreaker returns a new circuit breaker, it is
+// nil (and always closed) when cfg.Threshold is not positive.
+func newRateLimitBreaker(cfg RateLimitCircuitBreakerConfig) *rateLimitBreaker {
+	if cfg.Threshold <= 0 {
+		return nil
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = DEFAULT_RATE_LIMIT_BREAKER_COOLDOWN
+	}
+
+	return &rateLimitBreaker{
+		threshold: cfg.Threshold,
+		cooldown:  cfg.Cooldown,
+		now:       time.Now,
+	}
+}
+
+// allow returns an error if the store must not be called. Once the
+// cooldown ends, a single call is allowed to probe the store, in which
+// case probe is true.
+func (b *rateLimitBreaker) allow() (probe bool, err error) {
+	if b == nil {
+		return false, nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.open {
+		return false, nil
+	}
+	if b.probing || b.now().Before(b.openedAt.Add(b.cooldown)) {
+		return false, errors.NewWithName(ERR_NAME_RATE_LIMIT, ERR_RATE_LIMIT_CIRCUIT_OPEN)
+	}
+	b.probing = true
+
+	return true, nil
+}
+
+// done records the result of an allowed call and returns true if
+// it changed the state of the circuit (opened or closed it).
+func (b *rateLimitBreaker) done(probe bool, err error) bool {
+	if b == nil {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.open {
+		if !probe {
+			// The circuit was opened by another call meanwhile.
+			return false
+		}
+		b.probing = false
+		if err != nil {
+			b.openedAt = b.now()
+			return false
+		}
+		b.open, b.failures = false, 0
+		return true
+	}
+
+	if err == nil {
+		b.failures = 0
+		return false
+	}
+	b.failures++
+	if b.failures < b.threshold {
+		return false
+	}
+	b.open, b.openedAt = true, b.now()
+
+	return true
+}
@@ -0,0 +1,139 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// failingRateLimitStore is a RateLimitStore whose calls fail
+// while failing is true.
+type failingRateLimitStore struct {
+	mapRateLimitStore
+	failing atomic.Bool
+	calls   atomic.Int64
+}
+
+func (s *failingRateLimitStore) GetLimit(ip string) (*RateLimit, error) {
+	s.calls.Add(1)
+	if s.failing.Load() {
+		return nil, fmt.Errorf("store is down")
+	}
+	return s.mapRateLimitStore.GetLimit(ip)
+}
+
+func TestRateLimitFailurePolicies(t *testing.T) {
+	type TestCase struct {
+		Name           string
+		FailurePolicy  RateLimitFailurePolicy
+		CircuitBreaker RateLimitCircuitBreakerConfig
+		Requests       int
+		WantStatus     int
+		WantCalls      int64
+		WantStats      RateLimitStats
+	}
+
+	testCases := []TestCase{}
+	testCases = append(testCases, TestCase{
+		Name:       "fail closed should be the default",
+		Requests:   3,
+		WantStatus: http.StatusInternalServerError,
+		WantCalls:  3,
+		WantStats:  RateLimitStats{StoreErrors: 3},
+	})
+	testCases = append(testCases, TestCase{
+		Name:          "fail open should allow the requests",
+		FailurePolicy: RATE_LIMIT_FAIL_OPEN,
+		Requests:      3,
+		WantStatus:    http.StatusOK,
+		WantCalls:     3,
+		WantStats:     RateLimitStats{StoreErrors: 3},
+	})
+	testCases = append(testCases, TestCase{
+		Name:           "open circuit should not call the store",
+		FailurePolicy:  RATE_LIMIT_FAIL_OPEN,
+		CircuitBreaker: RateLimitCircuitBreakerConfig{Threshold: 2, Cooldown: time.Hour},
+		Requests:       5,
+		WantStatus:     http.StatusOK,
+		WantCalls:      2,
+		WantStats:      RateLimitStats{StoreErrors: 5},
+	})
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			store := &failingRateLimitStore{mapRateLimitStore: mapRateLimitStore{limits: map[string]RateLimit{}}}
+			store.failing.Store(true)
+			counters := &RateLimitCounters{}
+			h := NewRateLimitMdwWithJSONError(RateLimitConfig{
+				Store:          store,
+				Metric:         time.Minute,
+				Limit:          10,
+				FailurePolicy:  tc.FailurePolicy,
+				CircuitBreaker: tc.CircuitBreaker,
+				Metrics:        counters,
+			})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			for i := range tc.Requests {
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				req.RemoteAddr = "1.1.1.1:1234"
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, req)
+				if w.Code != tc.WantStatus {
+					t.Errorf("request %d got status %d, want %d", i, w.Code, tc.WantStatus)
+				}
+			}
+
+			if got := store.calls.Load(); got != tc.WantCalls {
+				t.Errorf("got %d store calls, want %d", got, tc.WantCalls)
+			}
+			if got := counters.Stats(); got != tc.WantStats {
+				t.Errorf("got stats %+v, want %+v", got, tc.WantStats)
+			}
+		})
+	}
+}
+
+func TestRateLimitBreaker(t *testing.T) {
+	clock := &testClock{now: time.Unix(1_700_000_000, 0)}
+	b := newRateLimitBreaker(RateLimitCircuitBreakerConfig{Threshold: 2, Cooldown: time.Minute})
+	b.now = clock.Now
+	fail := fmt.Errorf("store is down")
+
+	// Two consecutive failures open the circuit.
+	b.done(false, fail)
+	if !b.done(false, fail) {
+		t.Fatalf("circuit should have been opened")
+	}
+	if _, err := b.allow(); err == nil {
+		t.Fatalf("open circuit should reject calls")
+	}
+
+	// Once the cooldown ends, a single probe is allowed.
+	clock.Advance(time.Minute)
+	probe, err := b.allow()
+	if err != nil || !probe {
+		t.Fatalf("got probe %v and error %v, want a probe", probe, err)
+	}
+	if _, err := b.allow(); err == nil {
+		t.Fatalf("calls should be rejected while probing")
+	}
+
+	// A failed probe keeps the circuit open for another cooldown.
+	b.done(true, fail)
+	if _, err := b.allow(); err == nil {
+		t.Fatalf("circuit should still be open")
+	}
+
+	// A successful probe closes it.
+	clock.Advance(time.Minute)
+	probe, _ = b.allow()
+	if !b.done(probe, nil) {
+		t.Fatalf("circuit should have been closed")
+	}
+	if probe, err := b.allow(); err != nil || probe {
+		t.Fatalf("closed circuit should allow calls")
+	}
+}
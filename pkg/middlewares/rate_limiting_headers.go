@@ -0,0 +1,95 @@
+package middlewares
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateLimitHeaderScheme is the scheme of the rate limit response headers.
+type RateLimitHeaderScheme string
+
+const (
+	// RATE_LIMIT_HEADERS_LEGACY sends the X-Rate-Limit-Limit,
+	// X-Rate-Limit-Remaining and X-Rate-Limit-Reset headers, where
+	// the reset is a unix timestamp.
+	RATE_LIMIT_HEADERS_LEGACY RateLimitHeaderScheme = "legacy"
+
+	// RATE_LIMIT_HEADERS_IETF sends the RateLimit and RateLimit-Policy
+	// headers of the IETF draft (draft-ietf-httpapi-ratelimit-headers-07),
+	// where the reset is the number of seconds until the reset.
+	RATE_LIMIT_HEADERS_IETF RateLimitHeaderScheme = "ietf"
+
+	// RATE_LIMIT_HEADERS_BOTH sends the headers of both schemes.
+	RATE_LIMIT_HEADERS_BOTH RateLimitHeaderScheme = "both"
+)
+
+// valid returns true if s is a known scheme.
+func (s RateLimitHeaderScheme) valid() bool {
+	switch s {
+	case RATE_LIMIT_HEADERS_LEGACY, RATE_LIMIT_HEADERS_IETF, RATE_LIMIT_HEADERS_BOTH:
+		return true
+	}
+
+	return false
+}
+
+// SetIETFResponseHeaders sets the RateLimit response header of the IETF
+// draft for the rate limit (i.e "limit=10, remaining=9, reset=60"), the
+// reset is the number of seconds until ResetAt (rounded up), or until the
+// end of the fixed window when it's not set.
+func (r RateLimit) SetIETFResponseHeaders(w http.ResponseWriter) {
+	w.Header().Set("RateLimit", fmt.Sprintf(
+		"limit=%d, remaining=%d, reset=%d",
+		r.Limit,
+		max(r.Remaining, 0),
+		r.resetSeconds(time.Now()),
+	))
+}
+
+// SetRetryAfterHeader sets the Retry-After response header to the number
+// of seconds until the rate limit allows the next request.
+func (r RateLimit) SetRetryAfterHeader(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", strconv.FormatInt(r.resetSeconds(time.Now()), 10))
+}
+
+// reset returns ResetAt or the end of the fixed window when it's not set.
+func (r RateLimit) reset() time.Time {
+	if !r.ResetAt.IsZero() {
+		return r.ResetAt
+	}
+
+	return r.LastRequestedAt.Add(r.Metric)
+}
+
+// resetSeconds returns the seconds from now until the reset, rounded up.
+func (r RateLimit) resetSeconds(now time.Time) int64 {
+	d := r.reset().Sub(now)
+	if d <= 0 {
+		return 0
+	}
+
+	return int64(math.Ceil(d.Seconds()))
+}
+
+// setRateLimitHeaders sets the headers of scheme for rl, where policies
+// are the policies the request was taken from.
+func setRateLimitHeaders(w http.ResponseWriter, scheme RateLimitHeaderScheme, rl RateLimit, policies []rateLimitPolicy) {
+	if scheme != RATE_LIMIT_HEADERS_IETF {
+		rl.SetResponseHeaders(w)
+	}
+	if scheme == RATE_LIMIT_HEADERS_LEGACY {
+		return
+	}
+
+	rl.SetIETFResponseHeaders(w)
+	values := make([]string, 0, len(policies))
+	for _, p := range policies {
+		window := int64(math.Ceil(p.metric.Seconds()))
+		values = append(values, fmt.Sprintf("%d;w=%d", p.limit, window))
+	}
+	w.Header().Set("RateLimit-Policy", strings.Join(values, ", "))
+}
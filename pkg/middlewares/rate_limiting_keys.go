@@ -0,0 +1,200 @@
+package middlewares
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// RateLimitKeyFunc returns the key a request is rate limited by.
+// Requests whose key is empty are rate limited by their IP.
+type RateLimitKeyFunc func(r *http.Request) (string, error)
+
+// RateLimitKeyByIP limits the requests by their IP. It is the
+// default key of the rate limiting middleware.
+func RateLimitKeyByIP(r *http.Request) (string, error) {
+	return getIPFromRequest(r)
+}
+
+// RateLimitKeyByHeader limits the requests by the value of header
+// (i.e an API key or a tenant header), requests without it are
+// limited by their IP.
+func RateLimitKeyByHeader(header string) RateLimitKeyFunc {
+	prefix := strings.ToLower(header) + ":"
+
+	return func(r *http.Request) (string, error) {
+		v := r.Header.Get(header)
+		if v == "" {
+			return "", nil
+		}
+
+		return prefix + v, nil
+	}
+}
+
+// RateLimitKeyByContextValue limits the requests by the value of
+// key within the request context (i.e the user ID stored by an
+// authentication middleware), requests without it are limited by
+// their IP.
+func RateLimitKeyByContextValue(key any) RateLimitKeyFunc {
+	return func(r *http.Request) (string, error) {
+		v := r.Context().Value(key)
+		if v == nil {
+			return "", nil
+		}
+
+		return fmt.Sprint(v), nil
+	}
+}
+
+// RateLimitKeyByJWTClaim limits the requests by a claim (i.e "sub") of
+// the bearer token of the Authorization header, requests without it are
+// limited by their IP.
+//
+// The token signature is NOT verified, so the middleware has to be used
+// after an authentication middleware that rejects invalid tokens.
+// Otherwise clients can send forged claims to avoid being limited.
+func RateLimitKeyByJWTClaim(claim string) RateLimitKeyFunc {
+	prefix := claim + ":"
+
+	return func(r *http.Request) (string, error) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			return "", nil
+		}
+
+		parts := strings.Split(strings.TrimSpace(token), ".")
+		if len(parts) != 3 {
+			return "", nil
+		}
+		b, err := base64.RawURLEncoding.DecodeString(parts[1])
+		if err != nil {
+			return "", nil
+		}
+		claims := map[string]any{}
+		if err := json.Unmarshal(b, &claims); err != nil {
+			return "", nil
+		}
+
+		v, ok := claims[claim]
+		if !ok || v == nil {
+			return "", nil
+		}
+
+		return prefix + fmt.Sprint(v), nil
+	}
+}
+
+// RateLimitKeyByRoute limits the requests by their method and route
+// pattern along with the key returned by keyFunc, so every route has
+// its own rate limit. keyFunc defaults to [RateLimitKeyByIP].
+func RateLimitKeyByRoute(keyFunc RateLimitKeyFunc) RateLimitKeyFunc {
+	if keyFunc == nil {
+		keyFunc = RateLimitKeyByIP
+	}
+
+	return func(r *http.Request) (string, error) {
+		key, err := keyFunc(r)
+		if err != nil {
+			return "", err
+		}
+		if key == "" {
+			if key, err = getIPFromRequest(r); err != nil {
+				return "", err
+			}
+		}
+
+		return r.Method + " " + routePattern(r) + ":" + key, nil
+	}
+}
+
+// routePattern returns the route pattern (i.e "/users/{id}") the
+// request is routed to, or its path when no route matches it.
+func routePattern(r *http.Request) string {
+	rc := chi.RouteContext(r.Context())
+	if rc == nil || rc.Routes == nil {
+		return r.URL.Path
+	}
+
+	// Middlewares added with With run once the route is matched.
+	if n := len(rc.RoutePatterns); n > 0 && !strings.HasSuffix(rc.RoutePatterns[n-1], "/*") {
+		return rc.RoutePattern()
+	}
+
+	// rc.Routes is the root router, whose Find also matches the
+	// routes of the mounted routers.
+	path := r.URL.RawPath
+	if path == "" {
+		path = r.URL.Path
+	}
+	pattern := rc.Routes.Find(chi.NewRouteContext(), r.Method, path)
+	if pattern == "" {
+		return r.URL.Path
+	}
+
+	return pattern
+}
+
+// routeValue returns the value of routes whose key is the method and
+// route pattern of r (i.e "POST /users") or, when there's none, its
+// route pattern (i.e "/users").
+func routeValue[V any](routes map[string]V, r *http.Request) (V, bool) {
+	pattern := routePattern(r)
+	if v, ok := routes[r.Method+" "+pattern]; ok {
+		return v, true
+	}
+	v, ok := routes[pattern]
+
+	return v, ok
+}
+
+// rateLimitExemptions are the clients that are not rate limited.
+type rateLimitExemptions struct {
+	prefixes []netip.Prefix
+	keys     map[string]bool
+}
+
+// newRateLimitExemptions parses the exempted CIDRs (or single IPs),
+// it panics when any of them is invalid.
+func newRateLimitExemptions(cidrs, keys []string) rateLimitExemptions {
+	e := rateLimitExemptions{keys: map[string]bool{}}
+	for _, cidr := range cidrs {
+		prefix, err := parsePrefix(cidr)
+		if err != nil {
+			panic("invalid exempt cidr " + cidr)
+		}
+		e.prefixes = append(e.prefixes, prefix)
+	}
+	for _, key := range keys {
+		e.keys[key] = true
+	}
+
+	return e
+}
+
+// exempt returns true if the ip or the key of the request are exempted.
+func (e rateLimitExemptions) exempt(ip, key string) bool {
+	if e.keys[key] {
+		return true
+	}
+	if len(e.prefixes) == 0 {
+		return false
+	}
+
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	for _, prefix := range e.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
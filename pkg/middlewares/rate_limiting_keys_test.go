@@ -0,0 +1,322 @@
+package middlewares
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestRateLimitKeyFuncs(t *testing.T) {
+	type ctxKey struct{}
+	claims := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"user-1"}`))
+
+	type TestCase struct {
+		Name    string
+		KeyFunc RateLimitKeyFunc
+		Header  http.Header
+		Ctx     context.Context
+		Want    string
+	}
+
+	testCases := []TestCase{}
+	testCases = append(testCases, TestCase{
+		Name:    "ip",
+		KeyFunc: RateLimitKeyByIP,
+		Want:    "1.1.1.1",
+	})
+	testCases = append(testCases, TestCase{
+		Name:    "header",
+		KeyFunc: RateLimitKeyByHeader("X-Api-Key"),
+		Header:  http.Header{"X-Api-Key": {"key-1"}},
+		Want:    "x-api-key:key-1",
+	})
+	testCases = append(testCases, TestCase{
+		Name:    "missing header should be empty",
+		KeyFunc: RateLimitKeyByHeader("X-Api-Key"),
+		Want:    "",
+	})
+	testCases = append(testCases, TestCase{
+		Name:    "context value",
+		KeyFunc: RateLimitKeyByContextValue(ctxKey{}),
+		Ctx:     context.WithValue(context.Background(), ctxKey{}, "user-1"),
+		Want:    "user-1",
+	})
+	testCases = append(testCases, TestCase{
+		Name:    "jwt claim",
+		KeyFunc: RateLimitKeyByJWTClaim("sub"),
+		Header:  http.Header{"Authorization": {"Bearer e30." + claims + ".sig"}},
+		Want:    "sub:user-1",
+	})
+	testCases = append(testCases, TestCase{
+		Name:    "malformed jwt should be empty",
+		KeyFunc: RateLimitKeyByJWTClaim("sub"),
+		Header:  http.Header{"Authorization": {"Bearer not-a-jwt"}},
+		Want:    "",
+	})
+	testCases = append(testCases, TestCase{
+		Name:    "route without a router should use the path",
+		KeyFunc: RateLimitKeyByRoute(nil),
+		Want:    "GET /users/1:1.1.1.1",
+	})
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+			r.RemoteAddr = "1.1.1.1:1234"
+			if tc.Header != nil {
+				r.Header = tc.Header
+			}
+			if tc.Ctx != nil {
+				r = r.WithContext(tc.Ctx)
+			}
+
+			got, err := tc.KeyFunc(r)
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+			if got != tc.Want {
+				t.Errorf("got key %q, want %q", got, tc.Want)
+			}
+		})
+	}
+}
+
+func TestRouteRateLimitKey(t *testing.T) {
+	keys := []string{}
+	mdw := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, _ := RateLimitKeyByRoute(nil)(r)
+			keys = append(keys, key)
+			next.ServeHTTP(w, r)
+		})
+	}
+	h := func(w http.ResponseWriter, r *http.Request) {}
+
+	sub := chi.NewRouter()
+	sub.Use(mdw)
+	sub.Get("/users/{id}", h)
+	r := chi.NewRouter()
+	r.Use(mdw)
+	r.With(mdw).Get("/items/{id}", h)
+	r.Mount("/api", sub)
+
+	for _, path := range []string{"/items/1", "/api/users/1"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "1.1.1.1:1234"
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	want := []string{
+		"GET /items/{id}:1.1.1.1",
+		"GET /items/{id}:1.1.1.1",
+		"GET /api/users/{id}:1.1.1.1",
+		"GET /api/users/{id}:1.1.1.1",
+	}
+	if len(keys) != len(want) {
+		t.Fatalf("got keys %v, want %v", keys, want)
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Errorf("got key %q, want %q", keys[i], want[i])
+		}
+	}
+}
+
+func TestRateLimitPolicies(t *testing.T) {
+	type TestCase struct {
+		Name     string
+		Config   RateLimitConfig
+		With     *RateLimitConfig
+		Override []RateLimitPolicy
+		Method   string
+		Path     string
+		Header   http.Header
+		Want     []int
+	}
+
+	ok, limited := http.StatusOK, http.StatusTooManyRequests
+	testCases := []TestCase{}
+	testCases = append(testCases, TestCase{
+		Name: "stacked policies should deny when any of them is exceeded",
+		Config: RateLimitConfig{Policies: []RateLimitPolicy{
+			{Limit: 3, Metric: time.Minute},
+			{Limit: 2, Metric: time.Hour},
+		}},
+		Want: []int{ok, ok, limited},
+	})
+	testCases = append(testCases, TestCase{
+		Name: "route policies should override the policies",
+		Config: RateLimitConfig{
+			Limit:  1,
+			Metric: time.Minute,
+			RoutePolicies: map[string][]RateLimitPolicy{
+				"/users/{id}": {{Limit: 2, Metric: time.Minute}},
+			},
+		},
+		Want: []int{ok, ok, limited},
+	})
+	testCases = append(testCases, TestCase{
+		Name: "method route policies should take precedence",
+		Config: RateLimitConfig{
+			Limit:  3,
+			Metric: time.Minute,
+			RoutePolicies: map[string][]RateLimitPolicy{
+				"/users/{id}":      {{Limit: 2, Metric: time.Minute}},
+				"POST /users/{id}": {{Limit: 1, Metric: time.Minute}},
+			},
+		},
+		Method: http.MethodPost,
+		Want:   []int{ok, limited},
+	})
+	testCases = append(testCases, TestCase{
+		Name: "routes without policies should not be limited",
+		Config: RateLimitConfig{
+			Limit:         1,
+			Metric:        time.Minute,
+			RoutePolicies: map[string][]RateLimitPolicy{"/users/{id}": {}},
+		},
+		Want: []int{ok, ok, ok},
+	})
+	testCases = append(testCases, TestCase{
+		Name:   "with should add limits to the route",
+		Config: RateLimitConfig{Limit: 3, Metric: time.Minute},
+		With:   &RateLimitConfig{Limit: 1, Metric: time.Minute, KeyPrefix: "route:"},
+		Want:   []int{ok, limited},
+	})
+	testCases = append(testCases, TestCase{
+		Name:     "with should override the limits of the route",
+		Config:   RateLimitConfig{Limit: 1, Metric: time.Minute},
+		Override: []RateLimitPolicy{{Limit: 2, Metric: time.Minute}},
+		Want:     []int{ok, ok, limited},
+	})
+	testCases = append(testCases, TestCase{
+		Name: "with overrides should take precedence over route policies",
+		Config: RateLimitConfig{
+			Limit:  3,
+			Metric: time.Minute,
+			RoutePolicies: map[string][]RateLimitPolicy{
+				"/users/{id}": {{Limit: 3, Metric: time.Minute}},
+			},
+		},
+		Override: []RateLimitPolicy{{Limit: 1, Metric: time.Minute}},
+		Want:     []int{ok, limited},
+	})
+	testCases = append(testCases, TestCase{
+		Name:     "with overrides should not limit other routes",
+		Config:   RateLimitConfig{Limit: 2, Metric: time.Minute},
+		Override: []RateLimitPolicy{{Limit: 1, Metric: time.Minute}},
+		Method:   http.MethodPost,
+		Want:     []int{ok, ok, limited},
+	})
+	testCases = append(testCases, TestCase{
+		Name:     "with overrides without policies should not limit the route",
+		Config:   RateLimitConfig{Limit: 1, Metric: time.Minute},
+		Override: []RateLimitPolicy{},
+		Want:     []int{ok, ok, ok},
+	})
+	testCases = append(testCases, TestCase{
+		Name: "exempt cidrs should not be limited",
+		Config: RateLimitConfig{
+			Limit:       1,
+			Metric:      time.Minute,
+			ExemptCIDRs: []string{"1.1.0.0/16"},
+		},
+		Want: []int{ok, ok, ok},
+	})
+	testCases = append(testCases, TestCase{
+		Name: "exempt keys should not be limited",
+		Config: RateLimitConfig{
+			Limit:      1,
+			Metric:     time.Minute,
+			KeyFunc:    RateLimitKeyByHeader("X-Api-Key"),
+			ExemptKeys: []string{"x-api-key:internal"},
+		},
+		Header: http.Header{"X-Api-Key": {"internal"}},
+		Want:   []int{ok, ok, ok},
+	})
+	testCases = append(testCases, TestCase{
+		Name: "keys should limit requests independently from the ip",
+		Config: RateLimitConfig{
+			Limit:   1,
+			Metric:  time.Minute,
+			KeyFunc: RateLimitKeyByHeader("X-Api-Key"),
+		},
+		Header: http.Header{"X-Api-Key": {"key-1"}},
+		Want:   []int{ok, limited},
+	})
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			store := NewMemoryRateLimitStore(MemoryRateLimitStoreConfig{})
+			tc.Config.Store = store
+			h := func(w http.ResponseWriter, r *http.Request) {}
+
+			r := chi.NewRouter()
+			r.Use(NewRateLimitMdwWithJSONError(tc.Config))
+			switch {
+			case tc.With != nil:
+				tc.With.Store = store
+				r.With(NewRateLimitMdwWithJSONError(*tc.With)).Get("/users/{id}", h)
+			case tc.Override != nil:
+				// Overrides should also be found within mounted routers.
+				r.Route("/users", func(r chi.Router) {
+					r.With(NewRateLimitOverrideMdw(tc.Override...)).Get("/{id}", h)
+					r.Post("/{id}", h)
+				})
+			default:
+				r.Get("/users/{id}", h)
+				r.Post("/users/{id}", h)
+			}
+
+			method := tc.Method
+			if method == "" {
+				method = http.MethodGet
+			}
+			for i, want := range tc.Want {
+				req := httptest.NewRequest(method, "/users/1", nil)
+				req.RemoteAddr = "1.1.1.1:1234"
+				if tc.Header != nil {
+					req.Header = tc.Header
+				}
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+				if w.Code != want {
+					t.Errorf("request %d got status %d, want %d", i, w.Code, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimitExceededLog(t *testing.T) {
+	l := &recordingLogger{}
+	h := NewRateLimitMdwWithJSONError(RateLimitConfig{
+		Store:     NewMemoryRateLimitStore(MemoryRateLimitStoreConfig{}),
+		Policies:  []RateLimitPolicy{{Name: "per_minute", Limit: 1, Metric: time.Minute}},
+		KeyFunc:   RateLimitKeyByHeader("X-Api-Key"),
+		KeyPrefix: "api:",
+		Logger:    l,
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for range 2 {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "1.1.1.1:1234"
+		req.Header.Set("X-Api-Key", "key-1")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	logs := l.Logs()
+	if len(logs) != 1 || logs[0].Msg != "rate_limit_exceeded_error" {
+		t.Fatalf("got logs %+v, want a rate_limit_exceeded_error", logs)
+	}
+	want := map[string]any{"ip": "1.1.1.1", "key": "x-api-key:key-1", "policy": "per_minute"}
+	if !reflect.DeepEqual(logs[0].Data, want) {
+		t.Errorf("got data %v, want %v", logs[0].Data, want)
+	}
+}
@@ -0,0 +1,318 @@
+package middlewares
+
+import (
+	"container/list"
+	"hash/maphash"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DEFAULT_MEMORY_STORE_SHARDS is the default number of
+	// shards of the memory rate limit store.
+	DEFAULT_MEMORY_STORE_SHARDS = 32
+
+	// DEFAULT_MEMORY_STORE_TTL is the default time an idle IP
+	// is kept within the memory rate limit store.
+	DEFAULT_MEMORY_STORE_TTL = 10 * time.Minute
+
+	// memoryStoreMaxKeptPerUpsert is the number of idle IPs whose
+	// rate limit window hasn't ended yet that an upsert walks past
+	// before it stops evicting, so upserts don't walk every IP when
+	// the window is longer than the ttl.
+	memoryStoreMaxKeptPerUpsert = 16
+)
+
+// MemoryRateLimitStoreConfig is the configuration for the
+// memory rate limit store.
+type MemoryRateLimitStoreConfig struct {
+	// Shards is the number of shards the IPs are split into,
+	// every shard has its own lock so concurrent requests from
+	// different IPs rarely contend. Defaults to
+	// DEFAULT_MEMORY_STORE_SHARDS.
+	Shards int
+
+	// TTL is the time an IP is kept after its last request.
+	// IPs whose rate limit window hasn't ended yet are kept
+	// regardless of the TTL, so limited IPs are not reset by
+	// the eviction. Defaults to DEFAULT_MEMORY_STORE_TTL.
+	TTL time.Duration
+
+	// MaxEntries is the maximum number of IPs kept within the
+	// store, when it is reached the least recently used IPs are
+	// evicted (and their rate limit is reset). Zero means no limit.
+	MaxEntries int
+}
+
+// MemoryRateLimitStoreStats are the stats of a memory rate limit store.
+type MemoryRateLimitStoreStats struct {
+	// Entries is the number of IPs within the store.
+	Entries int `json:"entries"`
+
+	// Hits is the number of GetLimit and Take calls that found a rate limit.
+	Hits uint64 `json:"hits"`
+
+	// Misses is the number of GetLimit and Take calls that didn't find a rate limit.
+	Misses uint64 `json:"misses"`
+
+	// Expirations is the number of IPs evicted because they were idle.
+	Expirations uint64 `json:"expirations"`
+
+	// Evictions is the number of IPs evicted because the store was full.
+	Evictions uint64 `json:"evictions"`
+}
+
+// MemoryRateLimitStore is a concurrency-safe in-memory [RateLimitStore]
+// that implements [AlgorithmRateLimitStore]. Every shard keeps its IPs in
+// least recently used order, so idle IPs are evicted while upserting,
+// without any background goroutine.
+type MemoryRateLimitStore struct {
+	shards   []*memoryStoreShard
+	seed     maphash.Seed
+	ttl      time.Duration
+	maxShard int
+	now      func() time.Time
+
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+	expirations atomic.Uint64
+	evictions   atomic.Uint64
+}
+
+// memoryStoreShard is a single shard of the memory rate limit store.
+type memoryStoreShard struct {
+	mu sync.Mutex
+
+	// entries maps the IPs to their element within lru,
+	// whose front is the most recently used entry.
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+// memoryStoreEntry is a rate limit stored within a shard.
+type memoryStoreEntry struct {
+	limit    RateLimit
+	lastUsed time.Time
+}
+
+// NewMemoryRateLimitStore returns a new memory rate limit store.
+//
+// Example:
+//
+//	store := middlewares.NewMemoryRateLimitStore(middlewares.MemoryRateLimitStoreConfig{
+//		TTL:        time.Hour,
+//		MaxEntries: 100_000,
+//	})
+//
+//	r.Use(middlewares.NewRateLimitMdwWithJSONError(middlewares.RateLimitConfig{
+//		Store:  store,
+//		Metric: time.Minute,
+//		Limit:  60,
+//	}))
+func NewMemoryRateLimitStore(cfg MemoryRateLimitStoreConfig) *MemoryRateLimitStore {
+	if cfg.Shards <= 0 {
+		cfg.Shards = DEFAULT_MEMORY_STORE_SHARDS
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = DEFAULT_MEMORY_STORE_TTL
+	}
+
+	s := &MemoryRateLimitStore{
+		shards: make([]*memoryStoreShard, cfg.Shards),
+		seed:   maphash.MakeSeed(),
+		ttl:    cfg.TTL,
+		now:    time.Now,
+	}
+	if cfg.MaxEntries > 0 {
+		// Rounds up, so the store can hold at least MaxEntries
+		// IPs when they are evenly distributed.
+		s.maxShard = (cfg.MaxEntries + cfg.Shards - 1) / cfg.Shards
+	}
+	for i := range s.shards {
+		s.shards[i] = &memoryStoreShard{
+			entries: map[string]*list.Element{},
+			lru:     list.New(),
+		}
+	}
+
+	return s
+}
+
+// GetLimit returns a copy of the rate limit of ip or nil
+// if the store doesn't have it (or it has expired).
+func (s *MemoryRateLimitStore) GetLimit(ip string) (*RateLimit, error) {
+	shard := s.shard(ip)
+	now := s.now()
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	el, ok := shard.entries[ip]
+	if ok && s.expired(el.Value.(*memoryStoreEntry), now) {
+		shard.remove(el)
+		s.expirations.Add(1)
+		ok = false
+	}
+	if !ok {
+		s.misses.Add(1)
+		return nil, nil
+	}
+
+	s.hits.Add(1)
+	e := el.Value.(*memoryStoreEntry)
+	e.lastUsed = now
+	shard.lru.MoveToFront(el)
+	limit := e.limit
+
+	return &limit, nil
+}
+
+// UpsertLimit stores a copy of limit, keyed by limit.IP.
+func (s *MemoryRateLimitStore) UpsertLimit(limit RateLimit) error {
+	shard := s.shard(limit.IP)
+	now := s.now()
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	s.upsert(shard, limit, now)
+
+	return nil
+}
+
+// upsert stores limit within shard, evicting the expired entries
+// and, when full, the least recently used ones. The shard lock has
+// to be held by the caller.
+func (s *MemoryRateLimitStore) upsert(shard *memoryStoreShard, limit RateLimit, now time.Time) {
+	if el, ok := shard.entries[limit.IP]; ok {
+		e := el.Value.(*memoryStoreEntry)
+		e.limit = limit
+		e.lastUsed = now
+		shard.lru.MoveToFront(el)
+		s.expirations.Add(uint64(shard.evictExpired(s, now, memoryStoreMaxKeptPerUpsert)))
+		return
+	}
+
+	s.expirations.Add(uint64(shard.evictExpired(s, now, memoryStoreMaxKeptPerUpsert)))
+	for s.maxShard > 0 && shard.lru.Len() >= s.maxShard {
+		shard.remove(shard.lru.Back())
+		s.evictions.Add(1)
+	}
+
+	shard.entries[limit.IP] = shard.lru.PushFront(&memoryStoreEntry{
+		limit:    limit,
+		lastUsed: now,
+	})
+}
+
+// Take takes a request from the rate limit of key atomically,
+// see [AtomicRateLimitStore].
+func (s *MemoryRateLimitStore) Take(key string, limit int, window time.Duration) (RateLimit, bool, error) {
+	return s.TakeWithAlgorithm(key, limit, window, RATE_LIMIT_FIXED_WINDOW)
+}
+
+// TakeWithAlgorithm takes a request from the rate limit of key atomically
+// using algorithm, see [AlgorithmRateLimitStore].
+func (s *MemoryRateLimitStore) TakeWithAlgorithm(
+	key string,
+	limit int,
+	window time.Duration,
+	algorithm RateLimitAlgorithm,
+) (RateLimit, bool, error) {
+	shard := s.shard(key)
+	now := s.now()
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	var rl *RateLimit
+	if el, ok := shard.entries[key]; ok && !s.expired(el.Value.(*memoryStoreEntry), now) {
+		s.hits.Add(1)
+		rl = &el.Value.(*memoryStoreEntry).limit
+	} else {
+		s.misses.Add(1)
+	}
+
+	taken, allowed := takeRateLimit(rl, key, limit, window, algorithm, now)
+	s.upsert(shard, taken, now)
+
+	return taken, allowed, nil
+}
+
+// EvictExpired evicts the idle IPs of every shard. The store evicts
+// them while upserting, so calling it is only needed to release memory
+// of stores that stopped receiving requests.
+func (s *MemoryRateLimitStore) EvictExpired() {
+	now := s.now()
+	for _, shard := range s.shards {
+		shard.mu.Lock()
+		s.expirations.Add(uint64(shard.evictExpired(s, now, 0)))
+		shard.mu.Unlock()
+	}
+}
+
+// Stats returns the stats of the store.
+func (s *MemoryRateLimitStore) Stats() MemoryRateLimitStoreStats {
+	stats := MemoryRateLimitStoreStats{
+		Hits:        s.hits.Load(),
+		Misses:      s.misses.Load(),
+		Expirations: s.expirations.Load(),
+		Evictions:   s.evictions.Load(),
+	}
+	for _, shard := range s.shards {
+		shard.mu.Lock()
+		stats.Entries += shard.lru.Len()
+		shard.mu.Unlock()
+	}
+
+	return stats
+}
+
+// shard returns the shard of ip.
+func (s *MemoryRateLimitStore) shard(ip string) *memoryStoreShard {
+	return s.shards[maphash.String(s.seed, ip)%uint64(len(s.shards))]
+}
+
+// expired returns true if e has been idle for longer than the ttl
+// and its rate limit window has ended.
+func (s *MemoryRateLimitStore) expired(e *memoryStoreEntry, now time.Time) bool {
+	if now.Before(e.lastUsed.Add(s.ttl)) {
+		return false
+	}
+
+	return !now.Before(e.limit.expiresAt())
+}
+
+// evictExpired removes the expired entries of the shard and returns how
+// many were removed. Entries are walked from the least recently used
+// one, until reaching an entry that has not been idle for the ttl or
+// walking past maxKept idle entries whose window hasn't ended (zero
+// means no limit). The shard lock has to be held by the caller.
+func (shard *memoryStoreShard) evictExpired(s *MemoryRateLimitStore, now time.Time, maxKept int) int {
+	evicted, kept := 0, 0
+	for el := shard.lru.Back(); el != nil; {
+		e := el.Value.(*memoryStoreEntry)
+		if now.Before(e.lastUsed.Add(s.ttl)) {
+			break
+		}
+
+		prev := el.Prev()
+		if s.expired(e, now) {
+			shard.remove(el)
+			evicted++
+		} else if kept++; maxKept > 0 && kept >= maxKept {
+			break
+		}
+		el = prev
+	}
+
+	return evicted
+}
+
+// remove removes el from the shard. The shard lock has
+// to be held by the caller.
+func (shard *memoryStoreShard) remove(el *list.Element) {
+	shard.lru.Remove(el)
+	delete(shard.entries, el.Value.(*memoryStoreEntry).limit.IP)
+}
@@ -0,0 +1,212 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testClock is a manually advanced clock for the memory store.
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestMemoryStore(cfg MemoryRateLimitStoreConfig) (*MemoryRateLimitStore, *testClock) {
+	clock := &testClock{now: time.Unix(1_700_000_000, 0)}
+	s := NewMemoryRateLimitStore(cfg)
+	s.now = clock.Now
+	return s, clock
+}
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	s, _ := newTestMemoryStore(MemoryRateLimitStoreConfig{})
+
+	rl, err := s.GetLimit("1.1.1.1")
+	if err != nil || rl != nil {
+		t.Fatalf("got %v, %v, want nil, nil", rl, err)
+	}
+
+	s.UpsertLimit(RateLimit{IP: "1.1.1.1", Limit: 2, Remaining: 2})
+	rl, _ = s.GetLimit("1.1.1.1")
+	if rl == nil || rl.Remaining != 2 {
+		t.Fatalf("got %+v, want a rate limit with 2 remaining", rl)
+	}
+
+	// Returned limits are copies.
+	rl.Decrement()
+	rl, _ = s.GetLimit("1.1.1.1")
+	if rl.Remaining != 2 {
+		t.Errorf("got %d remaining, want 2", rl.Remaining)
+	}
+
+	want := MemoryRateLimitStoreStats{Entries: 1, Hits: 2, Misses: 1}
+	if got := s.Stats(); got != want {
+		t.Errorf("got stats %+v, want %+v", got, want)
+	}
+}
+
+func TestMemoryRateLimitStoreEviction(t *testing.T) {
+	type TestCase struct {
+		Name      string
+		Config    MemoryRateLimitStoreConfig
+		Run       func(s *MemoryRateLimitStore, clock *testClock)
+		WantIPs   []string
+		WantStats MemoryRateLimitStoreStats
+	}
+
+	testCases := []TestCase{}
+	testCases = append(testCases, TestCase{
+		Name:   "idle ips should expire",
+		Config: MemoryRateLimitStoreConfig{Shards: 1, TTL: time.Minute},
+		Run: func(s *MemoryRateLimitStore, clock *testClock) {
+			s.UpsertLimit(RateLimit{IP: "a", LastRequestedAt: clock.Now()})
+			clock.Advance(30 * time.Second)
+			s.UpsertLimit(RateLimit{IP: "b", LastRequestedAt: clock.Now()})
+			clock.Advance(40 * time.Second)
+			s.UpsertLimit(RateLimit{IP: "c", LastRequestedAt: clock.Now()})
+		},
+		WantIPs:   []string{"b", "c"},
+		WantStats: MemoryRateLimitStoreStats{Entries: 2, Expirations: 1},
+	})
+	testCases = append(testCases, TestCase{
+		Name:   "ips within their rate limit window should not expire",
+		Config: MemoryRateLimitStoreConfig{Shards: 1, TTL: time.Minute},
+		Run: func(s *MemoryRateLimitStore, clock *testClock) {
+			s.UpsertLimit(RateLimit{IP: "a", LastRequestedAt: clock.Now(), Metric: time.Hour})
+			clock.Advance(2 * time.Minute)
+			s.EvictExpired()
+		},
+		WantIPs:   []string{"a"},
+		WantStats: MemoryRateLimitStoreStats{Entries: 1},
+	})
+	testCases = append(testCases, TestCase{
+		Name:   "upserts should walk a bounded number of idle ips within their window",
+		Config: MemoryRateLimitStoreConfig{Shards: 1, TTL: time.Minute},
+		Run: func(s *MemoryRateLimitStore, clock *testClock) {
+			for i := range 1000 {
+				s.UpsertLimit(RateLimit{IP: fmt.Sprint(i), LastRequestedAt: clock.Now(), Metric: time.Hour})
+			}
+			s.UpsertLimit(RateLimit{IP: "a", LastRequestedAt: clock.Now()})
+			clock.Advance(2 * time.Minute)
+			// "a" can be evicted but it is behind 1000 ips
+			// whose window hasn't ended, so it's kept.
+			s.UpsertLimit(RateLimit{IP: "b", LastRequestedAt: clock.Now()})
+			clock.Advance(time.Hour)
+			s.UpsertLimit(RateLimit{IP: "c", LastRequestedAt: clock.Now()})
+		},
+		WantIPs:   []string{"c"},
+		WantStats: MemoryRateLimitStoreStats{Entries: 1, Expirations: 1002},
+	})
+	testCases = append(testCases, TestCase{
+		Name:   "evict expired should evict every shard",
+		Config: MemoryRateLimitStoreConfig{Shards: 4, TTL: time.Minute},
+		Run: func(s *MemoryRateLimitStore, clock *testClock) {
+			for i := range 10 {
+				s.UpsertLimit(RateLimit{IP: fmt.Sprint(i), LastRequestedAt: clock.Now()})
+			}
+			clock.Advance(time.Minute)
+			s.EvictExpired()
+		},
+		WantIPs:   []string{},
+		WantStats: MemoryRateLimitStoreStats{Expirations: 10},
+	})
+	testCases = append(testCases, TestCase{
+		Name:   "least recently used ips should be evicted when full",
+		Config: MemoryRateLimitStoreConfig{Shards: 1, MaxEntries: 2},
+		Run: func(s *MemoryRateLimitStore, clock *testClock) {
+			s.UpsertLimit(RateLimit{IP: "a"})
+			s.UpsertLimit(RateLimit{IP: "b"})
+			s.GetLimit("a")
+			s.UpsertLimit(RateLimit{IP: "c"})
+		},
+		WantIPs:   []string{"a", "c"},
+		WantStats: MemoryRateLimitStoreStats{Entries: 2, Hits: 1, Evictions: 1},
+	})
+
+	for _, tt := range testCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			s, clock := newTestMemoryStore(tt.Config)
+			tt.Run(s, clock)
+
+			if got := s.Stats(); got != tt.WantStats {
+				t.Errorf("got stats %+v, want %+v", got, tt.WantStats)
+			}
+			for _, ip := range tt.WantIPs {
+				if rl, _ := s.GetLimit(ip); rl == nil {
+					t.Errorf("ip %s not found", ip)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryRateLimitStoreConcurrency(t *testing.T) {
+	s := NewMemoryRateLimitStore(MemoryRateLimitStoreConfig{
+		Shards:     8,
+		TTL:        time.Millisecond,
+		MaxEntries: 64,
+	})
+
+	wg := sync.WaitGroup{}
+	for g := range 16 {
+		wg.Go(func() {
+			for i := range 1000 {
+				ip := fmt.Sprintf("10.0.%d.%d", g, i%100)
+				rl, _ := s.GetLimit(ip)
+				if rl == nil {
+					rl = &RateLimit{IP: ip, Limit: 10, Remaining: 10}
+				}
+				rl.Decrement()
+				s.UpsertLimit(*rl)
+				if i%100 == 0 {
+					s.Stats()
+					s.EvictExpired()
+				}
+			}
+		})
+	}
+	wg.Wait()
+
+	stats := s.Stats()
+	if stats.Entries > 64+8 {
+		t.Errorf("got %d entries, want at most %d", stats.Entries, 64+8)
+	}
+	if stats.Hits+stats.Misses != 16*1000 {
+		t.Errorf("got %d lookups, want %d", stats.Hits+stats.Misses, 16*1000)
+	}
+}
+
+func TestMemoryRateLimitStoreMiddleware(t *testing.T) {
+	mdw := NewRateLimitMdwWithJSONError(RateLimitConfig{
+		Store:  NewMemoryRateLimitStore(MemoryRateLimitStoreConfig{}),
+		Metric: time.Minute,
+		Limit:  2,
+	})
+	h := mdw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "1.1.1.1:1234"
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("request %d got status %d, want %d", i, w.Code, want)
+		}
+	}
+}
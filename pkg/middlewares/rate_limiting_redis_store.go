@@ -0,0 +1,402 @@
+package middlewares
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"hash/maphash"
+	"math/rand/v2"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/iolave/go-betsi/internal/resp"
+	"github.com/iolave/go-errors"
+)
+
+// Redis rate limit store errors
+const (
+	ERR_NAME_REDIS_STORE     = "redis_rate_limit_store_error"
+	ERR_REDIS_STORE_CONNECT  = "failed to connect to %s"
+	ERR_REDIS_STORE_COMMAND  = "failed to run %s command"
+	ERR_REDIS_STORE_DECODE   = "failed to decode rate limit of key %s"
+	ERR_REDIS_STORE_CONFLICT = "rate limit of key %s kept being modified concurrently"
+	ERR_REDIS_STORE_CLOSED   = "store is closed"
+)
+
+const (
+	// DEFAULT_REDIS_STORE_ADDR is the default address
+	// of the redis server.
+	DEFAULT_REDIS_STORE_ADDR = "localhost:6379"
+
+	// DEFAULT_REDIS_STORE_PREFIX is the default prefix
+	// of the rate limit keys.
+	DEFAULT_REDIS_STORE_PREFIX = "betsi:rate_limit:"
+
+	// DEFAULT_REDIS_STORE_TIMEOUT is the default dial
+	// and command timeout of the redis store.
+	DEFAULT_REDIS_STORE_TIMEOUT = time.Second
+
+	// DEFAULT_REDIS_STORE_POOL_SIZE is the default number
+	// of idle connections kept by the redis store.
+	DEFAULT_REDIS_STORE_POOL_SIZE = 10
+
+	// DEFAULT_REDIS_STORE_MAX_RETRIES is the default number of
+	// times a take is retried when its key is modified concurrently.
+	DEFAULT_REDIS_STORE_MAX_RETRIES = 20
+)
+
+// RedisRateLimitStoreConfig is the configuration for the
+// redis rate limit store.
+type RedisRateLimitStoreConfig struct {
+	// Addr is the address of the redis server. Defaults
+	// to DEFAULT_REDIS_STORE_ADDR.
+	Addr string
+
+	// Username and Password are sent with the AUTH command
+	// when Password is set.
+	Username string
+	Password string
+
+	// DB is the database selected on every connection.
+	DB int
+
+	// TLSConfig enables TLS connections when set.
+	TLSConfig *tls.Config
+
+	// KeyPrefix is prepended to every rate limit key. Defaults
+	// to DEFAULT_REDIS_STORE_PREFIX.
+	KeyPrefix string
+
+	// Timeout is the dial timeout and the timeout of every
+	// command. Defaults to DEFAULT_REDIS_STORE_TIMEOUT.
+	Timeout time.Duration
+
+	// PoolSize is the maximum number of idle connections.
+	// Defaults to DEFAULT_REDIS_STORE_POOL_SIZE.
+	PoolSize int
+
+	// MaxRetries is the maximum number of times a take is retried
+	// when its key is modified concurrently by another replica. Takes
+	// that run out of retries fail with ERR_REDIS_STORE_CONFLICT.
+	// Defaults to DEFAULT_REDIS_STORE_MAX_RETRIES.
+	MaxRetries int
+}
+
+// RedisRateLimitStore is a [RateLimitStore] and [AlgorithmRateLimitStore]
+// backed by a redis compatible server, so rate limits can be shared by
+// several replicas. Rate limits are stored as json strings that expire
+// once they are equivalent to a new rate limit.
+//
+// Takes are atomic optimistic transactions (WATCH, GET, MULTI, SET, EXEC)
+// that are retried when the key is modified by another client, so the
+// server doesn't need to support scripting.
+//
+// Takes of the same key are serialized within the process, so a hot key
+// only contends with the takes of the other replicas. Conflicting takes
+// are retried after a random delay (up to a millisecond per attempt)
+// that spreads the replicas apart, and fail once MaxRetries is reached.
+type RedisRateLimitStore struct {
+	cfg  RedisRateLimitStoreConfig
+	now  func() time.Time
+	pool chan *resp.Conn
+	seed maphash.Seed
+
+	// locks serialize the takes of the keys with the same
+	// hash (modulo the number of locks).
+	locks [256]sync.Mutex
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// NewRedisRateLimitStore returns a new redis rate limit store.
+// Connections are established lazily, so the server doesn't
+// need to be reachable when creating the store.
+//
+// Example:
+//
+//	store := middlewares.NewRedisRateLimitStore(middlewares.RedisRateLimitStoreConfig{
+//		Addr:     "redis:6379",
+//		Password: os.Getenv("REDIS_PASSWORD"),
+//	})
+//	defer store.Close()
+func NewRedisRateLimitStore(cfg RedisRateLimitStoreConfig) *RedisRateLimitStore {
+	if cfg.Addr == "" {
+		cfg.Addr = DEFAULT_REDIS_STORE_ADDR
+	}
+	if cfg.KeyPrefix == "" {
+		cfg.KeyPrefix = DEFAULT_REDIS_STORE_PREFIX
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DEFAULT_REDIS_STORE_TIMEOUT
+	}
+	if cfg.PoolSize <= 0 {
+		cfg.PoolSize = DEFAULT_REDIS_STORE_POOL_SIZE
+	}
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = DEFAULT_REDIS_STORE_MAX_RETRIES
+	}
+
+	return &RedisRateLimitStore{
+		cfg:  cfg,
+		now:  time.Now,
+		pool: make(chan *resp.Conn, cfg.PoolSize),
+		seed: maphash.MakeSeed(),
+	}
+}
+
+// GetLimit returns the rate limit of ip or nil if it doesn't exist.
+//
+// Any returned error is of type [github.com/iolave/go-errors.GenericError].
+func (s *RedisRateLimitStore) GetLimit(ip string) (rl *RateLimit, err error) {
+	c, err := s.conn()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { s.release(c, err) }()
+
+	return s.get(c, ip)
+}
+
+// UpsertLimit stores limit, keyed by limit.IP, until its window ends.
+//
+// Any returned error is of type [github.com/iolave/go-errors.GenericError].
+func (s *RedisRateLimitStore) UpsertLimit(limit RateLimit) (err error) {
+	c, err := s.conn()
+	if err != nil {
+		return err
+	}
+	defer func() { s.release(c, err) }()
+
+	return s.do(c, s.setArgs(limit)...)
+}
+
+// Take takes a request from the rate limit of key atomically,
+// see [AtomicRateLimitStore].
+//
+// Any returned error is of type [github.com/iolave/go-errors.GenericError].
+func (s *RedisRateLimitStore) Take(key string, limit int, window time.Duration) (RateLimit, bool, error) {
+	return s.TakeWithAlgorithm(key, limit, window, RATE_LIMIT_FIXED_WINDOW)
+}
+
+// TakeWithAlgorithm takes a request from the rate limit of key atomically
+// using algorithm, see [AlgorithmRateLimitStore].
+//
+// Any returned error is of type [github.com/iolave/go-errors.GenericError].
+func (s *RedisRateLimitStore) TakeWithAlgorithm(
+	key string,
+	limit int,
+	window time.Duration,
+	algorithm RateLimitAlgorithm,
+) (rl RateLimit, allowed bool, err error) {
+	mu := &s.locks[maphash.String(s.seed, key)%uint64(len(s.locks))]
+	mu.Lock()
+	defer mu.Unlock()
+
+	c, err := s.conn()
+	if err != nil {
+		return RateLimit{}, false, err
+	}
+	defer func() { s.release(c, err) }()
+
+	k := s.cfg.KeyPrefix + key
+	for attempt := range s.cfg.MaxRetries {
+		if attempt > 0 {
+			time.Sleep(rand.N(time.Duration(attempt) * time.Millisecond))
+		}
+		if err := s.do(c, "WATCH", k); err != nil {
+			return RateLimit{}, false, err
+		}
+
+		current, err := s.get(c, key)
+		if err != nil {
+			return RateLimit{}, false, err
+		}
+
+		taken, allowed := takeRateLimit(current, key, limit, window, algorithm, s.now())
+		if !allowed {
+			// Denied requests don't modify the rate limit.
+			return taken, false, s.do(c, "UNWATCH")
+		}
+
+		if err := s.do(c, "MULTI"); err != nil {
+			return RateLimit{}, false, err
+		}
+		if err := s.do(c, s.setArgs(taken)...); err != nil {
+			return RateLimit{}, false, err
+		}
+		res, err := c.Do("EXEC")
+		if err != nil {
+			return RateLimit{}, false, s.commandError("EXEC", err)
+		}
+		if res != nil {
+			return taken, true, nil
+		}
+		// The key was modified by another client after being
+		// watched, the transaction was aborted so it's retried.
+	}
+
+	return RateLimit{}, false, errors.NewWithName(
+		ERR_NAME_REDIS_STORE,
+		fmt.Sprintf(ERR_REDIS_STORE_CONFLICT, key),
+	)
+}
+
+// Close closes the idle connections of the store, connections
+// in use are closed once released.
+func (s *RedisRateLimitStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.pool)
+	for c := range s.pool {
+		c.Close()
+	}
+
+	return nil
+}
+
+// get returns the rate limit of key through c.
+func (s *RedisRateLimitStore) get(c *resp.Conn, key string) (*RateLimit, error) {
+	res, err := c.Do("GET", s.cfg.KeyPrefix+key)
+	if err != nil {
+		return nil, s.commandError("GET", err)
+	}
+	if res == nil {
+		return nil, nil
+	}
+
+	b, _ := res.(string)
+	rl := &RateLimit{}
+	if err := json.Unmarshal([]byte(b), rl); err != nil {
+		return nil, errors.NewWithNameAndErr(
+			ERR_NAME_REDIS_STORE,
+			fmt.Sprintf(ERR_REDIS_STORE_DECODE, key),
+			err,
+		)
+	}
+
+	return rl, nil
+}
+
+// setArgs returns the SET command args that store limit until
+// it expires (for at least a millisecond).
+func (s *RedisRateLimitStore) setArgs(limit RateLimit) []string {
+	b, _ := json.Marshal(limit)
+	ttl := max(limit.expiresAt().Sub(s.now()), time.Millisecond)
+
+	return []string{
+		"SET", s.cfg.KeyPrefix + limit.IP, string(b),
+		"PX", strconv.FormatInt(ttl.Milliseconds(), 10),
+	}
+}
+
+// do runs a command through c discarding its reply.
+func (s *RedisRateLimitStore) do(c *resp.Conn, args ...string) error {
+	if _, err := c.Do(args...); err != nil {
+		return s.commandError(args[0], err)
+	}
+
+	return nil
+}
+
+// commandError wraps the error of a command.
+func (s *RedisRateLimitStore) commandError(cmd string, err error) error {
+	return errors.NewWithNameAndErr(
+		ERR_NAME_REDIS_STORE,
+		fmt.Sprintf(ERR_REDIS_STORE_COMMAND, cmd),
+		err,
+	)
+}
+
+// conn returns an idle connection or dials a new one.
+func (s *RedisRateLimitStore) conn() (*resp.Conn, error) {
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+	if closed {
+		return nil, errors.NewWithName(ERR_NAME_REDIS_STORE, ERR_REDIS_STORE_CLOSED)
+	}
+
+	select {
+	case c, ok := <-s.pool:
+		if ok {
+			return c, nil
+		}
+		return nil, errors.NewWithName(ERR_NAME_REDIS_STORE, ERR_REDIS_STORE_CLOSED)
+	default:
+	}
+
+	c, err := s.dial()
+	if err != nil {
+		return nil, errors.NewWithNameAndErr(
+			ERR_NAME_REDIS_STORE,
+			fmt.Sprintf(ERR_REDIS_STORE_CONNECT, s.cfg.Addr),
+			err,
+		)
+	}
+
+	return c, nil
+}
+
+// dial dials a new connection, authenticating it and
+// selecting the configured database.
+func (s *RedisRateLimitStore) dial() (*resp.Conn, error) {
+	dialer := &net.Dialer{Timeout: s.cfg.Timeout}
+
+	var nc net.Conn
+	var err error
+	if s.cfg.TLSConfig != nil {
+		nc, err = tls.DialWithDialer(dialer, "tcp", s.cfg.Addr, s.cfg.TLSConfig)
+	} else {
+		nc, err = dialer.Dial("tcp", s.cfg.Addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := resp.NewConn(nc, s.cfg.Timeout)
+	if s.cfg.Password != "" {
+		args := []string{"AUTH", s.cfg.Password}
+		if s.cfg.Username != "" {
+			args = []string{"AUTH", s.cfg.Username, s.cfg.Password}
+		}
+		if _, err := c.Do(args...); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if s.cfg.DB != 0 {
+		if _, err := c.Do("SELECT", strconv.Itoa(s.cfg.DB)); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// release returns c to the pool, unless the command that used it
+// failed (its state is unknown), the pool is full or the store is
+// closed, in which case it is closed.
+func (s *RedisRateLimitStore) release(c *resp.Conn, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil || s.closed {
+		c.Close()
+		return
+	}
+
+	select {
+	case s.pool <- c:
+	default:
+		c.Close()
+	}
+}
@@ -0,0 +1,137 @@
+package middlewares
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/iolave/go-betsi/internal/resp/resptest"
+)
+
+func TestRedisRateLimitStore(t *testing.T) {
+	srv := resptest.NewServer()
+	srv.SetPassword("secret")
+	defer srv.Close()
+
+	s := NewRedisRateLimitStore(RedisRateLimitStoreConfig{Addr: srv.Addr, Password: "secret"})
+	defer s.Close()
+
+	for i, want := range []bool{true, true, false} {
+		rl, allowed, err := s.Take("1.1.1.1", 2, time.Minute)
+		if err != nil {
+			t.Fatalf("take %d got error %v", i, err)
+		}
+		if allowed != want {
+			t.Errorf("take %d got allowed %v, want %v", i, allowed, want)
+		}
+		if rl.Limit != 2 || rl.Remaining != max(1-i, 0) {
+			t.Errorf("take %d got %+v", i, rl)
+		}
+	}
+
+	if _, ok := srv.Get(DEFAULT_REDIS_STORE_PREFIX + "1.1.1.1"); !ok {
+		t.Errorf("rate limit not stored")
+	}
+
+	rl, err := s.GetLimit("1.1.1.1")
+	if err != nil || rl == nil || rl.Remaining != 0 {
+		t.Errorf("got %+v, %v", rl, err)
+	}
+
+	err = s.UpsertLimit(RateLimit{IP: "2.2.2.2", LastRequestedAt: time.Now(), Metric: time.Minute, Limit: 5, Remaining: 4})
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	rl, _ = s.GetLimit("2.2.2.2")
+	if rl == nil || rl.Remaining != 4 {
+		t.Errorf("got %+v", rl)
+	}
+
+	rl, _ = s.GetLimit("3.3.3.3")
+	if rl != nil {
+		t.Errorf("got %+v, want nil", rl)
+	}
+}
+
+func TestRedisRateLimitStoreErrors(t *testing.T) {
+	srv := resptest.NewServer()
+	srv.SetPassword("secret")
+	defer srv.Close()
+
+	s := NewRedisRateLimitStore(RedisRateLimitStoreConfig{Addr: srv.Addr, Password: "wrong"})
+	if _, _, err := s.Take("1.1.1.1", 1, time.Minute); err == nil {
+		t.Errorf("expected an authentication error")
+	}
+
+	s.Close()
+	if _, _, err := s.Take("1.1.1.1", 1, time.Minute); err == nil {
+		t.Errorf("expected a closed store error")
+	}
+}
+
+func TestRedisRateLimitStoreConcurrency(t *testing.T) {
+	srv := resptest.NewServer()
+	defer srv.Close()
+
+	// Stores share the server like replicas would.
+	stores := []*RedisRateLimitStore{
+		NewRedisRateLimitStore(RedisRateLimitStoreConfig{Addr: srv.Addr, MaxRetries: 1000}),
+		NewRedisRateLimitStore(RedisRateLimitStoreConfig{Addr: srv.Addr, MaxRetries: 1000}),
+	}
+
+	allowed := atomic.Int64{}
+	wg := sync.WaitGroup{}
+	for i := range 40 {
+		wg.Go(func() {
+			_, ok, err := stores[i%2].Take("1.1.1.1", 25, time.Minute)
+			if err != nil {
+				t.Errorf("got error %v", err)
+			}
+			if ok {
+				allowed.Add(1)
+			}
+		})
+	}
+	wg.Wait()
+
+	if allowed.Load() != 25 {
+		t.Errorf("got %d allowed requests, want 25", allowed.Load())
+	}
+	if srv.Calls("EXEC") < 25 {
+		t.Errorf("got %d transactions, want at least 25", srv.Calls("EXEC"))
+	}
+}
+
+func TestRedisRateLimitStoreHotKey(t *testing.T) {
+	srv := resptest.NewServer()
+	defer srv.Close()
+
+	// Concurrent takes of a hot key use the default retries.
+	s := NewRedisRateLimitStore(RedisRateLimitStoreConfig{Addr: srv.Addr})
+	defer s.Close()
+
+	allowed := atomic.Int64{}
+	wg := sync.WaitGroup{}
+	for range 300 {
+		wg.Go(func() {
+			_, ok, err := s.Take("1.1.1.1", 200, time.Minute)
+			if err != nil {
+				t.Errorf("got error %v", err)
+			}
+			if ok {
+				allowed.Add(1)
+			}
+		})
+	}
+	wg.Wait()
+
+	if allowed.Load() != 200 {
+		t.Errorf("got %d allowed requests, want 200", allowed.Load())
+	}
+	// Takes are serialized within the store, so
+	// no transaction is aborted and retried.
+	if srv.Calls("EXEC") != 200 {
+		t.Errorf("got %d transactions, want 200", srv.Calls("EXEC"))
+	}
+}
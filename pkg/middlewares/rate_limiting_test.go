@@ -0,0 +1,225 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/iolave/go-errors"
+)
+
+// mapRateLimitStore is a RateLimitStore that is only safe for
+// concurrent use, GetLimit and UpsertLimit are not atomic.
+type mapRateLimitStore struct {
+	mu     sync.Mutex
+	limits map[string]RateLimit
+}
+
+func (s *mapRateLimitStore) GetLimit(ip string) (*RateLimit, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rl, ok := s.limits[ip]
+	if !ok {
+		return nil, nil
+	}
+	// Widens the read-modify-write race window.
+	time.Sleep(time.Millisecond)
+	return &rl, nil
+}
+
+func (s *mapRateLimitStore) UpsertLimit(limit RateLimit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limits[limit.IP] = limit
+	return nil
+}
+
+func TestNewAtomicRateLimitStore(t *testing.T) {
+	memory := NewMemoryRateLimitStore(MemoryRateLimitStoreConfig{})
+	if NewAtomicRateLimitStore(memory) != AtomicRateLimitStore(memory) {
+		t.Errorf("atomic stores should not be wrapped")
+	}
+
+	s := NewAtomicRateLimitStore(&mapRateLimitStore{limits: map[string]RateLimit{}})
+
+	allowed := atomic.Int64{}
+	wg := sync.WaitGroup{}
+	for range 20 {
+		wg.Go(func() {
+			_, ok, err := s.Take("1.1.1.1", 10, time.Minute)
+			if err != nil {
+				t.Errorf("got error %v", err)
+			}
+			if ok {
+				allowed.Add(1)
+			}
+		})
+	}
+	wg.Wait()
+
+	if allowed.Load() != 10 {
+		t.Errorf("got %d allowed requests, want 10", allowed.Load())
+	}
+}
+
+func TestTakeRateLimit(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	type TestCase struct {
+		Name          string
+		RateLimit     *RateLimit
+		WantAllowed   bool
+		WantRemaining int
+		WantStart     time.Time
+	}
+
+	testCases := []TestCase{}
+	testCases = append(testCases, TestCase{
+		Name:          "missing rate limit should be created",
+		WantAllowed:   true,
+		WantRemaining: 1,
+		WantStart:     now,
+	})
+	testCases = append(testCases, TestCase{
+		Name:          "rate limit with remaining requests should allow",
+		RateLimit:     &RateLimit{LastRequestedAt: now.Add(-time.Second), Metric: time.Minute, Limit: 2, Remaining: 1},
+		WantAllowed:   true,
+		WantRemaining: 0,
+		WantStart:     now.Add(-time.Second),
+	})
+	testCases = append(testCases, TestCase{
+		Name:          "exhausted rate limit should deny",
+		RateLimit:     &RateLimit{LastRequestedAt: now.Add(-time.Second), Metric: time.Minute, Limit: 2, Remaining: 0},
+		WantAllowed:   false,
+		WantRemaining: 0,
+		WantStart:     now.Add(-time.Second),
+	})
+	testCases = append(testCases, TestCase{
+		Name:          "ended window should reset",
+		RateLimit:     &RateLimit{LastRequestedAt: now.Add(-time.Minute), Metric: time.Minute, Limit: 2, Remaining: 0},
+		WantAllowed:   true,
+		WantRemaining: 1,
+		WantStart:     now,
+	})
+
+	for _, tt := range testCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			rl, allowed := takeRateLimit(tt.RateLimit, "1.1.1.1", 2, time.Minute, RATE_LIMIT_FIXED_WINDOW, now)
+			if allowed != tt.WantAllowed {
+				t.Errorf("got allowed %v, want %v", allowed, tt.WantAllowed)
+			}
+			if rl.Remaining != tt.WantRemaining {
+				t.Errorf("got remaining %d, want %d", rl.Remaining, tt.WantRemaining)
+			}
+			if !rl.LastRequestedAt.Equal(tt.WantStart) {
+				t.Errorf("got window start %v, want %v", rl.LastRequestedAt, tt.WantStart)
+			}
+		})
+	}
+}
+
+func TestRateLimitHeaderSchemes(t *testing.T) {
+	type TestCase struct {
+		Name         string
+		Scheme       RateLimitHeaderScheme
+		ErrorHandler func(w http.ResponseWriter, r *http.Request, err *errors.HTTPError)
+		WantHeaders  map[string]string
+		WantMissing  []string
+		WantLimited  map[string]string
+	}
+
+	testCases := []TestCase{}
+	testCases = append(testCases, TestCase{
+		Name: "legacy should be the default",
+		WantHeaders: map[string]string{
+			"X-Rate-Limit-Limit":     "2",
+			"X-Rate-Limit-Remaining": "1",
+		},
+		WantMissing: []string{"RateLimit", "RateLimit-Policy"},
+		WantLimited: map[string]string{
+			"Retry-After":  "60",
+			"Content-Type": "application/json",
+		},
+	})
+	testCases = append(testCases, TestCase{
+		Name:   "ietf",
+		Scheme: RATE_LIMIT_HEADERS_IETF,
+		WantHeaders: map[string]string{
+			"RateLimit":        "limit=2, remaining=1, reset=60",
+			"RateLimit-Policy": "2;w=60, 5;w=3600",
+		},
+		WantMissing: []string{"X-Rate-Limit-Limit"},
+		WantLimited: map[string]string{
+			"RateLimit":   "limit=2, remaining=0, reset=60",
+			"Retry-After": "60",
+		},
+	})
+	testCases = append(testCases, TestCase{
+		Name:   "both",
+		Scheme: RATE_LIMIT_HEADERS_BOTH,
+		WantHeaders: map[string]string{
+			"X-Rate-Limit-Remaining": "1",
+			"RateLimit":              "limit=2, remaining=1, reset=60",
+		},
+	})
+	testCases = append(testCases, TestCase{
+		Name: "error handler should render the error",
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err *errors.HTTPError) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(err.StatusCode)
+		},
+		WantLimited: map[string]string{
+			"Retry-After":  "60",
+			"Content-Type": "text/plain",
+		},
+	})
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			h := NewRateLimitMdwWithJSONError(RateLimitConfig{
+				Store: NewMemoryRateLimitStore(MemoryRateLimitStoreConfig{}),
+				Policies: []RateLimitPolicy{
+					{Limit: 2, Metric: time.Minute},
+					{Limit: 5, Metric: time.Hour},
+				},
+				HeaderScheme: tc.Scheme,
+				ErrorHandler: tc.ErrorHandler,
+			})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			responses := []*httptest.ResponseRecorder{}
+			for range 3 {
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				req.RemoteAddr = "1.1.1.1:1234"
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, req)
+				responses = append(responses, w)
+			}
+
+			for k, want := range tc.WantHeaders {
+				if got := responses[0].Header().Get(k); got != want {
+					t.Errorf("got header %s %q, want %q", k, got, want)
+				}
+			}
+			for _, k := range tc.WantMissing {
+				if got := responses[0].Header().Get(k); got != "" {
+					t.Errorf("got header %s %q, want none", k, got)
+				}
+			}
+			if got := responses[0].Header().Get("Retry-After"); got != "" {
+				t.Errorf("got Retry-After %q on an allowed request", got)
+			}
+
+			limited := responses[2]
+			if limited.Code != http.StatusTooManyRequests {
+				t.Fatalf("got status %d, want %d", limited.Code, http.StatusTooManyRequests)
+			}
+			for k, want := range tc.WantLimited {
+				if got := limited.Header().Get(k); got != want {
+					t.Errorf("got limited header %s %q, want %q", k, got, want)
+				}
+			}
+		})
+	}
+}
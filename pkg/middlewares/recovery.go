@@ -0,0 +1,103 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/iolave/go-betsi/internal/utils"
+	"github.com/iolave/go-errors"
+	"github.com/iolave/go-logger"
+)
+
+// RecoveryMdwConfig holds the configuration for the recovery middleware.
+type RecoveryMdwConfig struct {
+	// Logger is the logger used to log recovered panics.
+	Logger logger.Logger
+}
+
+// NewRecoveryMdw creates a new panic recovery middleware.
+//
+// This middleware recovers from panics raised by the next handlers,
+// logs the panic value and stack trace as a "request_panicked" error
+// and, if nothing has been written to the client yet, sends a 500
+// response that follows the [github.com/iolave/go-errors.HTTPError]
+// structure. Panics with [http.ErrAbortHandler] are not recovered, so
+// the standard library can abort the response as expected.
+//
+// When used together with the request logging middleware, it should be
+// registered after it, that way the request is logged as failed with
+// the recovered panic as its error.
+//
+// Example:
+//
+//	r.Use(middlewares.NewRequestLoggingMdw(middlewares.RequestLoggingMdwConfig{
+//		Logger: l,
+//	}))
+//	r.Use(middlewares.NewRecoveryMdw(middlewares.RecoveryMdwConfig{
+//		Logger: l,
+//	}))
+func NewRecoveryMdw(cfg RecoveryMdwConfig) func(next http.Handler) http.Handler {
+	if cfg.Logger == nil {
+		panic("logger cannot be nil")
+	}
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			// Reuse the request logging response writer if there's
+			// one, so the logging middleware gets notified about
+			// the recovered panic.
+			rw, ok := utils.GetResponseWriter(w)
+			if !ok {
+				rw = &utils.ResponseWriter{
+					Original: w,
+				}
+				w = rw.Wrap()
+			}
+
+			defer func() {
+				rec := recover()
+				if rec == nil {
+					return
+				}
+				if rec == http.ErrAbortHandler {
+					panic(rec)
+				}
+
+				ctx := r.Context()
+				err := errors.NewInternalServerError(
+					"request panicked",
+					panicToError(rec),
+				).(*errors.HTTPError)
+
+				cfg.Logger.ErrorWithData(ctx, "request_panicked", err, map[string]any{
+					"path":   r.URL.Path,
+					"method": r.Method,
+					"stack":  string(debug.Stack()),
+				})
+
+				// The panic details are not sent to the client.
+				if !rw.Written() {
+					utils.WriteHTTPError(ctx, rw, errors.NewInternalServerError(
+						"Internal server error",
+						nil,
+					).(*errors.HTTPError))
+				}
+				rw.SentErr = err
+			}()
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// panicToError converts a recovered panic value into an error.
+func panicToError(rec any) error {
+	if err, ok := rec.(error); ok {
+		return errors.Wrap(err)
+	}
+
+	return errors.New(fmt.Sprintf("%v", rec))
+}
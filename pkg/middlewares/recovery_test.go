@@ -0,0 +1,162 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/iolave/go-errors"
+	"github.com/iolave/go-trace"
+)
+
+func TestRecoveryMdw(t *testing.T) {
+	type TestCase struct {
+		Name       string
+		Handler    http.HandlerFunc
+		WantStatus int
+		WantBody   string
+	}
+
+	testCases := []TestCase{}
+	testCases = append(testCases, TestCase{
+		Name: "panics before writing should send an internal server error",
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		},
+		WantStatus: http.StatusInternalServerError,
+	})
+	testCases = append(testCases, TestCase{
+		Name: "panics with an error should send an internal server error",
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			panic(errors.New("boom"))
+		},
+		WantStatus: http.StatusInternalServerError,
+	})
+	testCases = append(testCases, TestCase{
+		Name: "panics after writing the header should not send a second response",
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte("partial"))
+			panic("boom")
+		},
+		WantStatus: http.StatusAccepted,
+		WantBody:   "partial",
+	})
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			l := &recordingLogger{}
+			h := NewRecoveryMdw(RecoveryMdwConfig{Logger: l})(tc.Handler)
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users", nil))
+
+			if w.Code != tc.WantStatus {
+				t.Errorf("got status %d, want %d", w.Code, tc.WantStatus)
+			}
+			if tc.WantBody != "" && w.Body.String() != tc.WantBody {
+				t.Errorf("got body %q, want %q", w.Body.String(), tc.WantBody)
+			}
+
+			logs := l.Logs()
+			if len(logs) != 1 || logs[0].Level != "error" || logs[0].Msg != "request_panicked" {
+				t.Fatalf("got logs %+v, want a request_panicked error", logs)
+			}
+			if logs[0].Err == nil || !strings.Contains(logs[0].Err.Error(), "request panicked") {
+				t.Errorf("got error %v", logs[0].Err)
+			}
+			if stack, _ := logs[0].Data["stack"].(string); !strings.Contains(stack, "recovery_test.go") {
+				t.Errorf("got stack %q, want the handler frames", stack)
+			}
+			if logs[0].Data["path"] != "/users" || logs[0].Data["method"] != http.MethodGet {
+				t.Errorf("got data %+v", logs[0].Data)
+			}
+		})
+	}
+}
+
+func TestRecoveryMdwErrorResponse(t *testing.T) {
+	want := http.Header{}
+	r := chi.NewRouter()
+	r.Use(NewTraceMdw(nil))
+	r.Use(NewRecoveryMdw(RecoveryMdwConfig{Logger: &recordingLogger{}}))
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		t := trace.GetFromContext(r.Context())
+		t.Set("X-Test", "value")
+		t.SetHTTPHeaders(want)
+		panic("secret details")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("got content type %s", ct)
+	}
+	for k := range want {
+		if got := w.Header().Get(k); got != want.Get(k) {
+			t.Errorf("got %s header %q, want %q", k, got, want.Get(k))
+		}
+	}
+
+	got := errors.HTTPError{}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("got invalid json %q: %v", w.Body.String(), err)
+	}
+	if got.StatusCode != http.StatusInternalServerError || got.Message != "Internal server error" {
+		t.Errorf("got error %+v", got)
+	}
+	if strings.Contains(w.Body.String(), "secret details") {
+		t.Errorf("got panic details within the body %s", w.Body.String())
+	}
+}
+
+func TestRecoveryMdwAbortHandler(t *testing.T) {
+	l := &recordingLogger{}
+	h := NewRecoveryMdw(RecoveryMdwConfig{Logger: l})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	defer func() {
+		if rec := recover(); rec != http.ErrAbortHandler {
+			t.Errorf("got panic %v, want %v", rec, http.ErrAbortHandler)
+		}
+		if logs := l.Logs(); len(logs) != 0 {
+			t.Errorf("got logs %+v, want none", logs)
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+func TestRecoveryMdwRequestLogging(t *testing.T) {
+	l := &recordingLogger{}
+	r := chi.NewRouter()
+	r.Use(NewRequestLoggingMdw(RequestLoggingMdwConfig{Logger: l}))
+	r.Use(NewRecoveryMdw(RecoveryMdwConfig{Logger: l}))
+	r.Get("/users", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+
+	var failed *recordedLog
+	for _, log := range l.Logs() {
+		if log.Msg == "get_users_failed" {
+			failed = &log
+		}
+	}
+	if failed == nil {
+		t.Fatalf("got logs %+v, want a get_users_failed log", l.Logs())
+	}
+	if failed.Err == nil || !strings.Contains(failed.Err.Error(), "request panicked") {
+		t.Errorf("got error %v, want the recovered panic", failed.Err)
+	}
+}
@@ -0,0 +1,524 @@
+package middlewares
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/iolave/go-betsi/internal/utils"
+)
+
+// REDACTED is the value logged in place of redacted values.
+const REDACTED = "[REDACTED]"
+
+// DEFAULT_REDACTION_VISIBLE is the default number of trailing
+// characters left visible by the [REDACTION_PARTIAL] strategy.
+const DEFAULT_REDACTION_VISIBLE = 4
+
+// RedactionStrategy is how redacted values are masked.
+type RedactionStrategy string
+
+const (
+	// REDACTION_REPLACE replaces the values by [REDACTED].
+	REDACTION_REPLACE RedactionStrategy = "replace"
+
+	// REDACTION_REMOVE removes the values (and their keys).
+	REDACTION_REMOVE RedactionStrategy = "remove"
+
+	// REDACTION_HASH replaces the values by a hash of them
+	// (i.e "sha256:9f86d081884c7d65"), so equal values can be
+	// correlated without being logged. Set Redaction.HashKey to
+	// prevent low entropy values from being guessed.
+	REDACTION_HASH RedactionStrategy = "hash"
+
+	// REDACTION_PARTIAL masks all but the last characters of the
+	// values (i.e "************4242"), values that are not longer
+	// than the visible characters are fully masked.
+	REDACTION_PARTIAL RedactionStrategy = "partial"
+)
+
+// sensitiveHeaders are the headers that are always redacted.
+var sensitiveHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+}
+
+// Redaction holds the rules used to redact sensitive
+// data before it is logged.
+//
+// Request types can also redact their fields with the `log:"redact"`
+// struct tag, or `log:"redact=<strategy>"` to use another strategy. The
+// tag is honored within the JSON body type (at any depth), the path
+// params and the body field itself (which redacts the whole body).
+//
+// Example:
+//
+//	type CreateUserRequest struct {
+//		Body struct {
+//			Email    string `json:"email" log:"redact=hash"`
+//			Password string `json:"password" log:"redact"`
+//		} `ar:"body=json"`
+//	}
+type Redaction struct {
+	// Keys are the JSON body object keys and query param
+	// names whose values are redacted. Keys are matched
+	// case-insensitively at any depth of the body.
+	Keys []string
+
+	// KeyPatterns are glob patterns (i.e "*token*", see [path.Match])
+	// matched against the JSON body object keys, query param names
+	// and path param names, case-insensitively.
+	KeyPatterns []string
+
+	// Paths are JSON paths of the body whose values are redacted. Path
+	// segments are separated by dots, where "*" matches every key and
+	// array element (i.e "$.user.password", "items[*].card.number",
+	// "items.0.card" or "$" to redact the whole body).
+	Paths []string
+
+	// QueryParams are the query param names whose values are
+	// redacted, matched case-insensitively.
+	QueryParams []string
+
+	// Headers are the header names whose values are redacted, the
+	// Authorization, Proxy-Authorization, Cookie and Set-Cookie
+	// headers are always redacted.
+	Headers []string
+
+	// Strategy is how the values are masked. Defaults
+	// to [REDACTION_REPLACE].
+	Strategy RedactionStrategy
+
+	// HashKey is the key of the HMAC-SHA256 used by the
+	// [REDACTION_HASH] strategy, SHA256 is used when it's empty.
+	HashKey []byte
+
+	// Visible is the number of trailing characters left visible by the
+	// [REDACTION_PARTIAL] strategy. Defaults to DEFAULT_REDACTION_VISIBLE.
+	Visible int
+}
+
+// redactionPath is a parsed JSON path along with its strategy.
+type redactionPath struct {
+	segments []string
+	strategy RedactionStrategy
+}
+
+// validate panics when any of the key patterns is invalid.
+func (rd Redaction) validate() {
+	for _, p := range rd.KeyPatterns {
+		if _, err := path.Match(p, ""); err != nil {
+			panic(fmt.Sprintf("invalid redaction key pattern %q", p))
+		}
+	}
+}
+
+// isRedactedKey returns true if the key matches any of the
+// redaction keys or key patterns.
+func (rd Redaction) isRedactedKey(key string) bool {
+	for _, k := range rd.Keys {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	for _, p := range rd.KeyPatterns {
+		if ok, _ := path.Match(strings.ToLower(p), strings.ToLower(key)); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isRedactedHeader returns true if the header is redacted.
+func (rd Redaction) isRedactedHeader(header string) bool {
+	for _, h := range sensitiveHeaders {
+		if strings.EqualFold(h, header) {
+			return true
+		}
+	}
+	for _, h := range rd.Headers {
+		if strings.EqualFold(h, header) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// strategy returns the strategy of the rules, s when it's set.
+func (rd Redaction) strategy(s RedactionStrategy) RedactionStrategy {
+	if s != "" {
+		return s
+	}
+	if rd.Strategy != "" {
+		return rd.Strategy
+	}
+
+	return REDACTION_REPLACE
+}
+
+// mask returns v masked with strategy, or false when
+// the value has to be removed.
+func (rd Redaction) mask(v any, strategy RedactionStrategy) (any, bool) {
+	switch rd.strategy(strategy) {
+	case REDACTION_REMOVE:
+		return nil, false
+	case REDACTION_HASH:
+		s := fmt.Sprint(v)
+		var sum []byte
+		if len(rd.HashKey) > 0 {
+			mac := hmac.New(sha256.New, rd.HashKey)
+			mac.Write([]byte(s))
+			sum = mac.Sum(nil)
+		} else {
+			h := sha256.Sum256([]byte(s))
+			sum = h[:]
+		}
+		return "sha256:" + hex.EncodeToString(sum[:8]), true
+	case REDACTION_PARTIAL:
+		s := []rune(fmt.Sprint(v))
+		visible := rd.Visible
+		if visible <= 0 {
+			visible = DEFAULT_REDACTION_VISIBLE
+		}
+		if len(s) <= visible {
+			return strings.Repeat("*", len(s)), true
+		}
+		return strings.Repeat("*", len(s)-visible) + string(s[len(s)-visible:]), true
+	default:
+		return REDACTED, true
+	}
+}
+
+// redactJSON returns a copy of the decoded json value v with the
+// values of the redacted keys and paths masked, where typePaths are
+// the paths of the redacted fields of the body type.
+func (rd Redaction) redactJSON(v any, typePaths ...redactionPath) any {
+	v = rd.redactKeys(v)
+	for _, p := range rd.Paths {
+		v, _ = rd.redactPath(v, parseRedactionPath(p), "")
+	}
+	for _, p := range typePaths {
+		v, _ = rd.redactPath(v, p.segments, p.strategy)
+	}
+
+	return v
+}
+
+// logBody returns the JSON body buf to be logged with its values
+// redacted. Truncated bodies can't be decoded, so they are logged as
+// a string followed by [TRUNCATED] only if no redaction rules are set,
+// otherwise only [TRUNCATED] is logged. Invalid bodies are logged as nil.
+func (rd Redaction) logBody(buf []byte, truncated bool, typePaths ...redactionPath) any {
+	if truncated {
+		if !rd.isEmpty() || len(typePaths) > 0 {
+			return TRUNCATED
+		}
+		return string(buf) + TRUNCATED
+	}
+
+	var body any
+	if err := json.Unmarshal(buf, &body); err != nil {
+		return nil
+	}
+
+	return rd.redactJSON(body, typePaths...)
+}
+
+// isEmpty returns true if no body redaction rules are set.
+func (rd Redaction) isEmpty() bool {
+	return len(rd.Keys) == 0 && len(rd.KeyPatterns) == 0 && len(rd.Paths) == 0
+}
+
+// redactKeys returns a copy of the decoded json value v with the
+// values of the redacted keys masked.
+func (rd Redaction) redactKeys(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		redacted := make(map[string]any, len(v))
+		for k, vv := range v {
+			if rd.isRedactedKey(k) {
+				if masked, ok := rd.mask(vv, ""); ok {
+					redacted[k] = masked
+				}
+				continue
+			}
+			redacted[k] = rd.redactKeys(vv)
+		}
+		return redacted
+	case []any:
+		redacted := make([]any, len(v))
+		for i, vv := range v {
+			redacted[i] = rd.redactKeys(vv)
+		}
+		return redacted
+	default:
+		return v
+	}
+}
+
+// redactPath masks the values of v matched by the path segments, v
+// has to be a copy as it is modified. It returns the redacted value,
+// or false when it has to be removed.
+func (rd Redaction) redactPath(v any, segments []string, strategy RedactionStrategy) (any, bool) {
+	if len(segments) == 0 {
+		return rd.mask(v, strategy)
+	}
+
+	seg, rest := segments[0], segments[1:]
+	switch vv := v.(type) {
+	case map[string]any:
+		for k, e := range vv {
+			if seg != "*" && seg != k {
+				continue
+			}
+			if redacted, ok := rd.redactPath(e, rest, strategy); ok {
+				vv[k] = redacted
+			} else {
+				delete(vv, k)
+			}
+		}
+		return vv, true
+	case []any:
+		kept := make([]any, 0, len(vv))
+		for i, e := range vv {
+			if seg != "*" && seg != strconv.Itoa(i) {
+				kept = append(kept, e)
+				continue
+			}
+			if redacted, ok := rd.redactPath(e, rest, strategy); ok {
+				kept = append(kept, redacted)
+			}
+		}
+		return kept, true
+	default:
+		return v, true
+	}
+}
+
+// redactQuery returns the first value of each query param, where
+// the values of the redacted params are masked.
+func (rd Redaction) redactQuery(query url.Values) map[string]string {
+	queryParams := map[string]string{}
+	for k, v := range query {
+		if rd.isRedactedKey(k) || rd.isRedactedQueryParam(k) {
+			if masked, ok := rd.mask(v[0], ""); ok {
+				queryParams[k] = fmt.Sprint(masked)
+			}
+			continue
+		}
+		queryParams[k] = v[0]
+	}
+
+	return queryParams
+}
+
+// isRedactedQueryParam returns true if the query param is redacted.
+func (rd Redaction) isRedactedQueryParam(name string) bool {
+	for _, q := range rd.QueryParams {
+		if strings.EqualFold(q, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// redactPathParams returns the path params, where the values of
+// the redacted params (by key or by the request type) are masked.
+func (rd Redaction) redactPathParams(params map[string]string, typeParams map[string]RedactionStrategy) map[string]string {
+	redacted := make(map[string]string, len(params))
+	for k, v := range params {
+		strategy, tagged := typeParams[k]
+		if !tagged && !rd.isRedactedKey(k) {
+			redacted[k] = v
+			continue
+		}
+		if masked, ok := rd.mask(v, strategy); ok {
+			redacted[k] = fmt.Sprint(masked)
+		}
+	}
+
+	return redacted
+}
+
+// redactHeaders returns the headers, joining the values of every
+// header, where the values of the redacted headers are masked.
+func (rd Redaction) redactHeaders(header http.Header) map[string]string {
+	headers := map[string]string{}
+	for k, v := range header {
+		value := strings.Join(v, ", ")
+		if rd.isRedactedHeader(k) {
+			if masked, ok := rd.mask(value, ""); ok {
+				headers[k] = fmt.Sprint(masked)
+			}
+			continue
+		}
+		headers[k] = value
+	}
+
+	return headers
+}
+
+// parseRedactionPath parses a JSON path into its segments,
+// "items[*].number" and "$.items.*.number" are equivalent.
+func parseRedactionPath(p string) []string {
+	p = strings.TrimPrefix(p, "$")
+	p = strings.NewReplacer("[", ".", "]", "").Replace(p)
+
+	segments := []string{}
+	for seg := range strings.SplitSeq(p, ".") {
+		if seg != "" {
+			segments = append(segments, seg)
+		}
+	}
+
+	return segments
+}
+
+// typeRedaction are the redacted fields of a request type.
+type typeRedaction struct {
+	// body are the paths of the redacted fields of the body.
+	body []redactionPath
+
+	// pathParams are the redacted path params.
+	pathParams map[string]RedactionStrategy
+}
+
+// typeRedactions caches the type redactions of the routes, which
+// are keyed by "<method> <pattern>".
+type typeRedactions struct {
+	cache sync.Map
+}
+
+// get returns the type redaction of the route matching method and
+// pattern, whose handler has to implement [utils.InTyper].
+func (trs *typeRedactions) get(routes chi.Routes, method, pattern string) typeRedaction {
+	key := method + " " + pattern
+	if tr, ok := trs.cache.Load(key); ok {
+		return tr.(typeRedaction)
+	}
+
+	var t reflect.Type
+	chi.Walk(routes, func(
+		m, route string,
+		handler http.Handler,
+		_ ...func(http.Handler) http.Handler,
+	) error {
+		if m != method || route != pattern {
+			return nil
+		}
+		if h, ok := handler.(utils.InTyper); ok {
+			t = h.InType()
+		}
+		return nil
+	})
+
+	tr := newTypeRedaction(t)
+	trs.cache.Store(key, tr)
+	return tr
+}
+
+// newTypeRedaction returns the redacted fields of the request type t
+// (the `In` type of the route), which are tagged with `log:"redact"`.
+func newTypeRedaction(t reflect.Type) typeRedaction {
+	tr := typeRedaction{pathParams: map[string]RedactionStrategy{}}
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return tr
+	}
+
+	for i := range t.NumField() {
+		f := t.Field(i)
+		strategy, redacted := redactionTag(f)
+		for tag := range strings.SplitSeq(f.Tag.Get("ar"), ",") {
+			k, v, _ := strings.Cut(tag, "=")
+			switch {
+			case k == "path" && redacted:
+				tr.pathParams[v] = strategy
+			case k == "body" && redacted:
+				tr.body = append(tr.body, redactionPath{segments: []string{}, strategy: strategy})
+			case k == "body":
+				tr.body = appendTypePaths(tr.body, f.Type, nil, map[reflect.Type]bool{})
+			}
+		}
+	}
+
+	return tr
+}
+
+// appendTypePaths appends the paths of the redacted fields of the json
+// encoded type t, found under prefix, to paths.
+func appendTypePaths(paths []redactionPath, t reflect.Type, prefix []string, visiting map[reflect.Type]bool) []redactionPath {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return appendTypePaths(paths, t.Elem(), append(prefix, "*"), visiting)
+	case reflect.Struct:
+	default:
+		return paths
+	}
+
+	// Recursive types are only walked once.
+	if visiting[t] {
+		return paths
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" || (!f.IsExported() && !f.Anonymous) {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			// Embedded struct fields are promoted.
+			paths = appendTypePaths(paths, f.Type, prefix, visiting)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		segments := append(append([]string{}, prefix...), name)
+		if strategy, ok := redactionTag(f); ok {
+			paths = append(paths, redactionPath{segments: segments, strategy: strategy})
+			continue
+		}
+		paths = appendTypePaths(paths, f.Type, segments, visiting)
+	}
+
+	return paths
+}
+
+// redactionTag returns the strategy of the `log:"redact"` tag of f
+// and whether f has it, the strategy is empty when it isn't set.
+func redactionTag(f reflect.StructField) (RedactionStrategy, bool) {
+	for tag := range strings.SplitSeq(f.Tag.Get("log"), ",") {
+		k, v, _ := strings.Cut(tag, "=")
+		if k == "redact" {
+			return RedactionStrategy(v), true
+		}
+	}
+
+	return "", false
+}
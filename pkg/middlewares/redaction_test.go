@@ -0,0 +1,200 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestRedactJSON(t *testing.T) {
+	type TestCase struct {
+		Name      string
+		Redaction Redaction
+		TypePaths []redactionPath
+		Body      string
+		Want      string
+	}
+
+	testCases := []TestCase{}
+	testCases = append(testCases, TestCase{
+		Name:      "keys should be redacted at any depth",
+		Redaction: Redaction{Keys: []string{"PASSWORD"}},
+		Body:      `{"password":"secret","user":{"password":"secret","name":"betsi"}}`,
+		Want:      `{"password":"[REDACTED]","user":{"name":"betsi","password":"[REDACTED]"}}`,
+	})
+	testCases = append(testCases, TestCase{
+		Name:      "key patterns should be redacted",
+		Redaction: Redaction{KeyPatterns: []string{"*token*"}},
+		Body:      `{"accessToken":"a","token_type":"b","name":"betsi"}`,
+		Want:      `{"accessToken":"[REDACTED]","name":"betsi","token_type":"[REDACTED]"}`,
+	})
+	testCases = append(testCases, TestCase{
+		Name: "paths should be redacted",
+		Redaction: Redaction{
+			Paths:    []string{"$.user.password", "items[*].number"},
+			Strategy: REDACTION_REMOVE,
+		},
+		Body: `{"password":"kept","user":{"password":"secret"},"items":[{"number":"1"},{"number":"2","id":1}]}`,
+		Want: `{"items":[{},{"id":1}],"password":"kept","user":{}}`,
+	})
+	testCases = append(testCases, TestCase{
+		Name:      "root path should redact the whole body",
+		Redaction: Redaction{Paths: []string{"$"}},
+		Body:      `{"password":"secret"}`,
+		Want:      `"[REDACTED]"`,
+	})
+	testCases = append(testCases, TestCase{
+		Name:      "partial strategy should keep the last characters",
+		Redaction: Redaction{Paths: []string{"card.number", "card.cvv"}, Strategy: REDACTION_PARTIAL},
+		Body:      `{"card":{"number":"4242424242424242","cvv":"123"}}`,
+		Want:      `{"card":{"cvv":"***","number":"************4242"}}`,
+	})
+	testCases = append(testCases, TestCase{
+		Name:      "hash strategy should hash the values",
+		Redaction: Redaction{Keys: []string{"email"}, Strategy: REDACTION_HASH},
+		Body:      `{"email":"test"}`,
+		Want:      `{"email":"sha256:9f86d081884c7d65"}`,
+	})
+	testCases = append(testCases, TestCase{
+		Name: "type paths should use their strategy",
+		TypePaths: []redactionPath{
+			{segments: []string{"password"}},
+			{segments: []string{"items", "*", "email"}, strategy: REDACTION_REMOVE},
+		},
+		Body: `{"password":"secret","items":[{"email":"a","id":1}]}`,
+		Want: `{"items":[{"id":1}],"password":"[REDACTED]"}`,
+	})
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			var body any
+			if err := json.Unmarshal([]byte(tc.Body), &body); err != nil {
+				t.Fatal(err)
+			}
+			b, _ := json.Marshal(tc.Redaction.redactJSON(body, tc.TypePaths...))
+			if string(b) != tc.Want {
+				t.Errorf("got %s, want %s", b, tc.Want)
+			}
+		})
+	}
+}
+
+type redactedAddress struct {
+	Street string `json:"street" log:"redact=partial"`
+}
+
+type redactedUser struct {
+	redactedAddress
+	Email    string            `json:"email" log:"redact=hash"`
+	Password string            `json:"password" log:"redact"`
+	Cards    []*redactedCard   `json:"cards"`
+	Friends  map[string]string `json:"friends" log:"redact=remove"`
+	Parent   *redactedUser     `json:"parent"`
+	Name     string
+}
+
+type redactedCard struct {
+	Number string `json:"number" log:"redact"`
+}
+
+func TestNewTypeRedaction(t *testing.T) {
+	type request struct {
+		Token string       `ar:"path=token" log:"redact"`
+		ID    string       `ar:"path=id"`
+		Body  redactedUser `ar:"body=json"`
+	}
+
+	tr := newTypeRedaction(reflect.TypeFor[*request]())
+	wantParams := map[string]RedactionStrategy{"token": ""}
+	if !reflect.DeepEqual(tr.pathParams, wantParams) {
+		t.Errorf("got path params %v, want %v", tr.pathParams, wantParams)
+	}
+
+	got := []string{}
+	for _, p := range tr.body {
+		got = append(got, strings.Join(p.segments, ".")+"="+string(p.strategy))
+	}
+	want := []string{
+		"street=partial",
+		"email=hash",
+		"password=",
+		"cards.*.number=",
+		"friends=remove",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got body paths %v, want %v", got, want)
+	}
+}
+
+// typedHandler is an http.Handler that implements utils.InTyper.
+type typedHandler struct {
+	http.HandlerFunc
+	in reflect.Type
+}
+
+func (h typedHandler) InType() reflect.Type { return h.in }
+
+func TestRequestLoggingMdwRedaction(t *testing.T) {
+	type request struct {
+		ID   string `ar:"path=id" log:"redact=partial"`
+		Body struct {
+			Password string `json:"password" log:"redact"`
+		} `ar:"body=json"`
+	}
+
+	l := &recordingLogger{}
+	r := chi.NewRouter()
+	r.Use(NewRequestLoggingMdw(RequestLoggingMdwConfig{
+		Logger:         l,
+		LogPathParams:  true,
+		LogQueryParams: true,
+		LogJSONBody:    true,
+		LogHeaders:     true,
+		Redaction: Redaction{
+			QueryParams: []string{"apiKey"},
+			Headers:     []string{"X-Api-Key"},
+		},
+	}))
+	r.Route("/users", func(r chi.Router) {
+		r.Method(http.MethodPost, "/{id}", typedHandler{
+			HandlerFunc: func(w http.ResponseWriter, r *http.Request) {},
+			in:          reflect.TypeFor[request](),
+		})
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/users/123456?apiKey=secret&page=1", strings.NewReader(`{"password":"secret","name":"betsi"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("X-Api-Key", "secret")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	logs := l.Logs()
+	if len(logs) == 0 {
+		t.Fatalf("got no logs")
+	}
+	b, _ := json.Marshal(logs[0].Data)
+	if strings.Contains(string(b), "secret") {
+		t.Errorf("got unredacted data %s", b)
+	}
+	want := map[string]any{
+		"queryParams": map[string]string{"apiKey": REDACTED, "page": "1"},
+		"body":        map[string]any{"password": REDACTED, "name": "betsi"},
+	}
+	for k, v := range want {
+		if !reflect.DeepEqual(logs[0].Data[k], v) {
+			t.Errorf("got %s %v, want %v", k, logs[0].Data[k], v)
+		}
+	}
+	if got := logs[0].Data["pathParams"].(map[string]string)["id"]; got != "**3456" {
+		t.Errorf("got id path param %q, want %q", got, "**3456")
+	}
+	headers := logs[0].Data["headers"].(map[string]string)
+	if headers["Authorization"] != REDACTED || headers["X-Api-Key"] != REDACTED {
+		t.Errorf("got headers %v, want redacted headers", headers)
+	}
+}
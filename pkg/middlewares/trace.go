@@ -4,34 +4,144 @@ import (
 	"net/http"
 
 	"github.com/google/uuid"
+	"github.com/iolave/go-betsi/internal/utils"
 	"github.com/iolave/go-trace"
 )
 
-// newTraceMdw returns a chi middleware that checks
+// TRACE_REQUEST_ID_KEY is the trace key of the request id.
+const TRACE_REQUEST_ID_KEY = utils.REQUEST_ID_TRACE_KEY
+
+// DEFAULT_REQUEST_ID_HEADER is the default header the request
+// id is read from and echoed to.
+const DEFAULT_REQUEST_ID_HEADER = "X-Request-Id"
+
+// DEFAULT_REQUEST_ID_MAX_LENGTH is the default maximum
+// length of the incoming request ids.
+const DEFAULT_REQUEST_ID_MAX_LENGTH = 128
+
+// TraceMdwConfig holds the configuration for the trace middleware.
+type TraceMdwConfig struct {
+	// HeaderToKey maps request headers to the trace
+	// keys their values are stored in.
+	HeaderToKey map[string]string
+
+	// RequestIDHeaders are the headers the incoming request id is read
+	// from, the first one with a valid id is used. Defaults to
+	// DEFAULT_REQUEST_ID_HEADER.
+	RequestIDHeaders []string
+
+	// ResponseHeader is the header the request id is echoed to.
+	// Defaults to the first RequestIDHeaders.
+	ResponseHeader string
+
+	// MaxRequestIDLength is the maximum length of the incoming request
+	// ids, longer ids are replaced by a new one. Defaults to
+	// DEFAULT_REQUEST_ID_MAX_LENGTH.
+	MaxRequestIDLength int
+
+	// ValidateRequestID returns true if the incoming request id is
+	// valid, invalid ids are replaced by a new one. Defaults to
+	// accepting ids made of letters, digits and "-", "_", ".", ":",
+	// "/", "+" or "=".
+	ValidateRequestID func(id string) bool
+
+	// GenerateRequestID returns a new request id. Defaults
+	// to a random UUID.
+	GenerateRequestID func() string
+}
+
+// NewTraceMdw returns a chi middleware that checks
 // if the request has trace headers and adds them
 // to the context.
 //
 // If the request doesn't have trace headers, it
-// will populate the context with a new trace.
+// will populate the context with a new trace. See
+// [NewTraceMdwWithConfig] for the request id handling.
 func NewTraceMdw(mapHeaderToKey map[string]string) func(next http.Handler) http.Handler {
+	return NewTraceMdwWithConfig(TraceMdwConfig{HeaderToKey: mapHeaderToKey})
+}
+
+// NewTraceMdwWithConfig returns a chi middleware that populates the
+// context with the trace of the request, the headers of HeaderToKey
+// are stored within the trace.
+//
+// The request id is read from the RequestIDHeaders (or the trace), a
+// new one is generated when it's missing or invalid. It is stored in
+// the trace under TRACE_REQUEST_ID_KEY, so it's logged and propagated
+// to outgoing requests, and echoed in the ResponseHeader.
+//
+// Example:
+//
+//	r.Use(middlewares.NewTraceMdwWithConfig(middlewares.TraceMdwConfig{
+//		RequestIDHeaders: []string{"X-Request-Id", "X-Correlation-Id"},
+//	}))
+func NewTraceMdwWithConfig(cfg TraceMdwConfig) func(next http.Handler) http.Handler {
+	if len(cfg.RequestIDHeaders) == 0 {
+		cfg.RequestIDHeaders = []string{DEFAULT_REQUEST_ID_HEADER}
+	}
+	if cfg.ResponseHeader == "" {
+		cfg.ResponseHeader = cfg.RequestIDHeaders[0]
+	}
+	if cfg.MaxRequestIDLength <= 0 {
+		cfg.MaxRequestIDLength = DEFAULT_REQUEST_ID_MAX_LENGTH
+	}
+	if cfg.ValidateRequestID == nil {
+		cfg.ValidateRequestID = isValidRequestID
+	}
+	if cfg.GenerateRequestID == nil {
+		cfg.GenerateRequestID = uuid.NewString
+	}
+
+	valid := func(id string) bool {
+		return id != "" && len(id) <= cfg.MaxRequestIDLength && cfg.ValidateRequestID(id)
+	}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			ctx := r.Context()
 			t, _ := trace.GetFromHTTPRequest(r)
 
-			for h, k := range mapHeaderToKey {
-				v := r.Header.Get(h)
-				t.Set(k, v)
+			for h, k := range cfg.HeaderToKey {
+				if v := r.Header.Get(h); v != "" {
+					t.Set(k, v)
+				}
 			}
 
-			reqId := t.Get("request_id")
+			reqId := ""
+			for _, h := range cfg.RequestIDHeaders {
+				if id := r.Header.Get(h); valid(id) {
+					reqId = id
+					break
+				}
+			}
+			if reqId == "" && valid(t.Get(TRACE_REQUEST_ID_KEY)) {
+				reqId = t.Get(TRACE_REQUEST_ID_KEY)
+			}
 			if reqId == "" {
-				reqId = uuid.New().String()
+				reqId = cfg.GenerateRequestID()
 			}
+			t.Set(TRACE_REQUEST_ID_KEY, reqId)
 
 			t.SetHTTPHeaders(w.Header())
+			w.Header().Set(cfg.ResponseHeader, reqId)
 			ctx = t.SetInContext(ctx)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
+
+// isValidRequestID returns true if id is only made of letters,
+// digits and "-", "_", ".", ":", "/", "+" or "=", so it can't be
+// used to inject data within headers or logs.
+func isValidRequestID(id string) bool {
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':', c == '/', c == '+', c == '=':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,96 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/iolave/go-betsi/internal/utils"
+)
+
+func TestTraceMdwRequestID(t *testing.T) {
+	type TestCase struct {
+		Name    string
+		Config  TraceMdwConfig
+		Headers map[string]string
+		// WantID is the expected request id, "new" when a
+		// new one has to be generated.
+		WantID         string
+		ResponseHeader string
+	}
+
+	testCases := []TestCase{}
+	testCases = append(testCases, TestCase{
+		Name:           "incoming request ids should be kept",
+		Headers:        map[string]string{"X-Request-Id": "abc-123"},
+		WantID:         "abc-123",
+		ResponseHeader: DEFAULT_REQUEST_ID_HEADER,
+	})
+	testCases = append(testCases, TestCase{
+		Name:           "missing request ids should be generated",
+		WantID:         "new",
+		ResponseHeader: DEFAULT_REQUEST_ID_HEADER,
+	})
+	testCases = append(testCases, TestCase{
+		Name:           "invalid request ids should be replaced",
+		Headers:        map[string]string{"X-Request-Id": "abc\r\ninjected: true"},
+		WantID:         "new",
+		ResponseHeader: DEFAULT_REQUEST_ID_HEADER,
+	})
+	testCases = append(testCases, TestCase{
+		Name:           "long request ids should be replaced",
+		Config:         TraceMdwConfig{MaxRequestIDLength: 4},
+		Headers:        map[string]string{"X-Request-Id": "abcde"},
+		WantID:         "new",
+		ResponseHeader: DEFAULT_REQUEST_ID_HEADER,
+	})
+	testCases = append(testCases, TestCase{
+		Name: "configured headers should be used",
+		Config: TraceMdwConfig{
+			RequestIDHeaders: []string{"X-Correlation-Id", "X-Amzn-Trace-Id"},
+			ResponseHeader:   "X-Trace",
+		},
+		Headers: map[string]string{
+			"X-Correlation-Id": "invalid id",
+			"X-Amzn-Trace-Id":  "Root=1-abc",
+		},
+		WantID:         "Root=1-abc",
+		ResponseHeader: "X-Trace",
+	})
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			tc.Config.GenerateRequestID = func() string { return "new" }
+
+			got := ""
+			h := NewTraceMdwWithConfig(tc.Config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = utils.GetRequestIDFromContext(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for k, v := range tc.Headers {
+				req.Header[http.CanonicalHeaderKey(k)] = []string{v}
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if got != tc.WantID {
+				t.Errorf("got request id %q, want %q", got, tc.WantID)
+			}
+			if echoed := w.Header().Get(tc.ResponseHeader); echoed != tc.WantID {
+				t.Errorf("got %s %q, want %q", tc.ResponseHeader, echoed, tc.WantID)
+			}
+		})
+	}
+}
+
+func TestTraceMdwGeneratedRequestID(t *testing.T) {
+	h := NewTraceMdw(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if id := w.Header().Get(DEFAULT_REQUEST_ID_HEADER); len(id) != 36 || strings.Count(id, "-") != 4 {
+		t.Errorf("got request id %q, want a uuid", id)
+	}
+}
@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"reflect"
+	"regexp"
 	"strings"
 
 	"github.com/iolave/go-errors"
@@ -14,11 +16,17 @@ import (
 
 // encodeAppRequest takes a request url with path params as ".../{paramName}/..." and a struct v with/wo "ar" tags.
 //
-//   - It detects and replaces url path params from "ar" tags ("path=*")
+//   - It detects and replaces url path params from "ar" tags ("path=*"), values are escaped using [url.PathEscape].
+//     Chi regexp path params (i.e "{id:[0-9]+}") are supported and values have to match their regexp.
 //   - It detects the body type from "ar" tags ("body=json") and use it's value to encode the request body.
 //
+// It errors if a path param of the url is not filled or if a "path" tag references a
+// param that is not part of the url.
+//
 // If some error occurs, an error of type [github.com/iolave/go-errors.GenericError] will be returned.
-func encodeAppRequest(url string, v any) (newUrl string, r io.Reader, err error) {
+func encodeAppRequest(rawURL string, v any) (newUrl string, r io.Reader, err error) {
+	pathValues := map[string]string{}
+
 	for i := range reflect.ValueOf(v).Elem().NumField() {
 		f := reflect.ValueOf(v).Elem().Field(i)
 		t := reflect.TypeOf(v).Elem().Field(i)
@@ -42,7 +50,31 @@ func encodeAppRequest(url string, v any) (newUrl string, r io.Reader, err error)
 					)
 				}
 				v := splittedTag[1]
-				newUrl = strings.ReplaceAll(url, fmt.Sprintf("{%s}", v), f.String())
+				found := false
+				for _, p := range parsePatternParams(rawURL) {
+					if p.Name != v {
+						continue
+					}
+					found = true
+					if p.Regexp == "" {
+						continue
+					}
+					// Chi regexps are anchored to the whole path segment.
+					rexp, err := regexp.Compile("^(?:" + p.Regexp + ")$")
+					if err == nil && !rexp.MatchString(f.String()) {
+						return "", nil, errors.NewWithName(
+							ERR_NAME_ENCODER,
+							fmt.Sprintf(ERR_ENC_PATH_MISMATCH, v, p.Regexp, t.Name),
+						)
+					}
+				}
+				if !found {
+					return "", nil, errors.NewWithName(
+						ERR_NAME_ENCODER,
+						fmt.Sprintf(ERR_ENC_PATH_NOT_FOUND, v, t.Name),
+					)
+				}
+				pathValues[v] = f.String()
 			case "body":
 				if len(splittedTag) != 2 {
 					return "", nil, errors.NewWithName(
@@ -79,6 +111,18 @@ func encodeAppRequest(url string, v any) (newUrl string, r io.Reader, err error)
 
 	}
 
+	newUrl = rawURL
+	for _, p := range parsePatternParams(rawURL) {
+		v, ok := pathValues[p.Name]
+		if !ok {
+			return "", nil, errors.NewWithName(
+				ERR_NAME_ENCODER,
+				fmt.Sprintf(ERR_ENC_PATH_UNFILLED, p.Name),
+			)
+		}
+		newUrl = strings.Replace(newUrl, p.Placeholder, url.PathEscape(v), 1)
+	}
+
 	return newUrl, r, nil
 }
 
@@ -0,0 +1,109 @@
+package betsi
+
+import (
+	"io"
+	"testing"
+)
+
+func TestEncodeAppRequest(t *testing.T) {
+	type TestCase struct {
+		Name     string
+		URL      string
+		In       any
+		WantURL  string
+		WantBody string
+		WantErr  bool
+	}
+
+	testCases := []TestCase{}
+	testCases = append(testCases, TestCase{
+		Name:    "url without path params should be kept",
+		URL:     "http://localhost/users",
+		In:      &struct{}{},
+		WantURL: "http://localhost/users",
+	})
+	testCases = append(testCases, TestCase{
+		Name: "every path param should be replaced",
+		URL:  "http://localhost/users/{id}/posts/{postId}",
+		In: &struct {
+			ID     string `ar:"path=id"`
+			PostID string `ar:"path=postId"`
+		}{"1", "2"},
+		WantURL: "http://localhost/users/1/posts/2",
+	})
+	testCases = append(testCases, TestCase{
+		Name: "path params should be escaped",
+		URL:  "/users/{id}",
+		In: &struct {
+			ID string `ar:"path=id"`
+		}{"a/b c"},
+		WantURL: "/users/a%2Fb%20c",
+	})
+	testCases = append(testCases, TestCase{
+		Name: "regexp path params should be replaced",
+		URL:  "/users/{id:[0-9]+}/{code:[a-z]{3}}",
+		In: &struct {
+			ID   string `ar:"path=id"`
+			Code string `ar:"path=code"`
+		}{"12", "abc"},
+		WantURL: "/users/12/abc",
+	})
+	testCases = append(testCases, TestCase{
+		Name: "regexp path params should match",
+		URL:  "/users/{id:[0-9]+}",
+		In: &struct {
+			ID string `ar:"path=id"`
+		}{"abc"},
+		WantErr: true,
+	})
+	testCases = append(testCases, TestCase{
+		Name: "unfilled path params should fail",
+		URL:  "/users/{id}/posts/{postId}",
+		In: &struct {
+			ID string `ar:"path=id"`
+		}{"1"},
+		WantErr: true,
+	})
+	testCases = append(testCases, TestCase{
+		Name: "path tags without placeholder should fail",
+		URL:  "/users",
+		In: &struct {
+			ID string `ar:"path=id"`
+		}{"1"},
+		WantErr: true,
+	})
+	testCases = append(testCases, TestCase{
+		Name: "body should be encoded",
+		URL:  "/users/{id}",
+		In: &struct {
+			ID   string `ar:"path=id"`
+			Body struct {
+				Name string `json:"name"`
+			} `ar:"body=json"`
+		}{ID: "1", Body: struct {
+			Name string `json:"name"`
+		}{"betsi"}},
+		WantURL:  "/users/1",
+		WantBody: `{"name":"betsi"}`,
+	})
+
+	for _, tt := range testCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			url, r, err := encodeAppRequest(tt.URL, tt.In)
+			if (err != nil) != tt.WantErr {
+				t.Fatalf("got error %v, wantErr: %v", err, tt.WantErr)
+			}
+			if url != tt.WantURL {
+				t.Errorf("got url %s, want %s", url, tt.WantURL)
+			}
+			body := ""
+			if r != nil {
+				b, _ := io.ReadAll(r)
+				body = string(b)
+			}
+			if body != tt.WantBody {
+				t.Errorf("got body %s, want %s", body, tt.WantBody)
+			}
+		})
+	}
+}
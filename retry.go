@@ -0,0 +1,254 @@
+package betsi
+
+import (
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Retry policy defaults.
+const (
+	DEFAULT_RETRY_MAX_ATTEMPTS    = 3
+	DEFAULT_RETRY_INITIAL_BACKOFF = 100 * time.Millisecond
+	DEFAULT_RETRY_MAX_BACKOFF     = 5 * time.Second
+	DEFAULT_RETRY_MULTIPLIER      = 2
+	DEFAULT_RETRY_MAX_WAIT        = 30 * time.Second
+	DEFAULT_RETRY_BUDGET_TOKENS   = 10
+	DEFAULT_RETRY_BUDGET_RATIO    = 0.1
+)
+
+// DefaultRetryStatusCodes are the response status codes retried
+// when [RetryConfig.StatusCodes] is empty.
+var DefaultRetryStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// RetryConfig is the retry policy of the betsi client.
+//
+// Requests are retried when they fail to be sent or when the response
+// status is one of StatusCodes, as long as the method is idempotent
+// (GET, HEAD, OPTIONS, TRACE, PUT and DELETE) or RetryNonIdempotent is
+// set. Attempts are delayed with an exponential backoff with jitter,
+// unless the server asks for a longer delay through the "Retry-After"
+// header of 429 and 503 responses, or the "X-Rate-Limit-Reset" header
+// of 429 responses (when "X-Rate-Limit-Remaining" is missing or 0).
+type RetryConfig struct {
+	// MaxAttempts is the maximum number of attempts, the
+	// first one included. Defaults to 3.
+	MaxAttempts int
+
+	// InitialBackoff is the delay before the first retry.
+	// Defaults to 100ms.
+	InitialBackoff time.Duration
+
+	// MaxBackoff is the maximum delay between attempts.
+	// Defaults to 5s.
+	MaxBackoff time.Duration
+
+	// Multiplier is the factor the backoff is multiplied
+	// by after every attempt. Defaults to 2.
+	Multiplier float64
+
+	// Jitter is the fraction, between 0 and 1, of the backoff
+	// that is randomized (i.e a 0.2 jitter makes a 100ms backoff
+	// last between 80ms and 100ms). Defaults to 0 (no jitter).
+	Jitter float64
+
+	// MaxWait is the maximum delay requested by the server
+	// through the "Retry-After" or "X-Rate-Limit-Reset"
+	// headers (see [RetryConfig]). The request is not retried when the server
+	// asks for a longer delay. Defaults to 30s.
+	MaxWait time.Duration
+
+	// StatusCodes are the response status codes that are
+	// retried. Defaults to [DefaultRetryStatusCodes].
+	StatusCodes []int
+
+	// RetryNonIdempotent determines whether to retry the
+	// non idempotent methods (POST, PATCH, ...).
+	RetryNonIdempotent bool
+
+	// Budget limits the retries of a client to avoid retry
+	// storms. If nil, the default budget is used.
+	Budget *RetryBudgetConfig
+}
+
+// RetryBudgetConfig is the configuration of a retry budget.
+//
+// The budget holds MaxTokens tokens, every failed attempt takes a token
+// and every successful call gives back TokenRatio tokens. Retries are
+// only allowed while the budget holds more than half of its tokens, so
+// retries stop when most calls to the server fail.
+type RetryBudgetConfig struct {
+	// MaxTokens is the budget size. Defaults to 10.
+	MaxTokens float64
+
+	// TokenRatio is the number of tokens given back by
+	// every successful call. Defaults to 0.1.
+	TokenRatio float64
+}
+
+// isRetryable returns true if an attempt that got the `statusCode`
+// response or the `err` error can be retried.
+func (cfg RetryConfig) isRetryable(method string, statusCode int, err error) bool {
+	if !cfg.RetryNonIdempotent && !isIdempotent(method) {
+		return false
+	}
+
+	if err != nil {
+		return true
+	}
+
+	codes := cfg.StatusCodes
+	if len(codes) == 0 {
+		codes = DefaultRetryStatusCodes
+	}
+
+	return slices.Contains(codes, statusCode)
+}
+
+// wait returns the delay before the attempt that follows `attempt`,
+// whose response had the statusCode and header. It returns false if
+// there are no attempts left or the server asked for a delay longer
+// than MaxWait.
+func (cfg RetryConfig) wait(attempt int, statusCode int, header http.Header) (time.Duration, bool) {
+	maxAttempts := cfg.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = DEFAULT_RETRY_MAX_ATTEMPTS
+	}
+	if attempt >= maxAttempts {
+		return 0, false
+	}
+
+	initial := cfg.InitialBackoff
+	if initial <= 0 {
+		initial = DEFAULT_RETRY_INITIAL_BACKOFF
+	}
+	maxBackoff := cfg.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = DEFAULT_RETRY_MAX_BACKOFF
+	}
+	multiplier := cfg.Multiplier
+	if multiplier < 1 {
+		multiplier = DEFAULT_RETRY_MULTIPLIER
+	}
+	maxWait := cfg.MaxWait
+	if maxWait <= 0 {
+		maxWait = DEFAULT_RETRY_MAX_WAIT
+	}
+
+	backoff := float64(initial) * math.Pow(multiplier, float64(attempt-1))
+	backoff = math.Min(backoff, float64(maxBackoff))
+	if jitter := math.Min(math.Max(cfg.Jitter, 0), 1); jitter > 0 {
+		backoff -= backoff * jitter * rand.Float64()
+	}
+	wait := time.Duration(backoff)
+
+	if serverWait, ok := serverRetryDelay(statusCode, header, time.Now()); ok {
+		if serverWait > maxWait {
+			return 0, false
+		}
+		wait = max(wait, serverWait)
+	}
+
+	return wait, true
+}
+
+// serverRetryDelay returns the delay requested by the server through
+// the "Retry-After" (seconds or http date) header of 429 and 503
+// responses, or the "X-Rate-Limit-Reset" (unix timestamp) header of
+// 429 responses. The rate limit reset is only used when the rate limit
+// is exhausted, as rate limiters also set it on the responses of the
+// requests they let through (i.e a 503 of a rate limited service).
+func serverRetryDelay(statusCode int, header http.Header, now time.Time) (time.Duration, bool) {
+	if header == nil {
+		return 0, false
+	}
+	if statusCode != http.StatusTooManyRequests && statusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+
+	if v := header.Get("Retry-After"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil {
+			return max(time.Duration(secs)*time.Second, 0), true
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			return max(t.Sub(now), 0), true
+		}
+	}
+
+	if statusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+	if v := header.Get("X-Rate-Limit-Remaining"); v != "" && v != "0" {
+		return 0, false
+	}
+	if v := header.Get("X-Rate-Limit-Reset"); v != "" {
+		if ts, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return max(time.Unix(ts, 0).Sub(now), 0), true
+		}
+	}
+
+	return 0, false
+}
+
+// isIdempotent returns true for the idempotent http methods.
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions,
+		http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// retryBudget is a concurrency safe retry budget, see
+// [RetryBudgetConfig].
+type retryBudget struct {
+	mu        sync.Mutex
+	tokens    float64
+	maxTokens float64
+	ratio     float64
+}
+
+func newRetryBudget(cfg *RetryBudgetConfig) *retryBudget {
+	b := &retryBudget{
+		maxTokens: DEFAULT_RETRY_BUDGET_TOKENS,
+		ratio:     DEFAULT_RETRY_BUDGET_RATIO,
+	}
+	if cfg != nil && cfg.MaxTokens > 0 {
+		b.maxTokens = cfg.MaxTokens
+	}
+	if cfg != nil && cfg.TokenRatio > 0 {
+		b.ratio = cfg.TokenRatio
+	}
+	b.tokens = b.maxTokens
+
+	return b
+}
+
+func (b *retryBudget) onSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.tokens+b.ratio, b.maxTokens)
+}
+
+func (b *retryBudget) onFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = max(b.tokens-1, 0)
+}
+
+func (b *retryBudget) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tokens > b.maxTokens/2
+}
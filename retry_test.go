@@ -0,0 +1,220 @@
+package betsi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/iolave/go-errors"
+)
+
+type retryTestRequest struct {
+	ID string `ar:"path=id"`
+}
+
+// newRetryTestServer returns a client for a server that fails with
+// `status` the first `failures` requests.
+func newRetryTestServer(t *testing.T, failures int32, status int, header http.Header, retry *RetryConfig) (*Client, *atomic.Int32) {
+	calls := &atomic.Int32{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(status)
+			w.Write(errors.NewHTTPError(status, "test_error", "failed", nil).(*errors.HTTPError).JSON())
+			return
+		}
+		w.Write([]byte(`{"id":"1"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	c, err := NewClient(ClientConfig{BaseURL: srv.URL, Retry: retry})
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+
+	return c, calls
+}
+
+func TestDoRetry(t *testing.T) {
+	type TestCase struct {
+		Name      string
+		Method    string
+		Failures  int32
+		Status    int
+		Header    http.Header
+		Retry     *RetryConfig
+		WantCalls int32
+		WantErr   bool
+	}
+
+	retry := &RetryConfig{InitialBackoff: time.Millisecond}
+
+	testCases := []TestCase{}
+	testCases = append(testCases, TestCase{
+		Name:      "retryable status should be retried",
+		Method:    http.MethodGet,
+		Failures:  2,
+		Status:    http.StatusServiceUnavailable,
+		Retry:     retry,
+		WantCalls: 3,
+		WantErr:   false,
+	})
+	testCases = append(testCases, TestCase{
+		Name:      "retries should stop after max attempts",
+		Method:    http.MethodGet,
+		Failures:  5,
+		Status:    http.StatusServiceUnavailable,
+		Retry:     retry,
+		WantCalls: 3,
+		WantErr:   true,
+	})
+	testCases = append(testCases, TestCase{
+		Name:      "non retryable status should not be retried",
+		Method:    http.MethodGet,
+		Failures:  1,
+		Status:    http.StatusBadRequest,
+		Retry:     retry,
+		WantCalls: 1,
+		WantErr:   true,
+	})
+	testCases = append(testCases, TestCase{
+		Name:      "non idempotent methods should not be retried",
+		Method:    http.MethodPost,
+		Failures:  1,
+		Status:    http.StatusServiceUnavailable,
+		Retry:     retry,
+		WantCalls: 1,
+		WantErr:   true,
+	})
+	testCases = append(testCases, TestCase{
+		Name:      "non idempotent methods should be retried when enabled",
+		Method:    http.MethodPost,
+		Failures:  1,
+		Status:    http.StatusServiceUnavailable,
+		Retry:     &RetryConfig{InitialBackoff: time.Millisecond, RetryNonIdempotent: true},
+		WantCalls: 2,
+		WantErr:   false,
+	})
+	testCases = append(testCases, TestCase{
+		Name:      "retry after longer than max wait should not be retried",
+		Method:    http.MethodGet,
+		Failures:  1,
+		Status:    http.StatusTooManyRequests,
+		Header:    http.Header{"Retry-After": []string{"60"}},
+		Retry:     retry,
+		WantCalls: 1,
+		WantErr:   true,
+	})
+	testCases = append(testCases, TestCase{
+		Name:     "rate limit reset should be respected",
+		Method:   http.MethodGet,
+		Failures: 1,
+		Status:   http.StatusTooManyRequests,
+		Header: http.Header{"X-Rate-Limit-Reset": []string{
+			strconv.FormatInt(time.Now().Unix(), 10),
+		}},
+		Retry:     retry,
+		WantCalls: 2,
+		WantErr:   false,
+	})
+	testCases = append(testCases, TestCase{
+		Name:     "rate limit reset should be ignored for other statuses",
+		Method:   http.MethodGet,
+		Failures: 1,
+		Status:   http.StatusServiceUnavailable,
+		Header: http.Header{
+			"X-Rate-Limit-Remaining": []string{"9"},
+			"X-Rate-Limit-Reset": []string{
+				strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10),
+			},
+		},
+		Retry:     retry,
+		WantCalls: 2,
+		WantErr:   false,
+	})
+	testCases = append(testCases, TestCase{
+		Name:     "rate limit reset should be ignored when the limit is not exhausted",
+		Method:   http.MethodGet,
+		Failures: 1,
+		Status:   http.StatusTooManyRequests,
+		Header: http.Header{
+			"X-Rate-Limit-Remaining": []string{"9"},
+			"X-Rate-Limit-Reset": []string{
+				strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10),
+			},
+		},
+		Retry:     retry,
+		WantCalls: 2,
+		WantErr:   false,
+	})
+	testCases = append(testCases, TestCase{
+		Name:      "requests should not be retried without retry config",
+		Method:    http.MethodGet,
+		Failures:  1,
+		Status:    http.StatusServiceUnavailable,
+		Retry:     nil,
+		WantCalls: 1,
+		WantErr:   true,
+	})
+
+	for _, tt := range testCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			c, calls := newRetryTestServer(t, tt.Failures, tt.Status, tt.Header, tt.Retry)
+			_, err := Do[retryTestRequest, map[string]string](
+				context.Background(), c, tt.Method, "/users/{id}", retryTestRequest{ID: "1"},
+			)
+			if (err != nil) != tt.WantErr {
+				t.Errorf("got error %v, wantErr: %v", err, tt.WantErr)
+			}
+			if got := calls.Load(); got != tt.WantCalls {
+				t.Errorf("got %d calls, want %d", got, tt.WantCalls)
+			}
+		})
+	}
+}
+
+func TestDoRetryBudget(t *testing.T) {
+	c, calls := newRetryTestServer(t, 100, http.StatusServiceUnavailable, nil, &RetryConfig{
+		MaxAttempts:    10,
+		InitialBackoff: time.Millisecond,
+		Budget:         &RetryBudgetConfig{MaxTokens: 4},
+	})
+
+	// The budget allows retries while it holds more than 2
+	// tokens, so only 2 attempts are made.
+	Do[retryTestRequest, any](context.Background(), c, http.MethodGet, "/users/{id}", retryTestRequest{ID: "1"})
+	if got := calls.Load(); got != 2 {
+		t.Errorf("got %d calls, want 2", got)
+	}
+
+	// The budget is exhausted, so the next call isn't retried.
+	Do[retryTestRequest, any](context.Background(), c, http.MethodGet, "/users/{id}", retryTestRequest{ID: "1"})
+	if got := calls.Load(); got != 3 {
+		t.Errorf("got %d calls, want 3", got)
+	}
+}
+
+func TestDoCallTimeout(t *testing.T) {
+	c, _ := newRetryTestServer(t, 100, http.StatusServiceUnavailable, nil, &RetryConfig{
+		MaxAttempts:    100,
+		InitialBackoff: 50 * time.Millisecond,
+	})
+
+	start := time.Now()
+	_, err := Do[retryTestRequest, any](
+		context.Background(), c, http.MethodGet, "/users/{id}", retryTestRequest{ID: "1"},
+		WithCallTimeout(120*time.Millisecond),
+	)
+	if err == nil {
+		t.Errorf("got nil error")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("call took %s, want it to stop at the call timeout", elapsed)
+	}
+}
@@ -95,91 +95,69 @@ func (r Router) buildPatterns(pattern string) []string {
 	return patterns
 }
 
-// convertToAcceptedHandler converts the appfactory.Handler
-// to http.HandlerFunc.
-func (r Router) convertToAcceptedHandlerWithLog(
-	handler Handler[any, any],
-) http.HandlerFunc {
-	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		handler(AppRequest[any, any]{
-			Req: r,
-			w:   w,
-		})
-	})
-
-	wrappedFn := func(w http.ResponseWriter, r *http.Request) {
-		// app, _ := GetFromContext(r.Context())
-		// if app == nil {
-		fn(w, r)
-		// } else {
-		// 	//app.mdwAppRequestLog(fn).ServeHTTP(w, r)
-		// }
+// handle registers the handler `h` for the `meta.Method` within the
+// patterns returned by buildPatterns for `meta.Pattern`. The route
+// metadata and the handler `name` are kept within the registered
+// handler.
+func (r Router) handle(meta RouteMeta, name string, h http.HandlerFunc) {
+	rh := &routeHandler{
+		name: name,
+		meta: meta,
+		fn:   h,
 	}
 
-	return wrappedFn
+	for _, pat := range r.buildPatterns(meta.Pattern) {
+		r.mux.Method(meta.Method, pat, rh)
+	}
 }
 
 // Get adds the route `pattern` that matches a GET http
-// method to execute the `handler` appfactory.Handler.
-func (r Router) Get(pattern string, handler Handler[any, any]) {
-	h := r.convertToAcceptedHandlerWithLog(handler)
-	for _, pat := range r.buildPatterns(pattern) {
-		r.mux.Get(pat, h)
-	}
+// method to execute the `handler` RouteHandler.
+func (r Router) Get(pattern string, handler RouteHandler) {
+	meta, name := untypedRouteMeta(http.MethodGet, pattern, handler)
+	r.handle(meta, name, handler.ServeHTTP)
 }
 
 // Post adds the route `pattern` that matches a POST http
-// method to execute the `handler` appfactory.Handler.
-func (r Router) Post(pattern string, handler Handler[any, any]) {
-	h := r.convertToAcceptedHandlerWithLog(handler)
-	for _, pat := range r.buildPatterns(pattern) {
-		r.mux.Post(pat, h)
-	}
+// method to execute the `handler` RouteHandler.
+func (r Router) Post(pattern string, handler RouteHandler) {
+	meta, name := untypedRouteMeta(http.MethodPost, pattern, handler)
+	r.handle(meta, name, handler.ServeHTTP)
 }
 
 // Put adds the route `pattern` that matches a PUT http
-// method to execute the `handler` appfactory.Handler.
-func (r Router) Put(pattern string, handler Handler[any, any]) {
-	h := r.convertToAcceptedHandlerWithLog(handler)
-	for _, pat := range r.buildPatterns(pattern) {
-		r.mux.Put(pat, h)
-	}
+// method to execute the `handler` RouteHandler.
+func (r Router) Put(pattern string, handler RouteHandler) {
+	meta, name := untypedRouteMeta(http.MethodPut, pattern, handler)
+	r.handle(meta, name, handler.ServeHTTP)
 }
 
 // Delete adds the route `pattern` that matches a DELETE http
-// method to execute the `handler` appfactory.Handler.
-func (r Router) Delete(pattern string, handler Handler[any, any]) {
-	h := r.convertToAcceptedHandlerWithLog(handler)
-	for _, pat := range r.buildPatterns(pattern) {
-		r.mux.Delete(pat, h)
-	}
+// method to execute the `handler` RouteHandler.
+func (r Router) Delete(pattern string, handler RouteHandler) {
+	meta, name := untypedRouteMeta(http.MethodDelete, pattern, handler)
+	r.handle(meta, name, handler.ServeHTTP)
 }
 
 // Path adds the route `pattern` that matches a PATCH http
-// method to execute the `handler` appfactory.Handler.
-func (r Router) Patch(pattern string, handler Handler[any, any]) {
-	h := r.convertToAcceptedHandlerWithLog(handler)
-	for _, pat := range r.buildPatterns(pattern) {
-		r.mux.Patch(pat, h)
-	}
+// method to execute the `handler` RouteHandler.
+func (r Router) Patch(pattern string, handler RouteHandler) {
+	meta, name := untypedRouteMeta(http.MethodPatch, pattern, handler)
+	r.handle(meta, name, handler.ServeHTTP)
 }
 
 // Head adds the route `pattern` that matches a HEAD http
-// method to execute the `handler` appfactory.Handler.
-func (r Router) Head(pattern string, handler Handler[any, any]) {
-	h := r.convertToAcceptedHandlerWithLog(handler)
-	for _, pat := range r.buildPatterns(pattern) {
-		r.mux.Head(pat, h)
-	}
+// method to execute the `handler` RouteHandler.
+func (r Router) Head(pattern string, handler RouteHandler) {
+	meta, name := untypedRouteMeta(http.MethodHead, pattern, handler)
+	r.handle(meta, name, handler.ServeHTTP)
 }
 
 // Options adds the route `pattern` that matches an OPTIONS
-// http method to execute the `handler` appfactory.Handler.
-func (r Router) Options(pattern string, handler Handler[any, any]) {
-	h := r.convertToAcceptedHandlerWithLog(handler)
-	for _, pat := range r.buildPatterns(pattern) {
-		r.mux.Options(pat, h)
-	}
+// http method to execute the `handler` RouteHandler.
+func (r Router) Options(pattern string, handler RouteHandler) {
+	meta, name := untypedRouteMeta(http.MethodOptions, pattern, handler)
+	r.handle(meta, name, handler.ServeHTTP)
 }
 
 // Handler is the type of the handler function that
@@ -197,27 +175,85 @@ func (h Handler[In, Out]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// NewHandler wraps a type-safe Handler[In, Out] into a generic Handler[any, any].
+// RouteHandler is a handler that can be registered within the routes
+// of a Router (i.e with [Router.Get]). It is implemented by Handler and
+// by the handlers returned by NewHandler.
+type RouteHandler interface {
+	http.Handler
+
+	// routeMeta returns the `In` and `Out` types of the handler
+	// and its name.
+	routeMeta() (in, out reflect.Type, name string)
+}
+
+// routeMeta returns the `In` and `Out` types of h, which are nil
+// for an untyped Handler[any, any], and the name of h.
+func (h Handler[In, Out]) routeMeta() (reflect.Type, reflect.Type, string) {
+	in, out := reflect.TypeFor[In](), reflect.TypeFor[Out]()
+	if in == anyType {
+		in = nil
+	}
+	if out == anyType {
+		out = nil
+	}
+
+	return in, out, funcName(h)
+}
+
+// anyType is the type of the `In` and `Out` type parameters
+// of an untyped Handler[any, any].
+var anyType = reflect.TypeFor[any]()
+
+// NewHandler wraps a type-safe Handler[In, Out] into a RouteHandler.
 //
 // This function is useful for adapting specific, strongly-typed handlers to contexts
 // where the router expects a more general handler signature (e.g., when registering
 // routes where the exact input/output types are not yet known or are managed
 // internally by the AppRequest's mechanisms).
 //
-// The returned handler internally converts the generic AppRequest[any, any] back
-// into the original AppRequest[In, Out] before invoking the provided type-safe handler `h`.
-func NewHandler[In, Out any](h Handler[In, Out]) Handler[any, any] {
-	nh := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ar := AppRequest[In, Out]{
-			Req: r,
-			w:   w,
-		}
-		h(ar)
-	})
+// The `In` and `Out` types (and the name of `h`) are kept, so the routes
+// registered with the returned handler (i.e with [Router.Get]) hold them
+// within their metadata, just like the routes registered with the typed
+// helpers (i.e [Get]).
+func NewHandler[In, Out any](h Handler[In, Out]) RouteHandler {
+	return typedHandler{
+		in:   reflect.TypeFor[In](),
+		out:  reflect.TypeFor[Out](),
+		name: funcName(h),
+		fn:   h.ServeHTTP,
+	}
+}
 
-	return func(ar AppRequest[any, any]) {
-		nh.ServeHTTP(ar.w, ar.Req)
+// typedHandler is the RouteHandler returned by NewHandler, it holds
+// the metadata of the wrapped handler.
+type typedHandler struct {
+	in   reflect.Type
+	out  reflect.Type
+	name string
+	fn   http.HandlerFunc
+}
+
+func (h typedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.fn(w, r)
+}
+
+func (h typedHandler) routeMeta() (reflect.Type, reflect.Type, string) {
+	return h.in, h.out, h.name
+}
+
+// untypedRouteMeta returns the metadata and name of a route registered
+// with a RouteHandler, the `In` and `Out` types are set when the handler
+// holds them (i.e when it was created by NewHandler).
+func untypedRouteMeta(method, pattern string, handler RouteHandler) (RouteMeta, string) {
+	meta := RouteMeta{Method: method, Pattern: pattern}
+	if handler == nil {
+		return meta, ""
 	}
+	in, out, name := handler.routeMeta()
+	meta.In = in
+	meta.Out = out
+
+	return meta, name
 }
 
 // AppRequest is a generic wrapper around the standard http.Request and
@@ -280,6 +316,13 @@ func (ar AppRequest[_, _]) Context() context.Context {
 	return ar.Req.Context()
 }
 
+// RequestID returns the request id stored within the request trace by
+// the trace middleware (middlewares.NewTraceMdw), or an empty string
+// if there's none.
+func (ar AppRequest[_, _]) RequestID() string {
+	return utils.GetRequestIDFromContext(ar.Context())
+}
+
 // SendJSONError sends a structured JSON error response to the client.
 //
 // It intelligently handles the provided error:
@@ -294,8 +337,6 @@ func (ar AppRequest[_, _]) Context() context.Context {
 // into the response headers for observability. The Content-Type is always
 // set to "application/json".
 func (ar AppRequest[_, _]) SendJSONError(ctx context.Context, err error) {
-	t := trace.GetFromContext(ctx)
-
 	switch err.(type) {
 	case *errors.HTTPError:
 		break
@@ -311,11 +352,7 @@ func (ar AppRequest[_, _]) SendJSONError(ctx context.Context, err error) {
 		)
 	}
 
-	httperr := err.(*errors.HTTPError)
-	t.SetHTTPHeaders(ar.w.Header())
-	ar.w.Header().Set("Content-Type", "application/json")
-	ar.w.WriteHeader(httperr.StatusCode)
-	ar.w.Write(httperr.JSON())
+	utils.WriteHTTPError(ctx, ar.w, err.(*errors.HTTPError))
 }
 
 // SendJSON marshals the provided data `v` into a JSON response, sets the
@@ -0,0 +1,486 @@
+package betsi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/iolave/go-logger"
+)
+
+// RouteMeta holds the metadata of a route registered within
+// a Router.
+type RouteMeta struct {
+	// Method is the http method matched by the route.
+	Method string
+
+	// Pattern is the pattern the route was registered with,
+	// relative to the router it was registered in.
+	Pattern string
+
+	// In is the type of the handler request (the `In` type
+	// parameter of the AppRequest). It is nil when the route
+	// was registered with an untyped Handler[any, any] that was
+	// not created by NewHandler.
+	In reflect.Type
+
+	// Out is the type of the handler response (the `Out` type
+	// parameter of the AppRequest). It is nil when the route
+	// was registered with an untyped Handler[any, any] that was
+	// not created by NewHandler.
+	Out reflect.Type
+
+	// OperationID is the unique identifier of the route
+	// operation, it is used by the OpenAPI document.
+	OperationID string
+
+	// Summary is a short summary of what the route does.
+	Summary string
+
+	// Description is a verbose explanation of the route
+	// behavior.
+	Description string
+
+	// Tags are used to group routes within the OpenAPI
+	// document.
+	Tags []string
+
+	// Hidden determines whether to exclude the route from
+	// the OpenAPI document.
+	Hidden bool
+}
+
+// RouteOption sets optional metadata of a route registered
+// with the typed helpers (i.e [Get]).
+type RouteOption func(meta *RouteMeta)
+
+// WithOperationID sets the route operation id. If not set,
+// the OpenAPI document generates one from the method and
+// pattern.
+func WithOperationID(id string) RouteOption {
+	return func(meta *RouteMeta) {
+		meta.OperationID = id
+	}
+}
+
+// WithSummary sets the route summary.
+func WithSummary(summary string) RouteOption {
+	return func(meta *RouteMeta) {
+		meta.Summary = summary
+	}
+}
+
+// WithDescription sets the route description.
+func WithDescription(description string) RouteOption {
+	return func(meta *RouteMeta) {
+		meta.Description = description
+	}
+}
+
+// WithTags appends tags to the route tags.
+func WithTags(tags ...string) RouteOption {
+	return func(meta *RouteMeta) {
+		meta.Tags = append(meta.Tags, tags...)
+	}
+}
+
+// WithHidden excludes the route from the OpenAPI document.
+func WithHidden() RouteOption {
+	return func(meta *RouteMeta) {
+		meta.Hidden = true
+	}
+}
+
+// Route describes a route registered within a Router, it is
+// returned by [Router.Routes].
+type Route struct {
+	// Method is the http method matched by the route.
+	Method string
+
+	// Pattern is the full route pattern, including the patterns
+	// of the routers it is mounted in.
+	Pattern string
+
+	// Handler is the name of the route handler function.
+	Handler string
+
+	// Middlewares are the names of the middleware functions that
+	// are executed before the handler, in execution order.
+	Middlewares []string
+
+	// Meta is the metadata the route was registered with.
+	Meta RouteMeta
+}
+
+// routeHandler is the http.Handler registered in the chi mux
+// for every route, it keeps the route metadata so it can be
+// retrieved later on by walking the mux.
+type routeHandler struct {
+	name string
+	meta RouteMeta
+	fn   http.HandlerFunc
+}
+
+func (h *routeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.fn(w, r)
+}
+
+// InType returns the request type of the route, it implements
+// the InTyper interface of the internal utils package.
+func (h *routeHandler) InType() reflect.Type {
+	return h.meta.In
+}
+
+// Get adds the route `pattern` that matches a GET http method
+// to execute the type-safe `handler`. Unlike [Router.Get], the
+// `In` and `Out` types are kept within the route metadata.
+//
+// It panics if the `ar` tags of `In` are not valid for the
+// pattern, see [Handle].
+func Get[In, Out any](r *Router, pattern string, handler Handler[In, Out], opts ...RouteOption) {
+	Handle(r, http.MethodGet, pattern, handler, opts...)
+}
+
+// Post adds the route `pattern` that matches a POST http method
+// to execute the type-safe `handler`. Unlike [Router.Post], the
+// `In` and `Out` types are kept within the route metadata.
+//
+// It panics if the `ar` tags of `In` are not valid for the
+// pattern, see [Handle].
+func Post[In, Out any](r *Router, pattern string, handler Handler[In, Out], opts ...RouteOption) {
+	Handle(r, http.MethodPost, pattern, handler, opts...)
+}
+
+// Put adds the route `pattern` that matches a PUT http method
+// to execute the type-safe `handler`. Unlike [Router.Put], the
+// `In` and `Out` types are kept within the route metadata.
+//
+// It panics if the `ar` tags of `In` are not valid for the
+// pattern, see [Handle].
+func Put[In, Out any](r *Router, pattern string, handler Handler[In, Out], opts ...RouteOption) {
+	Handle(r, http.MethodPut, pattern, handler, opts...)
+}
+
+// Delete adds the route `pattern` that matches a DELETE http method
+// to execute the type-safe `handler`. Unlike [Router.Delete], the
+// `In` and `Out` types are kept within the route metadata.
+//
+// It panics if the `ar` tags of `In` are not valid for the
+// pattern, see [Handle].
+func Delete[In, Out any](r *Router, pattern string, handler Handler[In, Out], opts ...RouteOption) {
+	Handle(r, http.MethodDelete, pattern, handler, opts...)
+}
+
+// Patch adds the route `pattern` that matches a PATCH http method
+// to execute the type-safe `handler`. Unlike [Router.Patch], the
+// `In` and `Out` types are kept within the route metadata.
+//
+// It panics if the `ar` tags of `In` are not valid for the
+// pattern, see [Handle].
+func Patch[In, Out any](r *Router, pattern string, handler Handler[In, Out], opts ...RouteOption) {
+	Handle(r, http.MethodPatch, pattern, handler, opts...)
+}
+
+// Head adds the route `pattern` that matches a HEAD http method
+// to execute the type-safe `handler`. Unlike [Router.Head], the
+// `In` and `Out` types are kept within the route metadata.
+//
+// It panics if the `ar` tags of `In` are not valid for the
+// pattern, see [Handle].
+func Head[In, Out any](r *Router, pattern string, handler Handler[In, Out], opts ...RouteOption) {
+	Handle(r, http.MethodHead, pattern, handler, opts...)
+}
+
+// Options adds the route `pattern` that matches an OPTIONS http method
+// to execute the type-safe `handler`. Unlike [Router.Options], the
+// `In` and `Out` types are kept within the route metadata.
+//
+// It panics if the `ar` tags of `In` are not valid for the
+// pattern, see [Handle].
+func Options[In, Out any](r *Router, pattern string, handler Handler[In, Out], opts ...RouteOption) {
+	Handle(r, http.MethodOptions, pattern, handler, opts...)
+}
+
+// Handle adds the route `pattern` that matches the `method` http
+// method to execute the type-safe `handler`. The `In` and `Out`
+// types are kept within the route metadata, along with the metadata
+// set by the route options (i.e [WithSummary]).
+//
+// Registering a route validates the `ar` tags of `In`, so mistakes are
+// caught at startup instead of at request time. It panics if:
+//
+//   - The pattern is empty.
+//   - A tag or a tag value is not supported.
+//
+// The `path` tags are validated against the full pattern of the route
+// by [Router.ValidateRoutes], as routes registered within a subrouter
+// can read the params of the pattern the subrouter is mounted at.
+//
+// Example:
+//
+//	type GetUserRequest struct {
+//		ID string `ar:"path=id"`
+//	}
+//
+//	betsi.Get(r, "/users/{id}", func(ar betsi.AppRequest[GetUserRequest, User]) {
+//		// ...
+//	}, betsi.WithSummary("Get a user"), betsi.WithTags("users"))
+func Handle[In, Out any](r *Router, method, pattern string, handler Handler[In, Out], opts ...RouteOption) {
+	meta := RouteMeta{
+		Method:  method,
+		Pattern: pattern,
+		In:      reflect.TypeFor[In](),
+		Out:     reflect.TypeFor[Out](),
+	}
+	for _, opt := range opts {
+		opt(&meta)
+	}
+
+	if err := validateRouteInParams(pattern, meta.In, nil); err != nil {
+		panic(err.Error())
+	}
+
+	r.handle(meta, funcName(handler), handler.ServeHTTP)
+}
+
+// validateRouteIn validates the `ar` tags of the `in` type against
+// the full route pattern. Non struct types are not validated since
+// they can't hold `ar` tags.
+func validateRouteIn(pattern string, in reflect.Type) error {
+	params := map[string]bool{}
+	for _, p := range parsePatternParams(pattern) {
+		params[p.Name] = true
+	}
+
+	return validateRouteInParams(pattern, in, params)
+}
+
+// validateRouteInParams validates the `ar` tags of the `in` type, the
+// `path` tags are checked against params unless params is nil.
+func validateRouteInParams(pattern string, in reflect.Type, params map[string]bool) error {
+	if in.Kind() != reflect.Struct {
+		return nil
+	}
+
+	for i := range in.NumField() {
+		t := in.Field(i)
+		fullTag, ok := t.Tag.Lookup("ar")
+		if !ok {
+			continue
+		}
+		for tag := range strings.SplitSeq(fullTag, ",") {
+			splittedTag := strings.Split(tag, "=")
+			k := splittedTag[0]
+			switch k {
+			case "path":
+				if len(splittedTag) != 2 {
+					return fmt.Errorf(ERR_ENCDEC_PATH_NO_VAL, t.Name)
+				}
+				if t.Type.Kind() != reflect.String {
+					return fmt.Errorf(ERR_ENCDEC_PATH_INVALID, t.Name)
+				}
+				if params != nil && !params[splittedTag[1]] {
+					return fmt.Errorf(ERR_ROUTE_PATH_NOT_FOUND, splittedTag[1], pattern, t.Name)
+				}
+			case "body":
+				if len(splittedTag) != 2 {
+					return fmt.Errorf(ERR_ENCDEC_BODY_NO_VAL, t.Name)
+				}
+				if typ := splittedTag[1]; typ != "json" {
+					return fmt.Errorf(ERR_ENCDEC_TAG_VAL_INVALID, "body", typ, t.Name)
+				}
+			default:
+				return fmt.Errorf(ERR_ENCDEC_INVALID_TAG, k, t.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// patternParam is a path param placeholder found within a
+// route pattern.
+type patternParam struct {
+	// Placeholder is the placeholder as written in the pattern
+	// (i.e "{id:[0-9]+}").
+	Placeholder string
+
+	// Name is the path param name (i.e "id").
+	Name string
+
+	// Regexp is the chi regexp of the placeholder (i.e "[0-9]+"),
+	// it is empty if the placeholder doesn't have one.
+	Regexp string
+}
+
+// parsePatternParams returns the path param placeholders found within
+// the pattern in the order they appear. It supports chi regexp
+// placeholders (i.e "{id:[0-9]+}"), including the ones that contain
+// braces (i.e "{code:[a-z]{3}}").
+func parsePatternParams(pattern string) []patternParam {
+	params := []patternParam{}
+
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '{' {
+			continue
+		}
+
+		depth := 0
+		end := -1
+		for j := i; j < len(pattern); j++ {
+			switch pattern[j] {
+			case '{':
+				depth++
+			case '}':
+				depth--
+			}
+			if depth == 0 {
+				end = j
+				break
+			}
+		}
+		if end == -1 {
+			break
+		}
+
+		placeholder := pattern[i : end+1]
+		name, rexp, _ := strings.Cut(placeholder[1:len(placeholder)-1], ":")
+		params = append(params, patternParam{
+			Placeholder: placeholder,
+			Name:        name,
+			Regexp:      rexp,
+		})
+		i = end
+	}
+
+	return params
+}
+
+// Routes returns the routes registered within the router, including
+// the ones of the subrouters attached with [Router.Route]. Routes are
+// sorted by pattern and method.
+//
+// The additional `/` sufixed (or non-sufixed) pattern registered for
+// every route is not returned, only the pattern the route was
+// registered with.
+func (r Router) Routes() []Route {
+	routes := []Route{}
+
+	chi.Walk(r.mux, func(
+		method, route string,
+		handler http.Handler,
+		middlewares ...func(http.Handler) http.Handler,
+	) error {
+		rh, ok := handler.(*routeHandler)
+		if !ok {
+			return nil
+		}
+
+		// Skips the other pattern generated by buildPatterns, which
+		// is `/` sufixed only if the registered pattern isn't.
+		if strings.HasSuffix(route, "/") != strings.HasSuffix(rh.meta.Pattern, "/") {
+			return nil
+		}
+
+		mdws := []string{}
+		for _, mdw := range middlewares {
+			mdws = append(mdws, funcName(mdw))
+		}
+
+		routes = append(routes, Route{
+			Method:      method,
+			Pattern:     route,
+			Handler:     rh.name,
+			Middlewares: mdws,
+			Meta:        rh.meta,
+		})
+		return nil
+	})
+
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].Pattern != routes[j].Pattern {
+			return routes[i].Pattern < routes[j].Pattern
+		}
+		return routes[i].Method < routes[j].Method
+	})
+
+	return routes
+}
+
+// ValidateRoutes validates the `ar` tags of the `In` type of every route
+// against its full pattern (including the patterns of the routers it is
+// mounted in), it returns an error if a `path` tag references a param
+// that is not part of the pattern. [App.Start] and [App.StartTLS] call
+// it before serving the router.
+func (r Router) ValidateRoutes() error {
+	for _, route := range r.Routes() {
+		if route.Meta.In == nil {
+			continue
+		}
+		if err := validateRouteIn(route.Pattern, route.Meta.In); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LogRoutes logs the routes registered within the router as a single
+// "app_routes" info message, where each route is logged as
+// "<METHOD> <pattern> -> <handler>" under the "routes" key.
+//
+// The route middlewares and `In` and `Out` types are logged under
+// the "details" key.
+func (r Router) LogRoutes(ctx context.Context, l logger.Logger) {
+	table := []string{}
+	details := []map[string]any{}
+
+	for _, route := range r.Routes() {
+		table = append(table, fmt.Sprintf(
+			"%s %s -> %s",
+			route.Method,
+			route.Pattern,
+			route.Handler,
+		))
+
+		detail := map[string]any{
+			"method":      route.Method,
+			"pattern":     route.Pattern,
+			"handler":     route.Handler,
+			"middlewares": route.Middlewares,
+		}
+		if route.Meta.In != nil {
+			detail["in"] = route.Meta.In.String()
+		}
+		if route.Meta.Out != nil {
+			detail["out"] = route.Meta.Out.String()
+		}
+		details = append(details, detail)
+	}
+
+	l.InfoWithData(ctx, "app_routes", map[string]any{
+		"routes":  table,
+		"details": details,
+	})
+}
+
+// funcName returns the name of the function `fn`. It returns
+// an empty string if fn is not a function.
+func funcName(fn any) string {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return ""
+	}
+
+	f := runtime.FuncForPC(v.Pointer())
+	if f == nil {
+		return ""
+	}
+
+	return f.Name()
+}
@@ -0,0 +1,209 @@
+package betsi
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestParsePatternParams(t *testing.T) {
+	type TestCase struct {
+		Name    string
+		Pattern string
+		Want    []patternParam
+	}
+
+	testCases := []TestCase{}
+	testCases = append(testCases, TestCase{
+		Name:    "pattern without params",
+		Pattern: "/users",
+		Want:    []patternParam{},
+	})
+	testCases = append(testCases, TestCase{
+		Name:    "pattern with params",
+		Pattern: "/users/{id}/posts/{postId}",
+		Want: []patternParam{
+			{Placeholder: "{id}", Name: "id"},
+			{Placeholder: "{postId}", Name: "postId"},
+		},
+	})
+	testCases = append(testCases, TestCase{
+		Name:    "pattern with regexp params",
+		Pattern: "/users/{id:[0-9]+}/{code:[a-z]{3}}",
+		Want: []patternParam{
+			{Placeholder: "{id:[0-9]+}", Name: "id", Regexp: "[0-9]+"},
+			{Placeholder: "{code:[a-z]{3}}", Name: "code", Regexp: "[a-z]{3}"},
+		},
+	})
+
+	for _, tt := range testCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			got := parsePatternParams(tt.Pattern)
+			if !reflect.DeepEqual(got, tt.Want) {
+				t.Errorf("got %v, want %v", got, tt.Want)
+			}
+		})
+	}
+}
+
+func TestValidateRouteIn(t *testing.T) {
+	type TestCase struct {
+		Name    string
+		Pattern string
+		In      reflect.Type
+		WantErr bool
+	}
+
+	testCases := []TestCase{}
+	testCases = append(testCases, TestCase{
+		Name:    "validation should pass for non struct types",
+		Pattern: "/users",
+		In:      reflect.TypeFor[any](),
+		WantErr: false,
+	})
+	testCases = append(testCases, TestCase{
+		Name:    "validation should pass for existing path params",
+		Pattern: "/users/{id:[0-9]+}",
+		In: reflect.TypeFor[struct {
+			ID   string   `ar:"path=id"`
+			Body struct{} `ar:"body=json"`
+		}](),
+		WantErr: false,
+	})
+	testCases = append(testCases, TestCase{
+		Name:    "validation should fail for missing path params",
+		Pattern: "/users/{userId}",
+		In: reflect.TypeFor[struct {
+			ID string `ar:"path=id"`
+		}](),
+		WantErr: true,
+	})
+	testCases = append(testCases, TestCase{
+		Name:    "validation should fail for non string path params",
+		Pattern: "/users/{id}",
+		In: reflect.TypeFor[struct {
+			ID int `ar:"path=id"`
+		}](),
+		WantErr: true,
+	})
+	testCases = append(testCases, TestCase{
+		Name:    "validation should fail for unsupported body types",
+		Pattern: "/users",
+		In: reflect.TypeFor[struct {
+			Body struct{} `ar:"body=xml"`
+		}](),
+		WantErr: true,
+	})
+	testCases = append(testCases, TestCase{
+		Name:    "validation should fail for unsupported tags",
+		Pattern: "/users",
+		In: reflect.TypeFor[struct {
+			Query string `ar:"query=q"`
+		}](),
+		WantErr: true,
+	})
+
+	for _, tt := range testCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			err := validateRouteIn(tt.Pattern, tt.In)
+			if (err != nil) != tt.WantErr {
+				t.Errorf("got error %v, wantErr: %v", err, tt.WantErr)
+			}
+		})
+	}
+}
+
+func TestRouterRoutes(t *testing.T) {
+	type GetUserRequest struct {
+		ID string `ar:"path=id"`
+	}
+	type GetUserResponse struct {
+		ID string `json:"id"`
+	}
+	mdw := func(next http.Handler) http.Handler { return next }
+
+	users := NewRouter()
+	Get(users, "/{id}", func(ar AppRequest[GetUserRequest, GetUserResponse]) {})
+	users.With(mdw).Delete("/{id}", Handler[any, any](func(ar AppRequest[any, any]) {}))
+
+	r := NewRouter()
+	r.Get("/", Handler[any, any](func(ar AppRequest[any, any]) {}))
+	r.Get("/health/", Handler[any, any](func(ar AppRequest[any, any]) {}))
+	r.Post("/me", NewHandler(func(ar AppRequest[struct{}, GetUserResponse]) {}))
+	r.Route("/users", users)
+
+	got := r.Routes()
+	want := []struct {
+		Method      string
+		Pattern     string
+		Middlewares int
+		In          reflect.Type
+	}{
+		{http.MethodGet, "/", 0, nil},
+		{http.MethodGet, "/health/", 0, nil},
+		{http.MethodPost, "/me", 0, reflect.TypeFor[struct{}]()},
+		{http.MethodDelete, "/users/{id}", 1, nil},
+		{http.MethodGet, "/users/{id}", 0, reflect.TypeFor[GetUserRequest]()},
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d routes, want %d: %v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		g := got[i]
+		if g.Method != w.Method || g.Pattern != w.Pattern {
+			t.Errorf("got route %s %s, want %s %s", g.Method, g.Pattern, w.Method, w.Pattern)
+		}
+		if len(g.Middlewares) != w.Middlewares {
+			t.Errorf("got %d middlewares, want %d", len(g.Middlewares), w.Middlewares)
+		}
+		if g.Meta.In != w.In {
+			t.Errorf("got in type %v, want %v", g.Meta.In, w.In)
+		}
+		if g.Handler == "" {
+			t.Errorf("got empty handler name for %s %s", g.Method, g.Pattern)
+		}
+	}
+}
+
+func TestRouterValidateRoutes(t *testing.T) {
+	type OrgUserRequest struct {
+		OrgID string `ar:"path=orgId"`
+		ID    string `ar:"path=id"`
+	}
+
+	type TestCase struct {
+		Name    string
+		Mount   string
+		WantErr bool
+	}
+
+	testCases := []TestCase{}
+	testCases = append(testCases, TestCase{
+		Name:    "params of the mount pattern should be valid",
+		Mount:   "/orgs/{orgId}",
+		WantErr: false,
+	})
+	testCases = append(testCases, TestCase{
+		Name:    "params missing from the full pattern should be invalid",
+		Mount:   "/orgs",
+		WantErr: true,
+	})
+
+	for _, tt := range testCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			users := NewRouter()
+			// Registering the route doesn't panic, as orgId
+			// can come from the pattern users is mounted at.
+			Get(users, "/users/{id}", func(ar AppRequest[OrgUserRequest, any]) {})
+
+			r := NewRouter()
+			r.Route(tt.Mount, users)
+
+			err := r.ValidateRoutes()
+			if (err != nil) != tt.WantErr {
+				t.Errorf("got error %v, wantErr: %v", err, tt.WantErr)
+			}
+		})
+	}
+}